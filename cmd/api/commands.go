@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/juliovcruz/user-register/internal/users"
+	"gopkg.in/yaml.v3"
+)
+
+// runCommand executa tarefas administrativas pela linha de comando, sem subir o servidor
+func runCommand(ctx context.Context, args []string, userService *users.Service) error {
+	switch args[0] {
+	case "pepper-status":
+		status, err := userService.PepperStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	default:
+		return fmt.Errorf("unknown command %q, available commands: config print, pepper-status", args[0])
+	}
+}
+
+// runConfigCommand roda antes de abrir o banco para que `config print` mostre as
+// configurações efetivas mesmo quando elas não passam na validação
+func runConfigCommand(args []string, sett settings.Settings, loadErr error) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("unknown config command, available commands: config print")
+	}
+
+	var validationErr *settings.ValidationError
+	if loadErr != nil && !errors.As(loadErr, &validationErr) {
+		return loadErr
+	}
+
+	fmt.Printf("# environment: %s\n", sett.Environment)
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(sett.Redacted()); err != nil {
+		return err
+	}
+
+	return loadErr
+}
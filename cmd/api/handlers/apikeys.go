@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/juliovcruz/user-register/internal/security/apikey"
+	"github.com/valyala/fasthttp"
+)
+
+const currentAPIKeyKey = "currentAPIKey"
+
+type APIKeyHandler struct {
+	service *apikey.Service
+}
+
+func NewAPIKeyHandler(service *apikey.Service) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// Middleware aceita o header "Authorization: ApiKey {chave}" com o escopo exigido e
+// repassa os demais esquemas de autenticação para o middleware fallback
+func (h *APIKeyHandler) Middleware(scope apikey.Scope, fallback func(fasthttp.RequestHandler) fasthttp.RequestHandler, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	withFallback := fallback(next)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		raw, found := strings.CutPrefix(string(ctx.Request.Header.Peek("Authorization")), "ApiKey ")
+		if !found {
+			withFallback(ctx)
+			return
+		}
+
+		key, err := h.service.Authenticate(ctx, raw, scope)
+		if err != nil {
+			if errors.Is(err, apikey.ErrInsufficientScope) {
+				returnError(ctx, err)
+				return
+			}
+
+			returnError(ctx, apikey.ErrInvalidKey)
+			return
+		}
+
+		ctx.SetUserValue(currentAPIKeyKey, key)
+		next(ctx)
+	}
+}
+
+// CreateAPIKey cria uma chave de API
+// @Summary Cria chave de API
+// @Description Cria uma chave de API com escopos e validade opcional. A chave só é exibida nesta resposta, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key body apikey.CreateAPIKey true "Chave de API"
+// @Success 201 {object} apikey.CreatedAPIKey
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/api_keys [post]
+func (h *APIKeyHandler) CreateAPIKey(ctx *fasthttp.RequestCtx) {
+	var request apikey.CreateAPIKey
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	key, err := h.service.Create(ctx, currentUser(ctx).ID, request)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+	if err := json.NewEncoder(ctx).Encode(key); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// ListAPIKeys lista as chaves de API ativas
+// @Summary Lista chaves de API
+// @Description Lista as chaves de API que não foram revogadas, sem os segredos, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200 {array} apikey.APIKey
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/api_keys [get]
+func (h *APIKeyHandler) ListAPIKeys(ctx *fasthttp.RequestCtx) {
+	keys, err := h.service.List(ctx)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(keys); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// RotateAPIKey gera um novo segredo para uma chave de API
+// @Summary Rotaciona chave de API
+// @Description Gera um novo segredo mantendo nome, escopos e validade. O segredo anterior deixa de ser aceito imediatamente, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID da chave"
+// @Success 200 {object} apikey.CreatedAPIKey
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/api_keys/{id}/rotate [post]
+func (h *APIKeyHandler) RotateAPIKey(ctx *fasthttp.RequestCtx) {
+	id, err := pathID(ctx, "id")
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	key, err := h.service.Rotate(ctx, id)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(key); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// RevokeAPIKey revoga uma chave de API
+// @Summary Revoga chave de API
+// @Description Revoga uma chave de API, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID da chave"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/api_keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(ctx *fasthttp.RequestCtx) {
+	id, err := pathID(ctx, "id")
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	if err := h.service.Revoke(ctx, id); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/valyala/fasthttp"
+)
+
+// corsPolicy guarda as origens já separadas em exatas e curingas (prefixo do esquema e
+// sufixo do domínio) para que cada requisição só compare strings
+type corsPolicy struct {
+	settings  settings.CORS
+	anyOrigin bool
+	origins   map[string]struct{}
+	wildcards [][2]string
+	methods   []string
+	headers   []string
+	maxAge    string
+}
+
+func newCORSPolicy(settings settings.CORS) corsPolicy {
+	policy := corsPolicy{settings: settings, origins: map[string]struct{}{}}
+	for _, origin := range settings.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			policy.anyOrigin = true
+			continue
+		}
+		if scheme, host, found := strings.Cut(origin, "://*."); found {
+			policy.wildcards = append(policy.wildcards, [2]string{scheme + "://", "." + host})
+			continue
+		}
+		policy.origins[origin] = struct{}{}
+	}
+	for _, method := range settings.AllowedMethods {
+		policy.methods = append(policy.methods, strings.ToUpper(method))
+	}
+	for _, header := range settings.AllowedHeaders {
+		policy.headers = append(policy.headers, strings.ToLower(header))
+	}
+	if settings.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(settings.MaxAge.Seconds()))
+	}
+	return policy
+}
+
+func (p corsPolicy) enabled() bool {
+	return p.anyOrigin || len(p.origins) > 0 || len(p.wildcards) > 0
+}
+
+// allowsOrigin aceita a origem exata ou qualquer subdomínio de um curinga; o trecho no
+// lugar do curinga não pode trocar a porta nem o caminho
+func (p corsPolicy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if _, found := p.origins[origin]; found {
+		return true
+	}
+	for _, wildcard := range p.wildcards {
+		prefix, suffix := wildcard[0], wildcard[1]
+		if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			if subdomain := origin[len(prefix) : len(origin)-len(suffix)]; !strings.ContainsAny(subdomain, ":/@") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p corsPolicy) allowsHeaders(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.ToLower(strings.TrimSpace(header)); header != "" && !slices.Contains(p.headers, header) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p corsPolicy) setOrigin(ctx *fasthttp.RequestCtx, origin string) {
+	if p.anyOrigin && !p.settings.AllowCredentials {
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowOrigin, "*")
+	} else {
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowOrigin, origin)
+	}
+	if p.settings.AllowCredentials {
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowCredentials, "true")
+	}
+}
+
+// CorsMiddleware aplica a política de CORS configurada. Preflights seguem para o router,
+// que só responde OPTIONS para rotas existentes e informa os métodos no header Allow; os
+// métodos liberados são a interseção desse header com os configurados
+func CorsMiddleware(settings settings.CORS, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	policy := newCORSPolicy(settings)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		if !policy.enabled() {
+			next(ctx)
+			return
+		}
+
+		if !policy.anyOrigin || settings.AllowCredentials {
+			ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderOrigin)
+		}
+
+		origin := string(ctx.Request.Header.Peek(fasthttp.HeaderOrigin))
+		requestedMethod := string(ctx.Request.Header.Peek(fasthttp.HeaderAccessControlRequestMethod))
+		preflight := ctx.IsOptions() && origin != "" && requestedMethod != ""
+
+		if !preflight {
+			if origin != "" && policy.allowsOrigin(origin) {
+				policy.setOrigin(ctx, origin)
+				if len(settings.ExposedHeaders) > 0 {
+					ctx.Response.Header.Set(fasthttp.HeaderAccessControlExposeHeaders, strings.Join(settings.ExposedHeaders, ", "))
+				}
+			}
+			next(ctx)
+			return
+		}
+
+		if !policy.allowsOrigin(origin) {
+			returnError(ctx, errCORSNotAllowed)
+			return
+		}
+
+		next(ctx)
+		allow := string(ctx.Response.Header.Peek(fasthttp.HeaderAllow))
+		if ctx.Response.StatusCode() != fasthttp.StatusOK || allow == "" {
+			return
+		}
+
+		var methods []string
+		for _, method := range strings.Split(allow, ",") {
+			if method = strings.TrimSpace(method); slices.Contains(policy.methods, method) {
+				methods = append(methods, method)
+			}
+		}
+		if !slices.Contains(methods, requestedMethod) || !policy.allowsHeaders(string(ctx.Request.Header.Peek(fasthttp.HeaderAccessControlRequestHeaders))) {
+			// a resposta da rota não pode vazar no erro, em especial os métodos do Allow
+			ctx.Response.ResetBody()
+			ctx.Response.Header.Del(fasthttp.HeaderAllow)
+			returnError(ctx, errCORSNotAllowed)
+			return
+		}
+
+		policy.setOrigin(ctx, origin)
+		ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccessControlRequestMethod)
+		ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccessControlRequestHeaders)
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowMethods, strings.Join(methods, ", "))
+		if len(settings.AllowedHeaders) > 0 {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowHeaders, strings.Join(settings.AllowedHeaders, ", "))
+		}
+		if policy.maxAge != "" {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlMaxAge, policy.maxAge)
+		}
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func newCORSHandler(cors settings.CORS) fasthttp.RequestHandler {
+	r := router.New()
+	r.GET("/users", func(ctx *fasthttp.RequestCtx) { ctx.SetStatusCode(fasthttp.StatusOK) })
+	r.POST("/users", func(ctx *fasthttp.RequestCtx) { ctx.SetStatusCode(fasthttp.StatusCreated) })
+	r.DELETE("/users/{id}", func(ctx *fasthttp.RequestCtx) { ctx.SetStatusCode(fasthttp.StatusNoContent) })
+	return CorsMiddleware(cors, r.Handler)
+}
+
+func corsRequest(handler fasthttp.RequestHandler, method, path, origin string, headers ...string) *fasthttp.Response {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(path)
+	if origin != "" {
+		ctx.Request.Header.Set(fasthttp.HeaderOrigin, origin)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		ctx.Request.Header.Set(headers[i], headers[i+1])
+	}
+	handler(ctx)
+	return &ctx.Response
+}
+
+func TestCorsMiddleware_Origins(t *testing.T) {
+	handler := newCORSHandler(settings.CORS{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods: []string{"GET", "POST"},
+		ExposedHeaders: []string{"X-Request-ID"},
+	})
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "https://app.example.com", allowed: true},
+		{origin: "https://APP.example.com", allowed: true},
+		{origin: "https://admin.example.org", allowed: true},
+		{origin: "https://a.b.example.org", allowed: true},
+		{origin: "https://example.org", allowed: false},
+		{origin: "http://app.example.com", allowed: false},
+		{origin: "https://admin.example.org:8443", allowed: false},
+		{origin: "https://evil.com/.example.org", allowed: false},
+		{origin: "https://app.example.com.evil.com", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			resp := corsRequest(handler, "GET", "/users", tt.origin)
+
+			require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+			require.Equal(t, "Origin", string(resp.Header.Peek(fasthttp.HeaderVary)))
+			if tt.allowed {
+				require.Equal(t, tt.origin, string(resp.Header.Peek(fasthttp.HeaderAccessControlAllowOrigin)))
+				require.Equal(t, "X-Request-ID", string(resp.Header.Peek(fasthttp.HeaderAccessControlExposeHeaders)))
+			} else {
+				require.Empty(t, resp.Header.Peek(fasthttp.HeaderAccessControlAllowOrigin))
+			}
+		})
+	}
+}
+
+func TestCorsMiddleware_Preflight(t *testing.T) {
+	handler := newCORSHandler(settings.CORS{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "POST", "PUT"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           time.Minute * 10,
+	})
+
+	resp := corsRequest(handler, "OPTIONS", "/users", "https://app.example.com",
+		fasthttp.HeaderAccessControlRequestMethod, "POST",
+		fasthttp.HeaderAccessControlRequestHeaders, "content-type, authorization")
+	require.Equal(t, fasthttp.StatusNoContent, resp.StatusCode())
+	require.Equal(t, "https://app.example.com", string(resp.Header.Peek(fasthttp.HeaderAccessControlAllowOrigin)))
+	require.Equal(t, "true", string(resp.Header.Peek(fasthttp.HeaderAccessControlAllowCredentials)))
+	require.Equal(t, "GET, POST", string(resp.Header.Peek(fasthttp.HeaderAccessControlAllowMethods)))
+	require.Equal(t, "Authorization, Content-Type", string(resp.Header.Peek(fasthttp.HeaderAccessControlAllowHeaders)))
+	require.Equal(t, "600", string(resp.Header.Peek(fasthttp.HeaderAccessControlMaxAge)))
+
+	t.Run("unknown route", func(t *testing.T) {
+		resp := corsRequest(handler, "OPTIONS", "/unknown", "https://app.example.com", fasthttp.HeaderAccessControlRequestMethod, "GET")
+		require.Equal(t, fasthttp.StatusNotFound, resp.StatusCode())
+		require.Empty(t, resp.Header.Peek(fasthttp.HeaderAccessControlAllowOrigin))
+	})
+
+	rejected := []struct {
+		name    string
+		origin  string
+		path    string
+		headers []string
+	}{
+		{name: "origin", origin: "https://evil.com", path: "/users", headers: []string{fasthttp.HeaderAccessControlRequestMethod, "GET"}},
+		{name: "method not configured", origin: "https://app.example.com", path: "/users/1", headers: []string{fasthttp.HeaderAccessControlRequestMethod, "DELETE"}},
+		{name: "method not routed", origin: "https://app.example.com", path: "/users", headers: []string{fasthttp.HeaderAccessControlRequestMethod, "PUT"}},
+		{name: "header", origin: "https://app.example.com", path: "/users", headers: []string{fasthttp.HeaderAccessControlRequestMethod, "GET", fasthttp.HeaderAccessControlRequestHeaders, "X-Custom"}},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := corsRequest(handler, "OPTIONS", tt.path, tt.origin, tt.headers...)
+			require.Equal(t, fasthttp.StatusForbidden, resp.StatusCode())
+			require.Contains(t, string(resp.Body()), `"code":"cors_not_allowed"`)
+			require.Empty(t, resp.Header.Peek(fasthttp.HeaderAccessControlAllowOrigin))
+			require.Empty(t, resp.Header.Peek(fasthttp.HeaderAllow))
+		})
+	}
+}
+
+func TestCorsMiddleware_AnyOrigin(t *testing.T) {
+	handler := newCORSHandler(settings.CORS{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}})
+
+	resp := corsRequest(handler, "GET", "/users", "https://anything.test")
+	require.Equal(t, "*", string(resp.Header.Peek(fasthttp.HeaderAccessControlAllowOrigin)))
+	require.Empty(t, resp.Header.Peek(fasthttp.HeaderVary))
+}
+
+func TestCorsMiddleware_Disabled(t *testing.T) {
+	handler := newCORSHandler(settings.CORS{AllowedMethods: []string{"GET"}})
+
+	resp := corsRequest(handler, "OPTIONS", "/users", "https://app.example.com", fasthttp.HeaderAccessControlRequestMethod, "GET")
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	require.Empty(t, resp.Header.Peek(fasthttp.HeaderAccessControlAllowOrigin))
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	handler := SecurityHeadersMiddleware(settings.SecurityHeaders{
+		HSTSMaxAge:                   time.Hour * 24,
+		HSTSIncludeSubdomains:        true,
+		FrameOptions:                 "DENY",
+		ContentSecurityPolicy:        "default-src 'none'",
+		SwaggerContentSecurityPolicy: "default-src 'self'",
+	}, func(ctx *fasthttp.RequestCtx) {})
+
+	resp := corsRequest(handler, "GET", "/users", "")
+	require.Equal(t, "nosniff", string(resp.Header.Peek(fasthttp.HeaderXContentTypeOptions)))
+	require.Equal(t, "DENY", string(resp.Header.Peek(fasthttp.HeaderXFrameOptions)))
+	require.Equal(t, "default-src 'none'", string(resp.Header.Peek(fasthttp.HeaderContentSecurityPolicy)))
+	require.Empty(t, resp.Header.Peek(fasthttp.HeaderStrictTransportSecurity))
+
+	resp = corsRequest(handler, "GET", "/swagger/index.html", "")
+	require.Equal(t, "default-src 'self'", string(resp.Header.Peek(fasthttp.HeaderContentSecurityPolicy)))
+}
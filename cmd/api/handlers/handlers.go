@@ -3,15 +3,17 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
-	validatorv10 "github.com/go-playground/validator/v10"
-	"github.com/juliovcruz/user-register/internal/mailvalidation"
+	"github.com/juliovcruz/user-register/internal/platform/logging"
 	"github.com/juliovcruz/user-register/internal/security/token"
 	"github.com/juliovcruz/user-register/internal/users"
 	"github.com/valyala/fasthttp"
 )
 
-var validator = validatorv10.New()
+const currentUserKey = "currentUser"
 
 type UserHandler struct {
 	service      *users.Service
@@ -22,27 +24,45 @@ func NewUserHandler(service *users.Service, tokenService *token.Service) *UserHa
 	return &UserHandler{service: service, tokenService: tokenService}
 }
 
-// JWTMiddleware verifica a validade do token JWT
+// JWTMiddleware verifica a validade do token JWT e carrega o usuário autenticado
 func (h *UserHandler) JWTMiddleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
 	return func(ctx *fasthttp.RequestCtx) {
 		tokenString := string(ctx.Request.Header.Peek("Authorization"))
 		if tokenString == "" {
-			returnError(ctx, errors.New("authorization header required"), fasthttp.StatusUnauthorized)
+			returnError(ctx, errAuthorizationRequired)
 			return
 		}
 
-		tokenString = tokenString[len("Bearer "):]
+		tokenString, found := strings.CutPrefix(tokenString, "Bearer ")
+		if !found {
+			returnError(ctx, errInvalidToken)
+			return
+		}
 
-		valid, err := h.tokenService.IsValid(tokenString)
-		if err != nil || !valid {
-			returnError(ctx, errors.New("invalid token"), fasthttp.StatusUnauthorized)
+		user, err := h.service.Authenticate(ctx, tokenString)
+		if err != nil {
+			returnError(ctx, errInvalidToken)
 			return
 		}
 
+		ctx.SetUserValue(currentUserKey, user)
+
 		next(ctx)
 	}
 }
 
+// AdminMiddleware exige um token JWT válido de um usuário administrador
+func (h *UserHandler) AdminMiddleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return h.JWTMiddleware(func(ctx *fasthttp.RequestCtx) {
+		if currentUser(ctx).Role != users.RoleAdmin {
+			returnError(ctx, errAdminRequired)
+			return
+		}
+
+		next(ctx)
+	})
+}
+
 // CreateUser cria um novo usuário
 // @Summary Cria um novo usuário
 // @Description Cria um usuário com nome, e-mail, senha e cep
@@ -51,39 +71,31 @@ func (h *UserHandler) JWTMiddleware(next fasthttp.RequestHandler) fasthttp.Reque
 // @Produce json
 // @Param user body users.CreateUser true "Usuário"
 // @Success 201 {object} users.User
-// @Failure 400 {object} Err
-// @Failure 500 {object} Err
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 500 {object} Problem
 // @Router /users [post]
 func (h *UserHandler) CreateUser(ctx *fasthttp.RequestCtx) {
 	var request users.CreateUser
 	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
-		returnError(ctx, errors.New("invalid request"), fasthttp.StatusBadRequest)
+		returnError(ctx, errInvalidRequest)
 		return
 	}
 
 	if err := validator.Struct(request); err != nil {
-		returnError(ctx, errors.New("validation failed: "+err.Error()), fasthttp.StatusBadRequest)
+		returnError(ctx, validationError{err, request})
 		return
 	}
 
 	user, err := h.service.Create(ctx, request)
 	if err != nil {
-		if errors.Is(err, users.ErrPasswordMismatch) {
-			returnError(ctx, err, fasthttp.StatusBadRequest)
-			return
-		}
-		if errors.Is(err, users.ErrMailAlreadyExists) {
-			returnError(ctx, err, fasthttp.StatusBadRequest)
-			return
-		}
-
-		returnError(ctx, err, fasthttp.StatusInternalServerError)
+		returnError(ctx, err)
 		return
 	}
 
 	ctx.SetStatusCode(fasthttp.StatusCreated)
 	if err := json.NewEncoder(ctx).Encode(user); err != nil {
-		returnError(ctx, errors.New("failed to encode response"), fasthttp.StatusInternalServerError)
+		returnError(ctx, errors.New("failed to encode response"))
 	}
 }
 
@@ -95,29 +107,25 @@ func (h *UserHandler) CreateUser(ctx *fasthttp.RequestCtx) {
 // @Produce json
 // @Param updatePassword body users.UpdatePassword true "Atualizar senha"
 // @Success 204
-// @Failure 400 {object} Err
-// @Failure 500 {object} Err
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 500 {object} Problem
 // @Router /users/password [put]
 func (h *UserHandler) UpdatePassword(ctx *fasthttp.RequestCtx) {
 	var req users.UpdatePassword
 	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
-		returnError(ctx, errors.New("invalid request"), fasthttp.StatusBadRequest)
+		returnError(ctx, errInvalidRequest)
 		return
 	}
 
 	if err := validator.Struct(req); err != nil {
-		returnError(ctx, errors.New("validation failed: "+err.Error()), fasthttp.StatusBadRequest)
+		returnError(ctx, validationError{err, req})
 		return
 	}
 
 	err := h.service.UpdatePassword(ctx, req)
 	if err != nil {
-		if errors.Is(err, mailvalidation.ErrRecordNotFound) {
-			returnError(ctx, errors.New("don't have code for this email"), fasthttp.StatusBadRequest)
-			return
-		}
-
-		returnError(ctx, err, fasthttp.StatusInternalServerError)
+		returnError(ctx, err)
 		return
 	}
 
@@ -126,38 +134,68 @@ func (h *UserHandler) UpdatePassword(ctx *fasthttp.RequestCtx) {
 
 // Login faz login do usuário
 // @Summary Faz login do usuário
-// @Description Faz login com o e-mail e a senha do usuário
+// @Description Faz login com o e-mail e a senha do usuário. Quando o usuário possui segundo fator, retorna um desafio para /login/mfa no lugar do token
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param login body users.Login true "Fazer login"
-// @Success 200 {object} TokenResponse
-// @Failure 400 {object} Err
-// @Failure 401 {object} Err
-// @Router /users/login [post]
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 429 {object} Problem
+// @Router /login [post]
 func (h *UserHandler) Login(ctx *fasthttp.RequestCtx) {
 	var request users.Login
 	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
-		returnError(ctx, errors.New("invalid request"), fasthttp.StatusBadRequest)
+		returnError(ctx, errInvalidRequest)
 		return
 	}
 
 	if err := validator.Struct(request); err != nil {
-		returnError(ctx, errors.New("validation failed: "+err.Error()), fasthttp.StatusBadRequest)
+		returnError(ctx, validationError{err, request})
 		return
 	}
 
-	token, err := h.service.Login(ctx, request.Email, request.Password)
+	result, err := h.service.Login(ctx, request.Email, request.Password, clientInfo(ctx))
 	if err != nil {
-		returnError(ctx, err, fasthttp.StatusUnauthorized)
+		returnError(ctx, err)
 		return
 	}
 
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	response := map[string]string{"token": token}
-	if err := json.NewEncoder(ctx).Encode(response); err != nil {
-		returnError(ctx, errors.New("failed to encode response"), fasthttp.StatusInternalServerError)
+	returnLoginResult(ctx, result)
+}
+
+// LoginMFA conclui o login do usuário com o código do segundo fator
+// @Summary Conclui login com segundo fator
+// @Description Troca o desafio retornado pelo login e um código TOTP ou código de recuperação pelo token JWT
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param login body users.LoginMFA true "Desafio e código"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 429 {object} Problem
+// @Router /login/mfa [post]
+func (h *UserHandler) LoginMFA(ctx *fasthttp.RequestCtx) {
+	var request users.LoginMFA
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
 	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	result, err := h.service.LoginMFA(ctx, request, clientInfo(ctx))
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	returnLoginResult(ctx, result)
 }
 
 // ForgotPassword inicia o processo de recuperação de senha
@@ -168,24 +206,604 @@ func (h *UserHandler) Login(ctx *fasthttp.RequestCtx) {
 // @Produce json
 // @Param email body users.ForgotPassword true "Email para recuperação"
 // @Success 204
-// @Failure 400 {object} Err
-// @Failure 500 {object} Err
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
 // @Router /users/forgot_password [post]
 func (h *UserHandler) ForgotPassword(ctx *fasthttp.RequestCtx) {
 	var request users.ForgotPassword
 	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
-		returnError(ctx, errors.New("invalid request"), fasthttp.StatusBadRequest)
+		returnError(ctx, errInvalidRequest)
 		return
 	}
 
 	if err := validator.Struct(request); err != nil {
-		returnError(ctx, errors.New("validation failed: "+err.Error()), fasthttp.StatusBadRequest)
+		returnError(ctx, validationError{err, request})
 		return
 	}
 
 	err := h.service.ForgotPassword(ctx, request.Email)
 	if err != nil {
-		returnError(ctx, err, fasthttp.StatusInternalServerError)
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// ResetPasswordWithLink atualiza a senha do usuário através de um link mágico
+// @Summary Atualiza a senha do usuário através de link
+// @Description Atualiza a senha do usuário com o token recebido no link de recuperação de senha
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param resetPassword body users.ResetPasswordWithLink true "Atualizar senha com link"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/password/link [put]
+func (h *UserHandler) ResetPasswordWithLink(ctx *fasthttp.RequestCtx) {
+	var request users.ResetPasswordWithLink
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	err := h.service.ResetPasswordWithLink(ctx, request)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// RequestEmailVerification envia o link de verificação de e-mail
+// @Summary Solicita verificação de e-mail
+// @Description Envia um link para verificação do e-mail do usuário
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param email body users.RequestLink true "Email para verificação"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/email_verification [post]
+func (h *UserHandler) RequestEmailVerification(ctx *fasthttp.RequestCtx) {
+	var request users.RequestLink
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	if err := h.service.RequestEmailVerification(ctx, request.Email); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// VerifyEmail confirma o e-mail do usuário através de um link mágico
+// @Summary Confirma verificação de e-mail
+// @Description Confirma o e-mail do usuário com o token recebido no link de verificação
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body users.ConsumeLink true "Token do link"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/email_verification/confirm [post]
+func (h *UserHandler) VerifyEmail(ctx *fasthttp.RequestCtx) {
+	var request users.ConsumeLink
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	if err := h.service.VerifyEmail(ctx, request.Token); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// RequestLoginLink envia o link de login sem senha
+// @Summary Solicita link de login
+// @Description Envia um link para login sem senha
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param email body users.RequestLink true "Email para login"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /login/link [post]
+func (h *UserHandler) RequestLoginLink(ctx *fasthttp.RequestCtx) {
+	var request users.RequestLink
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	if err := h.service.RequestLoginLink(ctx, request.Email); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// LoginWithLink faz login do usuário através de um link mágico
+// @Summary Faz login com link
+// @Description Faz login com o token recebido no link de login
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body users.ConsumeLink true "Token do link"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Router /login/link/confirm [post]
+func (h *UserHandler) LoginWithLink(ctx *fasthttp.RequestCtx) {
+	var request users.ConsumeLink
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	result, err := h.service.LoginWithLink(ctx, request.Token, clientInfo(ctx))
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	returnLoginResult(ctx, result)
+}
+
+// RequestUnlock envia o link de desbloqueio de conta
+// @Summary Solicita desbloqueio de conta
+// @Description Envia um link para desbloquear a conta após tentativas de login inválidas
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param email body users.RequestLink true "Email da conta bloqueada"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /login/unlock [post]
+func (h *UserHandler) RequestUnlock(ctx *fasthttp.RequestCtx) {
+	var request users.RequestLink
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	if err := h.service.RequestUnlock(ctx, request.Email); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// UnlockWithLink desbloqueia a conta através de um link mágico
+// @Summary Desbloqueia conta com link
+// @Description Desbloqueia a conta com o token recebido no link de desbloqueio
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body users.ConsumeLink true "Token do link"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /login/unlock/confirm [post]
+func (h *UserHandler) UnlockWithLink(ctx *fasthttp.RequestCtx) {
+	var request users.ConsumeLink
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	if err := h.service.UnlockWithLink(ctx, request.Token); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// AdminUnlock desbloqueia a conta de um usuário
+// @Summary Desbloqueia conta de usuário
+// @Description Remove o bloqueio por tentativas de login inválidas de um usuário, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID do usuário"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/users/{id}/lockout [delete]
+func (h *UserHandler) AdminUnlock(ctx *fasthttp.RequestCtx) {
+	userID, err := pathID(ctx, "id")
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	if err := h.service.AdminUnlock(ctx, userID); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// ListSessions lista as sessões ativas do usuário autenticado
+// @Summary Lista sessões
+// @Description Lista as sessões ativas do usuário autenticado com data de criação, último uso, IP e user agent, utilizar header "Authorization": "Bearer {token}"
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Success 200 {array} users.Session
+// @Failure 401 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/me/sessions [get]
+func (h *UserHandler) ListSessions(ctx *fasthttp.RequestCtx) {
+	user := currentUser(ctx)
+	h.listSessions(ctx, user.ID, user.SessionID)
+}
+
+// RevokeSession revoga uma sessão do usuário autenticado
+// @Summary Revoga sessão
+// @Description Revoga uma sessão do usuário autenticado, o token vinculado a ela deixa de ser aceito, utilizar header "Authorization": "Bearer {token}"
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Param id path string true "ID da sessão"
+// @Success 204
+// @Failure 401 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/me/sessions/{id} [delete]
+func (h *UserHandler) RevokeSession(ctx *fasthttp.RequestCtx) {
+	sessionID, _ := ctx.UserValue("id").(string)
+	h.revokeSession(ctx, currentUser(ctx).ID, sessionID)
+}
+
+// AdminListSessions lista as sessões ativas de um usuário
+// @Summary Lista sessões de usuário
+// @Description Lista as sessões ativas de um usuário, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID do usuário"
+// @Success 200 {array} users.Session
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/users/{id}/sessions [get]
+func (h *UserHandler) AdminListSessions(ctx *fasthttp.RequestCtx) {
+	userID, err := pathID(ctx, "id")
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	h.listSessions(ctx, userID, "")
+}
+
+// AdminRevokeSession revoga uma sessão de um usuário
+// @Summary Revoga sessão de usuário
+// @Description Revoga uma sessão de um usuário, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID do usuário"
+// @Param session_id path string true "ID da sessão"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/users/{id}/sessions/{session_id} [delete]
+func (h *UserHandler) AdminRevokeSession(ctx *fasthttp.RequestCtx) {
+	userID, err := pathID(ctx, "id")
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	sessionID, _ := ctx.UserValue("session_id").(string)
+	h.revokeSession(ctx, userID, sessionID)
+}
+
+// AdminRevokeSessions revoga todas as sessões de um usuário
+// @Summary Revoga todas as sessões de usuário
+// @Description Revoga todas as sessões ativas de um usuário, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID do usuário"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/users/{id}/sessions [delete]
+func (h *UserHandler) AdminRevokeSessions(ctx *fasthttp.RequestCtx) {
+	userID, err := pathID(ctx, "id")
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	if err := h.service.RevokeSessions(ctx, userID); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+func (h *UserHandler) revokeSession(ctx *fasthttp.RequestCtx, userID int64, sessionID string) {
+	if err := h.service.RevokeSession(ctx, userID, sessionID); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+func (h *UserHandler) listSessions(ctx *fasthttp.RequestCtx, userID int64, currentSessionID string) {
+	sessions, err := h.service.ListSessions(ctx, userID, currentSessionID)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(sessions); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// AdminPepperStatus mostra quantos usuários ainda dependem de cada pepper
+// @Summary Situação da rotação de pepper
+// @Description Conta os hashes de senha por pepper: atual, anterior, bcrypt legado ou desconhecido, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} users.PepperStatus
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/password_hashes/peppers [get]
+func (h *UserHandler) AdminPepperStatus(ctx *fasthttp.RequestCtx) {
+	status, err := h.service.PepperStatus(ctx)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(status); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// AdminForcePepperReset obriga os usuários no pepper anterior a redefinir a senha
+// @Summary Força redefinição de senha dos usuários no pepper anterior
+// @Description Invalida a senha e as sessões dos usuários cujo hash ainda usa o pepper anterior e envia um link de redefinição, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param options body users.ForcePepperReset false "Incluir hashes bcrypt legados"
+// @Success 200 {object} users.ForcedPasswordResets
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/password_hashes/force_reset [post]
+func (h *UserHandler) AdminForcePepperReset(ctx *fasthttp.RequestCtx) {
+	var request users.ForcePepperReset
+	if body := ctx.PostBody(); len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			returnError(ctx, errInvalidRequest)
+			return
+		}
+	}
+
+	count, err := h.service.ForcePepperReset(ctx, request.IncludeLegacy)
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "password reset partially applied", "users", count)
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(users.ForcedPasswordResets{Users: count}); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// RequestEmailChange inicia a troca de e-mail do usuário autenticado
+// @Summary Solicita troca de e-mail
+// @Description Envia um código para o novo e-mail do usuário autenticado, utilizar header "Authorization": "Bearer {token}"
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param email body users.RequestEmailChange true "Novo e-mail"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/me/email [post]
+func (h *UserHandler) RequestEmailChange(ctx *fasthttp.RequestCtx) {
+	var request users.RequestEmailChange
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	err := h.service.RequestEmailChange(ctx, currentUser(ctx), request.Email)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// ChangePassword troca a senha do usuário autenticado
+// @Summary Troca a senha do usuário autenticado
+// @Description Troca a senha após validar a senha atual, recusa senhas usadas recentemente, revoga as demais sessões e retorna um novo token, utilizar header "Authorization": "Bearer {token}"
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param password body users.ChangePassword true "Senha atual e nova senha"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/me/password [post]
+func (h *UserHandler) ChangePassword(ctx *fasthttp.RequestCtx) {
+	var request users.ChangePassword
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	token, err := h.service.ChangePassword(ctx, currentUser(ctx), request, clientInfo(ctx))
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(TokenResponse{Token: token}); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// ConfirmEmailChange confirma a troca de e-mail do usuário autenticado
+// @Summary Confirma troca de e-mail
+// @Description Confirma o novo e-mail com o código recebido, revoga as sessões existentes e notifica o e-mail anterior, utilizar header "Authorization": "Bearer {token}"
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param code body users.ConfirmEmailChange true "Código recebido no novo e-mail"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/me/email/confirm [post]
+func (h *UserHandler) ConfirmEmailChange(ctx *fasthttp.RequestCtx) {
+	var request users.ConfirmEmailChange
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	err := h.service.ConfirmEmailChange(ctx, currentUser(ctx), request.Code)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// UndoEmailChange desfaz a troca de e-mail através do link enviado ao e-mail anterior
+// @Summary Desfaz troca de e-mail
+// @Description Restaura o e-mail anterior com o token recebido no link de notificação e revoga as sessões existentes
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body users.ConsumeLink true "Token do link"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/email/undo [post]
+func (h *UserHandler) UndoEmailChange(ctx *fasthttp.RequestCtx) {
+	var request users.ConsumeLink
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	if err := h.service.UndoEmailChange(ctx, request.Token); err != nil {
+		returnError(ctx, err)
 		return
 	}
 
@@ -194,31 +812,31 @@ func (h *UserHandler) ForgotPassword(ctx *fasthttp.RequestCtx) {
 
 // ListUsers lista todos os usuários
 // @Summary Lista usuários
-// @Description Lista todos os usuários com limit e offset utilizar header "Authorization": "Bearer {token}"
+// @Description Lista todos os usuários com limit e offset utilizar header "Authorization": "Bearer {token}" ou "Authorization": "ApiKey {chave}" com o escopo users:read. Serviços com certificado de cliente mapeado também são aceitos quando o mTLS está habilitado
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param limit query int false "Limit Padrão: 10"
 // @Param offset query int false "Offset - Padrão: 0"
 // @Success 200 {array} users.User
-// @Failure 400 {object} Err
-// @Failure 500 {object} Err
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
 // @Router /users [get]
 func (h *UserHandler) ListUsers(ctx *fasthttp.RequestCtx) {
 	limit, offset, err := getLimitAndOffSet(ctx)
 	if err != nil {
-		returnError(ctx, err, fasthttp.StatusBadRequest)
+		returnError(ctx, err)
 		return
 	}
 
 	users, err := h.service.List(ctx, limit, offset)
 	if err != nil {
-		returnError(ctx, err, fasthttp.StatusInternalServerError)
+		returnError(ctx, err)
 		return
 	}
 
 	if err := json.NewEncoder(ctx).Encode(users); err != nil {
-		returnError(ctx, errors.New("failed to encode response"), fasthttp.StatusInternalServerError)
+		returnError(ctx, errors.New("failed to encode response"))
 	}
 }
 
@@ -227,11 +845,8 @@ func getLimitAndOffSet(ctx *fasthttp.RequestCtx) (int, int, error) {
 
 	offset := ctx.QueryArgs().GetUintOrZero("offset")
 
-	if limit < 0 {
-		return 0, 0, errors.New("invalid limit")
-	}
-	if offset < 0 {
-		return 0, 0, errors.New("invalid offset")
+	if limit < 0 || offset < 0 {
+		return 0, 0, errInvalidPagination
 	}
 
 	if limit == 0 {
@@ -241,32 +856,41 @@ func getLimitAndOffSet(ctx *fasthttp.RequestCtx) (int, int, error) {
 	return limit, offset, nil
 }
 
-func returnError(ctx *fasthttp.RequestCtx, err error, statusCode int) {
-	ctx.SetStatusCode(statusCode)
-	if err := json.NewEncoder(ctx).Encode(Err{Error: err.Error()}); err != nil {
-		ctx.Error("failed to encode response", fasthttp.StatusInternalServerError)
+func clientInfo(ctx *fasthttp.RequestCtx) users.ClientInfo {
+	return users.ClientInfo{
+		IP:        ctx.RemoteIP().String(),
+		UserAgent: string(ctx.UserAgent()),
 	}
 }
 
-type Err struct {
-	Error string `json:"error"`
+func pathID(ctx *fasthttp.RequestCtx, name string) (int64, error) {
+	value, _ := ctx.UserValue(name).(string)
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%w: %s", errInvalidID, name)
+	}
+	return id, nil
+}
+
+func currentUser(ctx *fasthttp.RequestCtx) users.User {
+	user, _ := ctx.UserValue(currentUserKey).(users.User)
+	return user
 }
 
 type TokenResponse struct {
 	Token string `json:"token"`
 }
 
-func CorsMiddleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
-	return func(ctx *fasthttp.RequestCtx) {
-		ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
-		ctx.Response.Header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		ctx.Response.Header.Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if string(ctx.Method()) == "OPTIONS" {
-			ctx.SetStatusCode(fasthttp.StatusOK)
-			return
-		}
+type LoginResponse struct {
+	Token       string `json:"token,omitempty"`
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
 
-		next(ctx)
+func returnLoginResult(ctx *fasthttp.RequestCtx, result users.LoginResult) {
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	response := LoginResponse{Token: result.Token, MFARequired: result.MFARequired, MFAToken: result.MFAToken}
+	if err := json.NewEncoder(ctx).Encode(response); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
 	}
 }
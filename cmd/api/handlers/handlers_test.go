@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/juliovcruz/user-register/internal/mailvalidation"
+	"github.com/juliovcruz/user-register/internal/platform/database"
+	"github.com/juliovcruz/user-register/internal/platform/health"
+	"github.com/juliovcruz/user-register/internal/platform/metrics"
+	"github.com/juliovcruz/user-register/internal/security/encryption"
+	"github.com/juliovcruz/user-register/internal/security/hash"
+	"github.com/juliovcruz/user-register/internal/security/lockout"
+	"github.com/juliovcruz/user-register/internal/security/oauth"
+	"github.com/juliovcruz/user-register/internal/security/oidc"
+	"github.com/juliovcruz/user-register/internal/security/token"
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/juliovcruz/user-register/internal/users"
+	"github.com/juliovcruz/user-register/internal/users/mfa"
+	"github.com/juliovcruz/user-register/internal/users/normalization"
+	"github.com/juliovcruz/user-register/internal/users/password"
+	"github.com/juliovcruz/user-register/internal/users/registration"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+type senderMock struct{}
+
+func (s *senderMock) Send(ctx context.Context, email string, code int) error {
+	return nil
+}
+
+func (s *senderMock) SendLink(ctx context.Context, email string, purpose mailvalidation.Purpose, link string) error {
+	return nil
+}
+
+func (s *senderMock) SendNotification(ctx context.Context, email string, notification mailvalidation.Notification) error {
+	return nil
+}
+
+type zipCodeServiceMock struct{}
+
+func (z *zipCodeServiceMock) GetAddressByZipCode(ctx context.Context, zipCode string) (users.Address, error) {
+	return users.Address{ZipCode: zipCode}, nil
+}
+
+type response struct {
+	statusCode int
+	body       string
+	location   string
+}
+
+type testServer struct {
+	t            *testing.T
+	client       *fasthttp.Client
+	oauthService *oauth.Service
+}
+
+func newTestClient(t *testing.T) func(method, path, body string, token ...string) response {
+	return newTestServer(t).do
+}
+
+func newTestServer(t *testing.T) *testServer {
+	sett := settings.Settings{
+		TokenSettings:      settings.TokenSettings{Secret: "token-secret", ExpirationTime: time.Minute},
+		Database:           settings.Database{Secrets: settings.Secrets{Current: "current", Previous: "previous", CurrentID: "v2", PreviousID: "v1"}},
+		MagicLinkSettings:  settings.MagicLink{Secret: "link-secret", ExpirationTime: time.Minute},
+		EmailNormalization: settings.EmailNormalization{LowercaseLocalPart: true},
+		Lockout:            settings.Lockout{AccountThreshold: 100, IPThreshold: 100, FreeAttempts: 100},
+		Hashing:            settings.Hashing{Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		OAuth:              settings.OAuth{AuthorizationCodeExpirationTime: time.Minute, AccessTokenExpirationTime: time.Minute, RefreshTokenExpirationTime: time.Hour},
+		OIDC:               settings.OIDC{Issuer: "http://localhost", IDTokenExpirationTime: time.Minute},
+	}
+
+	db, err := database.NewDatabase(t.TempDir()+"/database.db", "sqlite3")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	userRepository, err := users.NewSQLiteRepository(db)
+	require.NoError(t, err)
+
+	registrationService, err := registration.NewService(registration.NewRepository(db), sett.RegistrationPolicy)
+	require.NoError(t, err)
+
+	passwordPolicy, err := password.NewService(settings.PasswordPolicy{MinLength: 8, MaxLength: 128, MinEntropyBits: 40, HistorySize: 3})
+	require.NoError(t, err)
+
+	tokenService := token.NewService(sett)
+	userService := users.NewService(
+		userRepository, tokenService, &zipCodeServiceMock{}, hash.NewService(sett, metrics.NewRecorder()),
+		mailvalidation.NewService(mailvalidation.NewRepository(db), &senderMock{}, time.Hour, sett.MagicLinkSettings, metrics.NewRecorder()),
+		normalization.NewService(sett.EmailNormalization), registrationService, passwordPolicy,
+		lockout.NewService(lockout.NewRepository(db), sett.Lockout),
+		mfa.NewService(mfa.NewRepository(db), encryption.NewService(sett), sett.MFA), metrics.NewRecorder(), slog.Default(),
+	)
+	userHandler := NewUserHandler(userService, tokenService)
+	oidcService, err := oidc.NewService(userService, sett.OIDC)
+	require.NoError(t, err)
+	oauthService := oauth.NewService(oauth.NewRepository(db), tokenService, userService, oidcService, sett.OAuth)
+	oauthHandler := NewOAuthHandler(oauthService)
+	oidcHandler := NewOIDCHandler(oidcService, oauthService)
+
+	healthHandler := NewHealthHandler(health.NewService(settings.Health{Timeout: time.Second},
+		health.Dependency{Name: "database", Required: true, Check: db.PingContext},
+		health.Dependency{Name: "migrations", Required: true, Check: func(ctx context.Context) error { return database.CheckMigrations(ctx, db) }},
+	))
+
+	r := router.New()
+	r.GET("/healthz", healthHandler.Liveness)
+	r.GET("/readyz", healthHandler.Readiness)
+	r.POST("/users", userHandler.CreateUser)
+	r.POST("/users/forgot_password", userHandler.ForgotPassword)
+	r.POST("/login", userHandler.Login)
+	r.GET("/users", oauthHandler.Middleware(oauth.ScopeUsersRead, userHandler.JWTMiddleware, userHandler.ListUsers))
+	r.POST("/users/me/password", userHandler.JWTMiddleware(userHandler.ChangePassword))
+	r.GET("/users/me/sessions", userHandler.JWTMiddleware(userHandler.ListSessions))
+	r.DELETE("/users/me/sessions/{id}", userHandler.JWTMiddleware(userHandler.RevokeSession))
+	r.GET("/oauth/authorize", userHandler.JWTMiddleware(oauthHandler.Authorize))
+	r.POST("/oauth/authorize", userHandler.JWTMiddleware(oauthHandler.Consent))
+	r.POST("/oauth/token", oauthHandler.Token)
+	r.GET("/userinfo", oidcHandler.UserInfo)
+	r.GET("/.well-known/openid-configuration", oidcHandler.Discovery)
+	r.GET("/.well-known/jwks.json", oidcHandler.JWKS)
+
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: r.Handler}
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Shutdown() })
+
+	return &testServer{
+		t:            t,
+		client:       &fasthttp.Client{Dial: func(addr string) (net.Conn, error) { return ln.Dial() }},
+		oauthService: oauthService,
+	}
+}
+
+func (s *testServer) do(method, path, body string, token ...string) response {
+	headers := map[string]string{}
+	if len(token) > 0 {
+		headers["Authorization"] = "Bearer " + token[0]
+	}
+	return s.request(method, path, body, headers)
+}
+
+func (s *testServer) request(method, path, body string, headers map[string]string) response {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(method)
+	req.SetRequestURI("http://localhost" + path)
+	req.SetBodyString(body)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	require.NoError(s.t, s.client.Do(req, resp))
+
+	return response{
+		statusCode: resp.StatusCode(),
+		body:       string(resp.Body()),
+		location:   string(resp.Header.Peek("Location")),
+	}
+}
+
+func TestUserHandler_NoUserEnumeration(t *testing.T) {
+	do := newTestClient(t)
+
+	created := do("POST", "/users", `{"name":"User Name","email":"user@example.com","password":"correct-horse-battery","confirm_password":"correct-horse-battery","zip_code":"74360400"}`)
+	require.Equal(t, fasthttp.StatusCreated, created.statusCode)
+
+	t.Run("Login", func(t *testing.T) {
+		wrongPassword := do("POST", "/login", `{"email":"user@example.com","password":"wrong-password"}`)
+		unknownEmail := do("POST", "/login", `{"email":"unknown@example.com","password":"wrong-password"}`)
+
+		require.Equal(t, fasthttp.StatusUnauthorized, wrongPassword.statusCode)
+		require.Equal(t, wrongPassword, unknownEmail)
+	})
+
+	t.Run("ForgotPassword", func(t *testing.T) {
+		existing := do("POST", "/users/forgot_password", `{"email":"user@example.com"}`)
+		unknown := do("POST", "/users/forgot_password", `{"email":"unknown@example.com"}`)
+		existingAgain := do("POST", "/users/forgot_password", `{"email":"user@example.com"}`)
+
+		require.Equal(t, fasthttp.StatusNoContent, existing.statusCode)
+		require.Equal(t, existing, unknown)
+		require.Equal(t, existing, existingAgain)
+	})
+}
+
+func TestUserHandler_LoginPasswordLength(t *testing.T) {
+	do := newTestClient(t)
+
+	// o tamanho da senha é regra da política, o login aceita qualquer senha cadastrada
+	longPassword := strings.Repeat("Tq8#mVz!pL2w-", 10)[:128]
+	created := do("POST", "/users", `{"name":"User Name","email":"user@example.com","password":"`+longPassword+`","confirm_password":"`+longPassword+`","zip_code":"74360400"}`)
+	require.Equal(t, fasthttp.StatusCreated, created.statusCode)
+
+	require.Equal(t, fasthttp.StatusOK, do("POST", "/login", `{"email":"user@example.com","password":"`+longPassword+`"}`).statusCode)
+	require.Equal(t, fasthttp.StatusUnauthorized, do("POST", "/login", `{"email":"user@example.com","password":"short"}`).statusCode)
+	require.Equal(t, fasthttp.StatusBadRequest, do("POST", "/login", `{"email":"user@example.com","password":""}`).statusCode)
+}
+
+func TestUserHandler_ChangePassword(t *testing.T) {
+	do := newTestClient(t)
+
+	created := do("POST", "/users", `{"name":"User Name","email":"user@example.com","password":"correct-horse-battery","confirm_password":"correct-horse-battery","zip_code":"74360400"}`)
+	require.Equal(t, fasthttp.StatusCreated, created.statusCode)
+
+	login := do("POST", "/login", `{"email":"user@example.com","password":"correct-horse-battery"}`)
+	require.Equal(t, fasthttp.StatusOK, login.statusCode)
+
+	var loginResponse LoginResponse
+	require.NoError(t, json.Unmarshal([]byte(login.body), &loginResponse))
+
+	wrongCurrent := do("POST", "/users/me/password", `{"current_password":"wrong-password","password":"another-horse-battery","confirm_password":"another-horse-battery"}`, loginResponse.Token)
+	require.Equal(t, fasthttp.StatusBadRequest, wrongCurrent.statusCode)
+
+	reused := do("POST", "/users/me/password", `{"current_password":"correct-horse-battery","password":"correct-horse-battery","confirm_password":"correct-horse-battery"}`, loginResponse.Token)
+	require.Equal(t, fasthttp.StatusUnprocessableEntity, reused.statusCode)
+	require.Contains(t, reused.body, `"rule":"history"`)
+
+	changed := do("POST", "/users/me/password", `{"current_password":"correct-horse-battery","password":"another-horse-battery","confirm_password":"another-horse-battery"}`, loginResponse.Token)
+	require.Equal(t, fasthttp.StatusOK, changed.statusCode)
+
+	var tokenResponse TokenResponse
+	require.NoError(t, json.Unmarshal([]byte(changed.body), &tokenResponse))
+	require.Equal(t, fasthttp.StatusOK, do("GET", "/users", "", tokenResponse.Token).statusCode)
+	require.Equal(t, fasthttp.StatusUnauthorized, do("GET", "/users", "", loginResponse.Token).statusCode)
+
+	changedBack := do("POST", "/users/me/password", `{"current_password":"another-horse-battery","password":"correct-horse-battery","confirm_password":"correct-horse-battery"}`, tokenResponse.Token)
+	require.Equal(t, fasthttp.StatusUnprocessableEntity, changedBack.statusCode)
+
+	newLogin := do("POST", "/login", `{"email":"user@example.com","password":"another-horse-battery"}`)
+	require.Equal(t, fasthttp.StatusOK, newLogin.statusCode)
+}
+
+func TestUserHandler_Sessions(t *testing.T) {
+	do := newTestClient(t)
+
+	created := do("POST", "/users", `{"name":"User Name","email":"user@example.com","password":"correct-horse-battery","confirm_password":"correct-horse-battery","zip_code":"74360400"}`)
+	require.Equal(t, fasthttp.StatusCreated, created.statusCode)
+
+	login := func() string {
+		resp := do("POST", "/login", `{"email":"user@example.com","password":"correct-horse-battery"}`)
+		require.Equal(t, fasthttp.StatusOK, resp.statusCode)
+
+		var loginResponse LoginResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.body), &loginResponse))
+		return loginResponse.Token
+	}
+	current, other := login(), login()
+
+	listed := do("GET", "/users/me/sessions", "", current)
+	require.Equal(t, fasthttp.StatusOK, listed.statusCode)
+
+	var sessions []users.Session
+	require.NoError(t, json.Unmarshal([]byte(listed.body), &sessions))
+	require.Len(t, sessions, 2)
+
+	var otherID string
+	for _, session := range sessions {
+		if !session.Current {
+			otherID = session.ID
+		}
+	}
+	require.NotEmpty(t, otherID)
+
+	require.Equal(t, fasthttp.StatusNoContent, do("DELETE", "/users/me/sessions/"+otherID, "", current).statusCode)
+	require.Equal(t, fasthttp.StatusNotFound, do("DELETE", "/users/me/sessions/"+otherID, "", current).statusCode)
+	require.Equal(t, fasthttp.StatusUnauthorized, do("GET", "/users", "", other).statusCode)
+	require.Equal(t, fasthttp.StatusOK, do("GET", "/users", "", current).statusCode)
+}
+
+func TestUserHandler_UsersOmitPasswordHashes(t *testing.T) {
+	do := newTestClient(t)
+
+	created := do("POST", "/users", `{"name":"User Name","email":"user@example.com","password":"correct-horse-battery","confirm_password":"correct-horse-battery","zip_code":"74360400"}`)
+	require.Equal(t, fasthttp.StatusCreated, created.statusCode)
+
+	var loginResponse LoginResponse
+	require.NoError(t, json.Unmarshal([]byte(do("POST", "/login", `{"email":"user@example.com","password":"correct-horse-battery"}`).body), &loginResponse))
+
+	listed := do("GET", "/users", "", loginResponse.Token)
+	require.Equal(t, fasthttp.StatusOK, listed.statusCode)
+
+	var listedUsers []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(listed.body), &listedUsers))
+	require.Len(t, listedUsers, 1)
+	require.Equal(t, "user@example.com", listedUsers[0]["email"])
+
+	for _, body := range []string{created.body, listed.body} {
+		require.NotContains(t, body, `"password"`)
+		require.NotContains(t, body, "$argon2id$")
+	}
+}
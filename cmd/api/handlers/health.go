@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/juliovcruz/user-register/internal/platform/health"
+	"github.com/valyala/fasthttp"
+)
+
+type HealthHandler struct {
+	service *health.Service
+}
+
+func NewHealthHandler(service *health.Service) *HealthHandler {
+	return &HealthHandler{service: service}
+}
+
+// Liveness indica que o processo está respondendo, sem verificar dependências
+// @Summary Liveness
+// @Description Responde 200 enquanto o processo atende requisições
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Readiness
+// @Router /healthz [get]
+func (h *HealthHandler) Liveness(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(health.Readiness{Status: health.StatusUp}); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// Readiness indica se a aplicação pode receber tráfego
+// @Summary Readiness
+// @Description Verifica o banco, as migrations e as dependências opcionais. Responde 503 quando uma dependência obrigatória falha
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Readiness
+// @Failure 503 {object} health.Readiness
+// @Router /readyz [get]
+func (h *HealthHandler) Readiness(ctx *fasthttp.RequestCtx) {
+	report := h.service.Check(ctx)
+
+	ctx.SetStatusCode(statusCode(report))
+	if err := json.NewEncoder(ctx).Encode(report.Readiness()); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// Status detalha cada dependência
+// @Summary Status das dependências
+// @Description Mostra latência, erro atual e último erro de cada dependência, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 503 {object} health.Report
+// @Router /status [get]
+func (h *HealthHandler) Status(ctx *fasthttp.RequestCtx) {
+	report := h.service.Check(ctx)
+
+	ctx.SetStatusCode(statusCode(report))
+	if err := json.NewEncoder(ctx).Encode(report); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+func statusCode(report health.Report) int {
+	if report.Status == health.StatusDown {
+		return fasthttp.StatusServiceUnavailable
+	}
+	return fasthttp.StatusOK
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestHealthHandler(t *testing.T) {
+	do := newTestClient(t)
+
+	liveness := do("GET", "/healthz", "")
+	require.Equal(t, fasthttp.StatusOK, liveness.statusCode)
+	require.JSONEq(t, `{"status":"up"}`, liveness.body)
+
+	readiness := do("GET", "/readyz", "")
+	require.Equal(t, fasthttp.StatusOK, readiness.statusCode)
+	require.JSONEq(t, `{"status":"up","checks":{"database":"up","migrations":"up"}}`, readiness.body)
+}
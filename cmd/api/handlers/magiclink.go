@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/mailvalidation"
+	"github.com/valyala/fasthttp"
+)
+
+type magicLinkAction struct {
+	method string
+	path   string
+}
+
+// magicLinkActions liga cada finalidade de link à rota que conclui a ação com o token
+var magicLinkActions = map[mailvalidation.Purpose]magicLinkAction{
+	mailvalidation.PurposePasswordReset:     {method: fasthttp.MethodPut, path: "/users/password/link"},
+	mailvalidation.PurposeEmailVerification: {method: fasthttp.MethodPost, path: "/users/email_verification/confirm"},
+	mailvalidation.PurposeLogin:             {method: fasthttp.MethodPost, path: "/login/link/confirm"},
+	mailvalidation.PurposeEmailChangeUndo:   {method: fasthttp.MethodPost, path: "/users/email/undo"},
+	mailvalidation.PurposeAccountUnlock:     {method: fasthttp.MethodPost, path: "/login/unlock/confirm"},
+}
+
+type MagicLinkResponse struct {
+	Purpose   mailvalidation.Purpose `json:"purpose" example:"login"`
+	Token     string                 `json:"token" example:"eyJwdXJwb3NlIjoi..."`
+	Method    string                 `json:"method" example:"POST"`
+	Path      string                 `json:"path" example:"/login/link/confirm"`
+	ExpiresAt time.Time              `json:"expires_at"`
+}
+
+type MagicLinkHandler struct {
+	service *mailvalidation.Service
+}
+
+func NewMagicLinkHandler(service *mailvalidation.Service) *MagicLinkHandler {
+	return &MagicLinkHandler{service: service}
+}
+
+// OpenMagicLink confere o link enviado por e-mail sem consumi-lo
+// @Summary Abre um link mágico
+// @Description Destino padrão dos links enviados por e-mail. Confere o token sem consumi-lo e informa a rota que conclui a ação; GETs de pré-visualização de clientes de e-mail não gastam o link
+// @Tags links
+// @Produce json
+// @Param purpose query string true "Finalidade do link"
+// @Param token query string true "Token do link"
+// @Success 200 {object} MagicLinkResponse
+// @Failure 400 {object} Problem
+// @Router /magic-link [get]
+func (h *MagicLinkHandler) OpenMagicLink(ctx *fasthttp.RequestCtx) {
+	token := string(ctx.QueryArgs().Peek("token"))
+	link, err := h.service.InspectLink(token)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	action, found := magicLinkActions[link.Purpose]
+	if !found || string(ctx.QueryArgs().Peek("purpose")) != string(link.Purpose) {
+		returnError(ctx, mailvalidation.ErrInvalidLink)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	response := MagicLinkResponse{Purpose: link.Purpose, Token: token, Method: action.method, Path: action.path, ExpiresAt: link.ExpiredAt}
+	if err := json.NewEncoder(ctx).Encode(response); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
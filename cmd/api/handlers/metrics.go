@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/valyala/fasthttp"
+)
+
+// MetricsMiddleware protege /metrics com o token configurado; fora do ambiente local a
+// validação das configurações exige o token, e só em desenvolvimento a rota fica aberta
+func MetricsMiddleware(settings settings.Metrics, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if settings.Token != "" {
+			raw, _ := strings.CutPrefix(string(ctx.Request.Header.Peek("Authorization")), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(raw), []byte(settings.Token)) != 1 {
+				returnError(ctx, errInvalidMetricsToken)
+				return
+			}
+		}
+
+		next(ctx)
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/juliovcruz/user-register/internal/users/mfa"
+	"github.com/valyala/fasthttp"
+)
+
+type MFAHandler struct {
+	service *mfa.Service
+}
+
+func NewMFAHandler(service *mfa.Service) *MFAHandler {
+	return &MFAHandler{service: service}
+}
+
+// EnrollTOTP inicia o cadastro do segundo fator TOTP do usuário autenticado
+// @Summary Cadastra TOTP
+// @Description Gera o segredo TOTP e a URI otpauth para o aplicativo autenticador, utilizar header "Authorization": "Bearer {token}"
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Success 201 {object} mfa.Enrollment
+// @Failure 401 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/me/mfa/totp [post]
+func (h *MFAHandler) EnrollTOTP(ctx *fasthttp.RequestCtx) {
+	user := currentUser(ctx)
+
+	enrollment, err := h.service.Enroll(ctx, user.ID, user.Email)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+	if err := json.NewEncoder(ctx).Encode(enrollment); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// ConfirmTOTP ativa o segundo fator TOTP com o primeiro código gerado
+// @Summary Confirma TOTP
+// @Description Ativa o TOTP com o primeiro código do aplicativo autenticador e retorna os códigos de recuperação, exibidos uma única vez, utilizar header "Authorization": "Bearer {token}"
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body mfa.ConfirmTOTP true "Código TOTP"
+// @Success 200 {object} mfa.RecoveryCodes
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /users/me/mfa/totp/confirm [post]
+func (h *MFAHandler) ConfirmTOTP(ctx *fasthttp.RequestCtx) {
+	var request mfa.ConfirmTOTP
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	codes, err := h.service.Confirm(ctx, currentUser(ctx).ID, request.Code)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(codes); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// AdminResetMFA remove o segundo fator de um usuário
+// @Summary Remove segundo fator de usuário
+// @Description Remove o TOTP e os códigos de recuperação de um usuário, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID do usuário"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/users/{id}/mfa [delete]
+func (h *MFAHandler) AdminResetMFA(ctx *fasthttp.RequestCtx) {
+	userID, err := pathID(ctx, "id")
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	if err := h.service.Reset(ctx, userID); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
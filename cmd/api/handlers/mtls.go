@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"github.com/juliovcruz/user-register/internal/security/mtls"
+	"github.com/valyala/fasthttp"
+)
+
+const currentServiceIdentityKey = "currentServiceIdentity"
+
+type MTLSHandler struct {
+	service *mtls.Service
+}
+
+func NewMTLSHandler(service *mtls.Service) *MTLSHandler {
+	return &MTLSHandler{service: service}
+}
+
+// Middleware autentica serviços pelo certificado de cliente verificado no handshake TLS e
+// repassa as conexões sem certificado para o middleware fallback
+func (h *MTLSHandler) Middleware(scope string, fallback func(fasthttp.RequestHandler) fasthttp.RequestHandler, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	withFallback := fallback(next)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		if !ctx.IsTLS() {
+			withFallback(ctx)
+			return
+		}
+
+		certificates := ctx.TLSConnectionState().PeerCertificates
+		if len(certificates) == 0 {
+			withFallback(ctx)
+			return
+		}
+
+		identity, err := h.service.Authenticate(certificates[0], scope)
+		if err != nil {
+			returnError(ctx, err)
+			return
+		}
+
+		ctx.SetUserValue(currentServiceIdentityKey, identity)
+		next(ctx)
+	}
+}
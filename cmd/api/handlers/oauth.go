@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/juliovcruz/user-register/internal/security/oauth"
+	"github.com/valyala/fasthttp"
+)
+
+const currentOAuthClaimsKey = "currentOAuthClaims"
+
+type OAuthHandler struct {
+	service *oauth.Service
+}
+
+func NewOAuthHandler(service *oauth.Service) *OAuthHandler {
+	return &OAuthHandler{service: service}
+}
+
+// Middleware aceita access tokens emitidos pelo servidor OAuth com o escopo exigido e
+// repassa os demais tokens para o middleware fallback
+func (h *OAuthHandler) Middleware(scope string, fallback func(fasthttp.RequestHandler) fasthttp.RequestHandler, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	withFallback := fallback(next)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		raw, found := strings.CutPrefix(string(ctx.Request.Header.Peek("Authorization")), "Bearer ")
+		if !found {
+			withFallback(ctx)
+			return
+		}
+
+		claims, err := h.service.Authenticate(ctx, raw, scope)
+		if errors.Is(err, oauth.ErrInvalidToken) {
+			withFallback(ctx)
+			return
+		}
+		if err != nil {
+			returnError(ctx, err)
+			return
+		}
+
+		ctx.SetUserValue(currentOAuthClaimsKey, claims)
+		next(ctx)
+	}
+}
+
+// Authorize inicia o fluxo authorization code
+// @Summary Autorização OAuth
+// @Description Valida o pedido de autorização (PKCE S256 obrigatório) do usuário autenticado. Redireciona para a redirect_uri com o código quando o usuário já consentiu com os escopos, senão retorna os dados para a tela de consentimento, utilizar header "Authorization": "Bearer {token}"
+// @Tags oauth
+// @Produce json
+// @Param response_type query string true "code"
+// @Param client_id query string true "ID do cliente"
+// @Param redirect_uri query string false "URI de retorno registrada"
+// @Param scope query string false "Escopos separados por espaço"
+// @Param state query string false "Valor devolvido ao cliente"
+// @Param code_challenge query string true "BASE64URL(SHA256(code_verifier))"
+// @Param code_challenge_method query string true "S256"
+// @Param nonce query string false "Valor repetido no ID token do OpenID Connect"
+// @Success 200 {object} oauth.AuthorizeResult
+// @Success 302
+// @Failure 400 {object} oauth.Error
+// @Failure 401 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /oauth/authorize [get]
+func (h *OAuthHandler) Authorize(ctx *fasthttp.RequestCtx) {
+	args := ctx.QueryArgs()
+	request := oauth.AuthorizeRequest{
+		ResponseType:        string(args.Peek("response_type")),
+		ClientID:            string(args.Peek("client_id")),
+		RedirectURI:         string(args.Peek("redirect_uri")),
+		Scope:               string(args.Peek("scope")),
+		State:               string(args.Peek("state")),
+		CodeChallenge:       string(args.Peek("code_challenge")),
+		CodeChallengeMethod: string(args.Peek("code_challenge_method")),
+		Nonce:               string(args.Peek("nonce")),
+	}
+
+	result, err := h.service.Authorize(ctx, currentUser(ctx), request)
+	returnAuthorizeResult(ctx, result, err)
+}
+
+// Consent registra o consentimento do usuário
+// @Summary Consentimento OAuth
+// @Description Recebe os mesmos parâmetros da autorização e a decisão do usuário. Aprovado, registra o consentimento e redireciona com o código; negado, redireciona com access_denied, utilizar header "Authorization": "Bearer {token}"
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param consent body oauth.ConsentDecision true "Pedido de autorização e decisão"
+// @Success 302
+// @Failure 400 {object} oauth.Error
+// @Failure 401 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /oauth/authorize [post]
+func (h *OAuthHandler) Consent(ctx *fasthttp.RequestCtx) {
+	var request oauth.ConsentDecision
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	result, err := h.service.Consent(ctx, currentUser(ctx), request.AuthorizeRequest, request.Approved)
+	returnAuthorizeResult(ctx, result, err)
+}
+
+func returnAuthorizeResult(ctx *fasthttp.RequestCtx, result oauth.AuthorizeResult, err error) {
+	if err != nil {
+		returnOAuthError(ctx, err)
+		return
+	}
+
+	if result.RedirectURL != "" {
+		ctx.Response.Header.Set("Location", result.RedirectURL)
+		ctx.SetStatusCode(fasthttp.StatusFound)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(result); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// Token emite tokens OAuth
+// @Summary Token OAuth
+// @Description Emite access tokens para os grants authorization_code, refresh_token e client_credentials. Clientes confidenciais se autenticam com HTTP Basic ou client_id e client_secret no corpo
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token ou client_credentials"
+// @Param client_id formData string false "ID do cliente"
+// @Param client_secret formData string false "Segredo do cliente"
+// @Param code formData string false "Código de autorização"
+// @Param redirect_uri formData string false "URI usada na autorização"
+// @Param code_verifier formData string false "Verificador PKCE"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Escopos separados por espaço"
+// @Success 200 {object} oauth.TokenResponse
+// @Failure 400 {object} oauth.Error
+// @Failure 401 {object} oauth.Error
+// @Failure 500 {object} Problem
+// @Router /oauth/token [post]
+func (h *OAuthHandler) Token(ctx *fasthttp.RequestCtx) {
+	args := ctx.PostArgs()
+	request := oauth.TokenRequest{
+		GrantType:    string(args.Peek("grant_type")),
+		ClientID:     string(args.Peek("client_id")),
+		ClientSecret: string(args.Peek("client_secret")),
+		Code:         string(args.Peek("code")),
+		RedirectURI:  string(args.Peek("redirect_uri")),
+		CodeVerifier: string(args.Peek("code_verifier")),
+		RefreshToken: string(args.Peek("refresh_token")),
+		Scope:        string(args.Peek("scope")),
+	}
+
+	basic := false
+	if clientID, clientSecret, found := basicAuth(ctx); found {
+		request.ClientID, request.ClientSecret, basic = clientID, clientSecret, true
+	}
+
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.Response.Header.Set("Pragma", "no-cache")
+
+	response, err := h.service.Token(ctx, request)
+	if err != nil {
+		var oauthErr *oauth.Error
+		if basic && errors.As(err, &oauthErr) && oauthErr.Status == fasthttp.StatusUnauthorized {
+			ctx.Response.Header.Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+
+		returnOAuthError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(response); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// basicAuth lê as credenciais do cliente, que a RFC 6749 manda codificar como form antes do base64
+func basicAuth(ctx *fasthttp.RequestCtx) (string, string, bool) {
+	encoded, found := strings.CutPrefix(string(ctx.Request.Header.Peek("Authorization")), "Basic ")
+	if !found {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+
+	rawID, rawSecret, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", false
+	}
+
+	clientID, errID := url.QueryUnescape(rawID)
+	clientSecret, errSecret := url.QueryUnescape(rawSecret)
+	if errID != nil || errSecret != nil {
+		return "", "", false
+	}
+
+	return clientID, clientSecret, true
+}
+
+func returnOAuthError(ctx *fasthttp.RequestCtx, err error) {
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(oauthErr.Status)
+	if err := json.NewEncoder(ctx).Encode(oauthErr); err != nil {
+		ctx.Error("failed to encode response", fasthttp.StatusInternalServerError)
+	}
+}
+
+// CreateOAuthClient cadastra um cliente OAuth
+// @Summary Cadastra cliente OAuth
+// @Description Cadastra um cliente OAuth com redirect URIs, grants e escopos permitidos. O client_secret de clientes confidenciais só é exibido nesta resposta, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param client body oauth.CreateClient true "Cliente OAuth"
+// @Success 201 {object} oauth.CreatedClient
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/oauth/clients [post]
+func (h *OAuthHandler) CreateOAuthClient(ctx *fasthttp.RequestCtx) {
+	var request oauth.CreateClient
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	client, err := h.service.CreateClient(ctx, request)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+	if err := json.NewEncoder(ctx).Encode(client); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// ListOAuthClients lista os clientes OAuth
+// @Summary Lista clientes OAuth
+// @Description Lista os clientes OAuth cadastrados, sem os segredos, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200 {array} oauth.Client
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/oauth/clients [get]
+func (h *OAuthHandler) ListOAuthClients(ctx *fasthttp.RequestCtx) {
+	clients, err := h.service.ListClients(ctx)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(clients); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// DeleteOAuthClient remove um cliente OAuth
+// @Summary Remove cliente OAuth
+// @Description Remove um cliente OAuth e revoga os refresh tokens emitidos para ele, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "ID do cliente"
+// @Success 204
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/oauth/clients/{id} [delete]
+func (h *OAuthHandler) DeleteOAuthClient(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+
+	if err := h.service.DeleteClient(ctx, id); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/juliovcruz/user-register/internal/security/oauth"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+const redirectURI = "https://app.example.com/callback"
+
+// oauthTestClient faz o papel de uma aplicação cliente que usa este serviço como provedor de identidade
+type oauthTestClient struct {
+	server *testServer
+	client oauth.CreatedClient
+}
+
+func (c *oauthTestClient) token(values url.Values) (oauth.TokenResponse, response) {
+	resp := c.server.request("POST", "/oauth/token", values.Encode(), map[string]string{
+		"Content-Type":  "application/x-www-form-urlencoded",
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(c.client.ID+":"+c.client.Secret)),
+	})
+
+	var tokenResponse oauth.TokenResponse
+	if resp.statusCode == fasthttp.StatusOK {
+		require.NoError(c.server.t, json.Unmarshal([]byte(resp.body), &tokenResponse))
+	}
+	return tokenResponse, resp
+}
+
+func authorizeQuery(clientID, challenge string) string {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {oauth.ScopeUsersRead},
+		"state":                 {"xyz"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestOAuthHandler_AuthorizationCodeWithPKCE(t *testing.T) {
+	server := newTestServer(t)
+
+	created := server.do("POST", "/users", `{"name":"User Name","email":"user@example.com","password":"correct-horse-battery","confirm_password":"correct-horse-battery","zip_code":"74360400"}`)
+	require.Equal(t, fasthttp.StatusCreated, created.statusCode)
+
+	login := server.do("POST", "/login", `{"email":"user@example.com","password":"correct-horse-battery"}`)
+	require.Equal(t, fasthttp.StatusOK, login.statusCode)
+
+	var loginResponse LoginResponse
+	require.NoError(t, json.Unmarshal([]byte(login.body), &loginResponse))
+
+	registered, err := server.oauthService.CreateClient(context.Background(), oauth.CreateClient{
+		Name:         "Billing",
+		RedirectURIs: []string{redirectURI},
+		GrantTypes:   []oauth.GrantType{oauth.GrantAuthorizationCode, oauth.GrantRefreshToken},
+		Scopes:       []string{oauth.ScopeUsersRead},
+		Confidential: true,
+	})
+	require.NoError(t, err)
+	client := &oauthTestClient{server: server, client: registered}
+
+	verifier := strings.Repeat("verifier", 6)
+	query := authorizeQuery(registered.ID, codeChallenge(verifier))
+
+	consent := server.do("GET", "/oauth/authorize?"+query, "", loginResponse.Token)
+	require.Equal(t, fasthttp.StatusOK, consent.statusCode)
+	require.Contains(t, consent.body, `"consent_required":true`)
+
+	decision, err := json.Marshal(oauth.ConsentDecision{
+		AuthorizeRequest: oauth.AuthorizeRequest{
+			ResponseType:        "code",
+			ClientID:            registered.ID,
+			RedirectURI:         redirectURI,
+			Scope:               oauth.ScopeUsersRead,
+			State:               "xyz",
+			CodeChallenge:       codeChallenge(verifier),
+			CodeChallengeMethod: "S256",
+		},
+		Approved: true,
+	})
+	require.NoError(t, err)
+
+	approved := server.do("POST", "/oauth/authorize", string(decision), loginResponse.Token)
+	require.Equal(t, fasthttp.StatusFound, approved.statusCode)
+
+	location, err := url.Parse(approved.location)
+	require.NoError(t, err)
+	require.Equal(t, "xyz", location.Query().Get("state"))
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	exchange := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {redirectURI}, "code_verifier": {verifier}}
+	tokens, resp := client.token(exchange)
+	require.Equal(t, fasthttp.StatusOK, resp.statusCode)
+	require.Equal(t, oauth.ScopeUsersRead, tokens.Scope)
+	require.NotEmpty(t, tokens.RefreshToken)
+
+	require.Equal(t, fasthttp.StatusOK, server.do("GET", "/users", "", tokens.AccessToken).statusCode)
+	require.Equal(t, fasthttp.StatusUnauthorized, server.do("GET", "/users/me/sessions", "", tokens.AccessToken).statusCode)
+
+	// com o consentimento já dado, a autorização redireciona direto com um novo código
+	authorizeCode := func(t *testing.T, query string) string {
+		resp := server.do("GET", "/oauth/authorize?"+query, "", loginResponse.Token)
+		require.Equal(t, fasthttp.StatusFound, resp.statusCode)
+
+		location, err := url.Parse(resp.location)
+		require.NoError(t, err)
+		return location.Query().Get("code")
+	}
+
+	t.Run("Consent is remembered and a wrong verifier is rejected", func(t *testing.T) {
+		_, resp := client.token(url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {authorizeCode(t, query)},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {strings.Repeat("attacker", 6)},
+		})
+		require.Equal(t, fasthttp.StatusBadRequest, resp.statusCode)
+	})
+
+	t.Run("Refresh tokens rotate and reuse revokes the family", func(t *testing.T) {
+		refreshed, resp := client.token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}})
+		require.Equal(t, fasthttp.StatusOK, resp.statusCode)
+		require.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+		_, replayed := client.token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}})
+		require.Equal(t, fasthttp.StatusBadRequest, replayed.statusCode)
+
+		_, revoked := client.token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshed.RefreshToken}})
+		require.Equal(t, fasthttp.StatusBadRequest, revoked.statusCode)
+	})
+
+	t.Run("Reused code revokes the tokens issued from it", func(t *testing.T) {
+		exchange := url.Values{"grant_type": {"authorization_code"}, "code": {authorizeCode(t, query)}, "redirect_uri": {redirectURI}, "code_verifier": {verifier}}
+		issued, resp := client.token(exchange)
+		require.Equal(t, fasthttp.StatusOK, resp.statusCode)
+		require.Equal(t, fasthttp.StatusOK, server.do("GET", "/users", "", issued.AccessToken).statusCode)
+
+		_, reused := client.token(exchange)
+		require.Equal(t, fasthttp.StatusBadRequest, reused.statusCode)
+		require.Contains(t, reused.body, `"error":"invalid_grant"`)
+
+		require.Equal(t, fasthttp.StatusUnauthorized, server.do("GET", "/users", "", issued.AccessToken).statusCode)
+		_, refreshed := client.token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {issued.RefreshToken}})
+		require.Equal(t, fasthttp.StatusBadRequest, refreshed.statusCode)
+
+		// tokens de outras autorizações do mesmo usuário continuam valendo
+		require.Equal(t, fasthttp.StatusOK, server.do("GET", "/users", "", tokens.AccessToken).statusCode)
+	})
+
+	t.Run("Redirect uri sent at authorization is required", func(t *testing.T) {
+		_, resp := client.token(url.Values{"grant_type": {"authorization_code"}, "code": {authorizeCode(t, query)}, "code_verifier": {verifier}})
+		require.Equal(t, fasthttp.StatusBadRequest, resp.statusCode)
+		require.Contains(t, resp.body, `"error":"invalid_grant"`)
+
+		_, resp = client.token(url.Values{"grant_type": {"authorization_code"}, "code": {authorizeCode(t, query)}, "redirect_uri": {redirectURI + "?tenant=1"}, "code_verifier": {verifier}})
+		require.Equal(t, fasthttp.StatusBadRequest, resp.statusCode)
+	})
+
+	t.Run("Redirect uri omitted at authorization can be omitted", func(t *testing.T) {
+		omitted := strings.Replace(query, "redirect_uri="+url.QueryEscape(redirectURI)+"&", "", 1)
+		require.NotEqual(t, query, omitted)
+
+		_, resp := client.token(url.Values{"grant_type": {"authorization_code"}, "code": {authorizeCode(t, omitted)}, "code_verifier": {verifier}})
+		require.Equal(t, fasthttp.StatusOK, resp.statusCode)
+	})
+
+	t.Run("Unregistered redirect uri is not redirected", func(t *testing.T) {
+		resp := server.do("GET", "/oauth/authorize?"+strings.Replace(query, "app.example.com", "evil.example.com", 1), "", loginResponse.Token)
+		require.Equal(t, fasthttp.StatusBadRequest, resp.statusCode)
+		require.Empty(t, resp.location)
+	})
+
+	// o dono do recurso só se autentica pelo header Authorization, não há sessão por cookie
+	// que um navegador seguindo o redirecionamento do cliente possa enviar
+	t.Run("Browser redirects without the bearer token are not authorized", func(t *testing.T) {
+		resp := server.request("GET", "/oauth/authorize?"+query, "", map[string]string{"Cookie": "token=" + loginResponse.Token})
+		require.Equal(t, fasthttp.StatusUnauthorized, resp.statusCode)
+		require.Empty(t, resp.location)
+	})
+}
+
+func TestOAuthHandler_ClientCredentials(t *testing.T) {
+	server := newTestServer(t)
+
+	registered, err := server.oauthService.CreateClient(context.Background(), oauth.CreateClient{
+		Name:         "Reports",
+		GrantTypes:   []oauth.GrantType{oauth.GrantClientCredentials},
+		Scopes:       []string{oauth.ScopeUsersRead},
+		Confidential: true,
+	})
+	require.NoError(t, err)
+	client := &oauthTestClient{server: server, client: registered}
+
+	tokens, resp := client.token(url.Values{"grant_type": {"client_credentials"}})
+	require.Equal(t, fasthttp.StatusOK, resp.statusCode)
+	require.Empty(t, tokens.RefreshToken)
+	require.Equal(t, fasthttp.StatusOK, server.do("GET", "/users", "", tokens.AccessToken).statusCode)
+
+	_, unauthorized := client.token(url.Values{"grant_type": {"authorization_code"}, "code": {"code"}})
+	require.Equal(t, fasthttp.StatusBadRequest, unauthorized.statusCode)
+	require.Contains(t, unauthorized.body, `"error":"unauthorized_client"`)
+
+	client.client.Secret = "wrong"
+	_, invalid := client.token(url.Values{"grant_type": {"client_credentials"}})
+	require.Equal(t, fasthttp.StatusUnauthorized, invalid.statusCode)
+	require.Contains(t, invalid.body, `"error":"invalid_client"`)
+
+	require.NoError(t, server.oauthService.DeleteClient(context.Background(), registered.ID))
+	require.Equal(t, fasthttp.StatusUnauthorized, server.do("GET", "/users", "", tokens.AccessToken).statusCode)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/juliovcruz/user-register/internal/security/oauth"
+	"github.com/juliovcruz/user-register/internal/security/oidc"
+	"github.com/valyala/fasthttp"
+)
+
+type OIDCHandler struct {
+	service      *oidc.Service
+	oauthService *oauth.Service
+}
+
+func NewOIDCHandler(service *oidc.Service, oauthService *oauth.Service) *OIDCHandler {
+	return &OIDCHandler{service: service, oauthService: oauthService}
+}
+
+// Discovery publica a configuração do provedor OpenID Connect
+// @Summary Configuração OpenID Connect
+// @Description Documento de descoberta com endpoints, escopos e algoritmos suportados
+// @Tags oauth
+// @Produce json
+// @Success 200 {object} oidc.Discovery
+// @Router /.well-known/openid-configuration [get]
+func (h *OIDCHandler) Discovery(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(h.service.Discovery()); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// JWKS publica as chaves públicas dos ID tokens
+// @Summary Chaves públicas OpenID Connect
+// @Description Chaves usadas para validar a assinatura dos ID tokens
+// @Tags oauth
+// @Produce json
+// @Success 200 {object} oidc.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *OIDCHandler) JWKS(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(h.service.JWKS()); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// UserInfo retorna as claims do usuário autenticado via OAuth
+// @Summary UserInfo OpenID Connect
+// @Description Retorna as claims liberadas pelos escopos do access token, que precisa do escopo openid, utilizar header "Authorization": "Bearer {access_token}"
+// @Tags oauth
+// @Produce json
+// @Success 200 {object} oidc.UserInfo
+// @Failure 401 {object} oauth.Error
+// @Failure 403 {object} oauth.Error
+// @Failure 500 {object} Problem
+// @Router /userinfo [get]
+func (h *OIDCHandler) UserInfo(ctx *fasthttp.RequestCtx) {
+	raw, found := strings.CutPrefix(string(ctx.Request.Header.Peek("Authorization")), "Bearer ")
+	if !found {
+		returnBearerError(ctx, fasthttp.StatusUnauthorized, "invalid_request")
+		return
+	}
+
+	claims, err := h.oauthService.Authenticate(ctx, raw, oauth.ScopeOpenID)
+	if err != nil {
+		switch {
+		case errors.Is(err, oauth.ErrInvalidToken):
+			returnBearerError(ctx, fasthttp.StatusUnauthorized, "invalid_token")
+		case errors.Is(err, oauth.ErrInsufficientScope):
+			returnBearerError(ctx, fasthttp.StatusForbidden, "insufficient_scope")
+		default:
+			returnError(ctx, err)
+		}
+		return
+	}
+
+	info, err := h.service.UserInfo(ctx, claims)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidSubject) {
+			returnBearerError(ctx, fasthttp.StatusUnauthorized, "invalid_token")
+			return
+		}
+
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if err := json.NewEncoder(ctx).Encode(info); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// returnBearerError responde no formato da RFC 6750, com o erro também no WWW-Authenticate
+func returnBearerError(ctx *fasthttp.RequestCtx, statusCode int, code string) {
+	ctx.Response.Header.Set("WWW-Authenticate", `Bearer error="`+code+`"`)
+	returnOAuthError(ctx, &oauth.Error{Code: code, Status: statusCode})
+}
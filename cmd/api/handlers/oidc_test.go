@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/juliovcruz/user-register/internal/security/oauth"
+	"github.com/juliovcruz/user-register/internal/security/oidc"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// verifyIDToken valida o ID token como um cliente faria, com a chave obtida do jwks_uri
+func verifyIDToken(t *testing.T, server *testServer, idToken string) jwt.MapClaims {
+	resp := server.do("GET", "/.well-known/jwks.json", "")
+	require.Equal(t, fasthttp.StatusOK, resp.statusCode)
+
+	var jwks oidc.JWKS
+	require.NoError(t, json.Unmarshal([]byte(resp.body), &jwks))
+	require.Len(t, jwks.Keys, 1)
+
+	n, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].N)
+	require.NoError(t, err)
+	e, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].E)
+	require.NoError(t, err)
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		require.Equal(t, jwks.Keys[0].KeyID, token.Header["kid"])
+		return key, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "RS256", token.Method.Alg())
+
+	return token.Claims.(jwt.MapClaims)
+}
+
+func TestOIDCHandler_IDTokenAndUserInfo(t *testing.T) {
+	server := newTestServer(t)
+
+	discovery := server.do("GET", "/.well-known/openid-configuration", "")
+	require.Equal(t, fasthttp.StatusOK, discovery.statusCode)
+
+	var configuration oidc.Discovery
+	require.NoError(t, json.Unmarshal([]byte(discovery.body), &configuration))
+	require.Equal(t, "http://localhost", configuration.Issuer)
+	require.Equal(t, "http://localhost/userinfo", configuration.UserInfoEndpoint)
+	require.Contains(t, configuration.ScopesSupported, oauth.ScopeOpenID)
+
+	created := server.do("POST", "/users", `{"name":"User Name","email":"user@example.com","password":"correct-horse-battery","confirm_password":"correct-horse-battery","zip_code":"74360400"}`)
+	require.Equal(t, fasthttp.StatusCreated, created.statusCode)
+
+	login := server.do("POST", "/login", `{"email":"user@example.com","password":"correct-horse-battery"}`)
+	require.Equal(t, fasthttp.StatusOK, login.statusCode)
+
+	var loginResponse LoginResponse
+	require.NoError(t, json.Unmarshal([]byte(login.body), &loginResponse))
+
+	registered, err := server.oauthService.CreateClient(context.Background(), oauth.CreateClient{
+		Name:         "Internal App",
+		RedirectURIs: []string{redirectURI},
+		GrantTypes:   []oauth.GrantType{oauth.GrantAuthorizationCode, oauth.GrantRefreshToken},
+		Scopes:       []string{oauth.ScopeOpenID, oauth.ScopeProfile, oauth.ScopeEmail, oauth.ScopeAddress},
+		Confidential: true,
+	})
+	require.NoError(t, err)
+	client := &oauthTestClient{server: server, client: registered}
+
+	verifier := strings.Repeat("verifier", 6)
+	decision, err := json.Marshal(oauth.ConsentDecision{
+		AuthorizeRequest: oauth.AuthorizeRequest{
+			ResponseType:        "code",
+			ClientID:            registered.ID,
+			RedirectURI:         redirectURI,
+			Scope:               "openid profile email address",
+			CodeChallenge:       codeChallenge(verifier),
+			CodeChallengeMethod: "S256",
+			Nonce:               "n-0S6_WzA2Mj",
+		},
+		Approved: true,
+	})
+	require.NoError(t, err)
+
+	approved := server.do("POST", "/oauth/authorize", string(decision), loginResponse.Token)
+	require.Equal(t, fasthttp.StatusFound, approved.statusCode)
+
+	location, err := url.Parse(approved.location)
+	require.NoError(t, err)
+
+	tokens, resp := client.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+	require.Equal(t, fasthttp.StatusOK, resp.statusCode)
+	require.NotEmpty(t, tokens.IDToken)
+
+	claims := verifyIDToken(t, server, tokens.IDToken)
+	require.Equal(t, "http://localhost", claims["iss"])
+	require.Equal(t, registered.ID, claims["aud"])
+	require.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	require.Equal(t, "user@example.com", claims["email"])
+	require.Equal(t, false, claims["email_verified"])
+	require.NotZero(t, claims["auth_time"])
+
+	userInfo := server.do("GET", "/userinfo", "", tokens.AccessToken)
+	require.Equal(t, fasthttp.StatusOK, userInfo.statusCode)
+
+	var info oidc.UserInfo
+	require.NoError(t, json.Unmarshal([]byte(userInfo.body), &info))
+	require.Equal(t, claims["sub"], info.Subject)
+	require.Equal(t, "User Name", info.Name)
+	require.Equal(t, "74360400", info.Address.PostalCode)
+
+	t.Run("Refresh keeps auth_time and drops the nonce", func(t *testing.T) {
+		refreshed, resp := client.token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}, "scope": {"openid email"}})
+		require.Equal(t, fasthttp.StatusOK, resp.statusCode)
+
+		refreshedClaims := verifyIDToken(t, server, refreshed.IDToken)
+		require.Equal(t, claims["auth_time"], refreshedClaims["auth_time"])
+		require.NotContains(t, refreshedClaims, "nonce")
+		require.NotContains(t, refreshedClaims, "name")
+
+		userInfo := server.do("GET", "/userinfo", "", refreshed.AccessToken)
+		require.Equal(t, fasthttp.StatusOK, userInfo.statusCode)
+		require.NotContains(t, userInfo.body, "User Name")
+	})
+
+	t.Run("Session tokens are not accepted", func(t *testing.T) {
+		require.Equal(t, fasthttp.StatusUnauthorized, server.do("GET", "/userinfo", "", loginResponse.Token).statusCode)
+	})
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/juliovcruz/user-register/internal/mailvalidation"
+	"github.com/juliovcruz/user-register/internal/platform/logging"
+	"github.com/juliovcruz/user-register/internal/platform/tracing"
+	"github.com/juliovcruz/user-register/internal/security/apikey"
+	"github.com/juliovcruz/user-register/internal/security/lockout"
+	"github.com/juliovcruz/user-register/internal/security/mtls"
+	"github.com/juliovcruz/user-register/internal/security/oauth"
+	"github.com/juliovcruz/user-register/internal/users"
+	"github.com/juliovcruz/user-register/internal/users/mfa"
+	"github.com/juliovcruz/user-register/internal/users/normalization"
+	"github.com/juliovcruz/user-register/internal/users/password"
+	"github.com/juliovcruz/user-register/internal/users/registration"
+	"github.com/juliovcruz/user-register/internal/users/zipcode"
+	"github.com/valyala/fasthttp"
+)
+
+// problemTypePrefix forma o type de cada problema; o código depois do prefixo é estável e
+// é o que os clientes devem comparar, nunca a mensagem
+const problemTypePrefix = "urn:user-register:problem:"
+
+const problemContentType = "application/problem+json"
+
+var (
+	errInvalidRequest        = errors.New("invalid request body")
+	errInvalidID             = errors.New("invalid id")
+	errInvalidPagination     = errors.New("invalid limit or offset")
+	errAuthorizationRequired = errors.New("authorization header required")
+	errInvalidToken          = errors.New("invalid token")
+	errAdminRequired         = errors.New("admin role required")
+	errInvalidMetricsToken   = errors.New("invalid metrics token")
+	errCORSNotAllowed        = errors.New("cross-origin request not allowed")
+)
+
+// Problem é o corpo de erro da API no formato da RFC 7807 (application/problem+json)
+type Problem struct {
+	Type       string               `json:"type"`
+	Title      string               `json:"title"`
+	Status     int                  `json:"status"`
+	Detail     string               `json:"detail"`
+	Instance   string               `json:"instance,omitempty"`
+	Code       string               `json:"code"`
+	TraceID    string               `json:"trace_id,omitempty"`
+	RequestID  string               `json:"request_id,omitempty"`
+	Violations []password.Violation `json:"violations,omitempty"`
+	Errors     []FieldError         `json:"errors,omitempty"`
+}
+
+type problemMapping struct {
+	err    error
+	status int
+	code   string
+	// detail substitui a mensagem do erro, quando definido
+	detail string
+}
+
+// problemMappings traduz os erros de domínio para status e código. Erros fora da lista
+// respondem 500 com uma mensagem genérica, para que detalhes internos não vazem
+var problemMappings = []problemMapping{
+	{err: errInvalidRequest, status: fasthttp.StatusBadRequest, code: "invalid_request"},
+	{err: errInvalidID, status: fasthttp.StatusBadRequest, code: "invalid_id"},
+	{err: errInvalidPagination, status: fasthttp.StatusBadRequest, code: "invalid_pagination"},
+	{err: errAuthorizationRequired, status: fasthttp.StatusUnauthorized, code: "authorization_required"},
+	{err: errInvalidToken, status: fasthttp.StatusUnauthorized, code: "invalid_token"},
+	{err: errAdminRequired, status: fasthttp.StatusForbidden, code: "admin_required"},
+	{err: errInvalidMetricsToken, status: fasthttp.StatusUnauthorized, code: "invalid_metrics_token"},
+	{err: errCORSNotAllowed, status: fasthttp.StatusForbidden, code: "cors_not_allowed"},
+
+	{err: users.ErrNotFound, status: fasthttp.StatusNotFound, code: "user_not_found"},
+	{err: users.ErrUserNotFound, status: fasthttp.StatusNotFound, code: "user_not_found"},
+	{err: users.ErrBadRequest, status: fasthttp.StatusBadRequest, code: "bad_request"},
+	{err: users.ErrMailAlreadyExists, status: fasthttp.StatusConflict, code: "email_already_exists"},
+	{err: users.ErrPasswordMismatch, status: fasthttp.StatusBadRequest, code: "password_mismatch"},
+	{err: users.ErrInvalidLogin, status: fasthttp.StatusUnauthorized, code: "invalid_credentials"},
+	{err: users.ErrSameEmail, status: fasthttp.StatusBadRequest, code: "same_email"},
+	{err: users.ErrEmailChangeNotFound, status: fasthttp.StatusBadRequest, code: "email_change_not_found"},
+	{err: users.ErrSessionRevoked, status: fasthttp.StatusUnauthorized, code: "session_revoked"},
+	{err: users.ErrSessionNotFound, status: fasthttp.StatusNotFound, code: "session_not_found"},
+	{err: users.ErrInvalidMFAChallenge, status: fasthttp.StatusUnauthorized, code: "invalid_mfa_challenge"},
+	{err: users.ErrInvalidMFACode, status: fasthttp.StatusUnauthorized, code: "invalid_mfa_code"},
+	{err: users.ErrInvalidPassword, status: fasthttp.StatusBadRequest, code: "invalid_current_password"},
+	{err: normalization.ErrInvalidEmail, status: fasthttp.StatusBadRequest, code: "invalid_email"},
+
+	{err: mailvalidation.ErrRecordNotFound, status: fasthttp.StatusBadRequest, code: "code_not_found", detail: "no validation code was sent to this email"},
+	{err: mailvalidation.ErrInvalidCode, status: fasthttp.StatusBadRequest, code: "invalid_code"},
+	{err: mailvalidation.ErrCodeAlreadySent, status: fasthttp.StatusTooManyRequests, code: "code_already_sent"},
+	{err: mailvalidation.ErrCodeExpired, status: fasthttp.StatusBadRequest, code: "code_expired"},
+	{err: mailvalidation.ErrInvalidLink, status: fasthttp.StatusBadRequest, code: "invalid_link"},
+	{err: mailvalidation.ErrLinkExpired, status: fasthttp.StatusBadRequest, code: "link_expired"},
+	{err: mailvalidation.ErrLinkAlreadyUsed, status: fasthttp.StatusBadRequest, code: "link_already_used"},
+
+	{err: zipcode.ErrInvalidZipCode, status: fasthttp.StatusBadRequest, code: "invalid_zip_code"},
+	{err: zipcode.ErrZipCodeNotFound, status: fasthttp.StatusUnprocessableEntity, code: "zip_code_not_found"},
+
+	{err: registration.ErrInvalidRule, status: fasthttp.StatusBadRequest, code: "invalid_rule"},
+	{err: registration.ErrInvalidDomain, status: fasthttp.StatusBadRequest, code: "invalid_domain"},
+	{err: registration.ErrRuleNotFound, status: fasthttp.StatusNotFound, code: "rule_not_found"},
+
+	{err: mfa.ErrNotEnrolled, status: fasthttp.StatusBadRequest, code: "mfa_not_enrolled"},
+	{err: mfa.ErrAlreadyEnabled, status: fasthttp.StatusConflict, code: "mfa_already_enabled"},
+	{err: mfa.ErrInvalidCode, status: fasthttp.StatusBadRequest, code: "invalid_mfa_code"},
+
+	{err: apikey.ErrInvalidKey, status: fasthttp.StatusUnauthorized, code: "invalid_api_key"},
+	{err: apikey.ErrInsufficientScope, status: fasthttp.StatusForbidden, code: "insufficient_scope"},
+	{err: apikey.ErrInvalidScope, status: fasthttp.StatusBadRequest, code: "invalid_scope"},
+	{err: apikey.ErrKeyNotFound, status: fasthttp.StatusNotFound, code: "api_key_not_found"},
+	{err: apikey.ErrInvalidExpiration, status: fasthttp.StatusBadRequest, code: "invalid_expiration"},
+
+	{err: oauth.ErrInvalidClient, status: fasthttp.StatusBadRequest, code: "invalid_client"},
+	{err: oauth.ErrClientNotFound, status: fasthttp.StatusNotFound, code: "client_not_found"},
+	{err: oauth.ErrInsufficientScope, status: fasthttp.StatusForbidden, code: "insufficient_scope"},
+
+	{err: mtls.ErrUnknownIdentity, status: fasthttp.StatusUnauthorized, code: "unknown_service_identity"},
+	{err: mtls.ErrInsufficientScope, status: fasthttp.StatusForbidden, code: "insufficient_scope"},
+}
+
+func newProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   problemTypePrefix + code,
+		Title:  fasthttp.StatusMessage(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// problemFor escolhe o problema de err: primeiro os erros com dados próprios, depois a
+// tabela de erros de domínio e, por fim, o erro interno genérico
+func problemFor(err error) Problem {
+	var registrationErr *registration.PolicyError
+	var passwordErr *password.PolicyError
+	var lockedErr *lockout.LockedError
+
+	switch {
+	case errors.As(err, &registrationErr):
+		return newProblem(fasthttp.StatusUnprocessableEntity, registrationErr.Code, registrationErr.Message)
+	case errors.As(err, &passwordErr):
+		problem := newProblem(fasthttp.StatusUnprocessableEntity, "weak_password", passwordErr.Error())
+		problem.Violations = passwordErr.Violations
+		return problem
+	case errors.As(err, &lockedErr):
+		return newProblem(fasthttp.StatusTooManyRequests, "account_locked", lockedErr.Error())
+	}
+
+	for _, mapping := range problemMappings {
+		if errors.Is(err, mapping.err) {
+			detail := mapping.detail
+			if detail == "" {
+				detail = mapping.err.Error()
+			}
+			return newProblem(mapping.status, mapping.code, detail)
+		}
+	}
+
+	return newProblem(fasthttp.StatusInternalServerError, "internal_error", "an unexpected error occurred")
+}
+
+// returnError responde err como application/problem+json. Erros internos são registrados
+// no log com a mensagem completa e chegam ao cliente apenas com o trace ID
+func returnError(ctx *fasthttp.RequestCtx, err error) {
+	var problem Problem
+	var validationErr validationError
+	if errors.As(err, &validationErr) {
+		problem = validationProblem(ctx, validationErr)
+	} else {
+		problem = problemFor(err)
+	}
+	problem.Instance = string(ctx.Path())
+	problem.TraceID = tracing.TraceID(ctx)
+	problem.RequestID = logging.RequestID(ctx)
+
+	if problem.Status >= fasthttp.StatusInternalServerError {
+		logging.FromContext(ctx).ErrorContext(ctx, "request failed", "error", err, "trace_id", problem.TraceID)
+	}
+
+	var lockedErr *lockout.LockedError
+	if errors.As(err, &lockedErr) {
+		ctx.Response.Header.Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+	}
+
+	ctx.SetStatusCode(problem.Status)
+	ctx.SetContentType(problemContentType)
+	if err := json.NewEncoder(ctx).Encode(problem); err != nil {
+		ctx.Error("failed to encode response", fasthttp.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/platform/tracing"
+	"github.com/juliovcruz/user-register/internal/security/lockout"
+	"github.com/juliovcruz/user-register/internal/users"
+	"github.com/juliovcruz/user-register/internal/users/password"
+	"github.com/juliovcruz/user-register/internal/users/zipcode"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{
+			name:   "wrapped domain error uses the mapped detail",
+			err:    fmt.Errorf("failed to fetch address: %w", zipcode.ErrZipCodeNotFound),
+			status: fasthttp.StatusUnprocessableEntity,
+			code:   "zip_code_not_found",
+			detail: "zip code not found",
+		},
+		{
+			name:   "conflict",
+			err:    users.ErrMailAlreadyExists,
+			status: fasthttp.StatusConflict,
+			code:   "email_already_exists",
+			detail: "mail already exists",
+		},
+		{
+			name:   "locked",
+			err:    &lockout.LockedError{RetryAfter: time.Minute},
+			status: fasthttp.StatusTooManyRequests,
+			code:   "account_locked",
+			detail: "too many failed login attempts, try again in 1m0s",
+		},
+		{
+			name:   "weak password",
+			err:    &password.PolicyError{Violations: []password.Violation{{Rule: "min_length"}}},
+			status: fasthttp.StatusUnprocessableEntity,
+			code:   "weak_password",
+		},
+		{
+			name:   "unknown error does not leak",
+			err:    fmt.Errorf("failed to create user: %w", errors.New("failed to retrieve last insert ID")),
+			status: fasthttp.StatusInternalServerError,
+			code:   "internal_error",
+			detail: "an unexpected error occurred",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := problemFor(tt.err)
+
+			require.Equal(t, tt.status, problem.Status)
+			require.Equal(t, tt.code, problem.Code)
+			require.Equal(t, problemTypePrefix+tt.code, problem.Type)
+			require.Equal(t, fasthttp.StatusMessage(tt.status), problem.Title)
+			if tt.detail != "" {
+				require.Equal(t, tt.detail, problem.Detail)
+			}
+		})
+	}
+}
+
+func TestReturnError(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	handler := tracing.Middleware(func(ctx *fasthttp.RequestCtx) {
+		returnError(ctx, &lockout.LockedError{RetryAfter: time.Millisecond * 1500})
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/login")
+	ctx.Request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler(ctx)
+
+	require.Equal(t, fasthttp.StatusTooManyRequests, ctx.Response.StatusCode())
+	require.Equal(t, problemContentType, string(ctx.Response.Header.ContentType()))
+	require.Equal(t, "2", string(ctx.Response.Header.Peek("Retry-After")))
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(ctx.Response.Body(), &problem))
+	require.Equal(t, "account_locked", problem.Code)
+	require.Equal(t, "/login", problem.Instance)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", problem.TraceID)
+}
+
+func TestUserHandler_ProblemDetails(t *testing.T) {
+	do := newTestClient(t)
+
+	body := `{"name":"User Name","email":"user@example.com","password":"correct-horse-battery","confirm_password":"correct-horse-battery","zip_code":"74360400"}`
+	require.Equal(t, fasthttp.StatusCreated, do("POST", "/users", body).statusCode)
+
+	duplicated := do("POST", "/users", body)
+	require.Equal(t, fasthttp.StatusConflict, duplicated.statusCode)
+	require.JSONEq(t, `{
+		"type": "urn:user-register:problem:email_already_exists",
+		"title": "Conflict",
+		"status": 409,
+		"detail": "mail already exists",
+		"instance": "/users",
+		"code": "email_already_exists"
+	}`, duplicated.body)
+
+	invalid := do("POST", "/login", `{`)
+	require.Equal(t, fasthttp.StatusBadRequest, invalid.statusCode)
+	require.Contains(t, invalid.body, `"code":"invalid_request"`)
+}
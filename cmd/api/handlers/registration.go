@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/juliovcruz/user-register/internal/users/registration"
+	"github.com/valyala/fasthttp"
+)
+
+type RegistrationHandler struct {
+	service *registration.Service
+}
+
+func NewRegistrationHandler(service *registration.Service) *RegistrationHandler {
+	return &RegistrationHandler{service: service}
+}
+
+// ListDomainRules lista as regras de domínio de e-mail
+// @Summary Lista regras de domínio
+// @Description Lista os domínios de e-mail permitidos e bloqueados no registro, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200 {array} registration.DomainRule
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/email_domains [get]
+func (h *RegistrationHandler) ListDomainRules(ctx *fasthttp.RequestCtx) {
+	rules, err := h.service.List(ctx)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	if err := json.NewEncoder(ctx).Encode(rules); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// CreateDomainRule cria ou atualiza uma regra de domínio de e-mail
+// @Summary Cria regra de domínio
+// @Description Permite ou bloqueia um domínio de e-mail no registro, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param rule body registration.CreateDomainRule true "Regra de domínio"
+// @Success 201 {object} registration.DomainRule
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/email_domains [post]
+func (h *RegistrationHandler) CreateDomainRule(ctx *fasthttp.RequestCtx) {
+	var request registration.CreateDomainRule
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		returnError(ctx, errInvalidRequest)
+		return
+	}
+
+	if err := validator.Struct(request); err != nil {
+		returnError(ctx, validationError{err, request})
+		return
+	}
+
+	rule, err := h.service.Create(ctx, request)
+	if err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+	if err := json.NewEncoder(ctx).Encode(rule); err != nil {
+		returnError(ctx, errors.New("failed to encode response"))
+	}
+}
+
+// DeleteDomainRule remove uma regra de domínio de e-mail
+// @Summary Remove regra de domínio
+// @Description Remove a regra de um domínio de e-mail, utilizar header "Authorization": "Bearer {token}" de um administrador
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param domain path string true "Domínio"
+// @Success 204
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /admin/email_domains/{domain} [delete]
+func (h *RegistrationHandler) DeleteDomainRule(ctx *fasthttp.RequestCtx) {
+	domain, _ := ctx.UserValue("domain").(string)
+
+	if err := h.service.Delete(ctx, domain); err != nil {
+		returnError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/valyala/fasthttp"
+)
+
+// SecurityHeadersMiddleware adiciona os headers de segurança a todas as respostas. O HSTS
+// só é enviado em conexões TLS, já que navegadores o ignoram em HTTP
+func SecurityHeadersMiddleware(settings settings.SecurityHeaders, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	var hsts string
+	if settings.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(settings.HSTSMaxAge.Seconds()))
+		if settings.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		header := &ctx.Response.Header
+		header.Set(fasthttp.HeaderXContentTypeOptions, "nosniff")
+		header.Set(fasthttp.HeaderXFrameOptions, settings.FrameOptions)
+		header.Set(fasthttp.HeaderReferrerPolicy, "no-referrer")
+
+		policy := settings.ContentSecurityPolicy
+		if strings.HasPrefix(string(ctx.Path()), "/swagger/") {
+			policy = settings.SwaggerContentSecurityPolicy
+		}
+		if policy != "" {
+			header.Set(fasthttp.HeaderContentSecurityPolicy, policy)
+		}
+
+		if hsts != "" && ctx.IsTLS() {
+			header.Set(fasthttp.HeaderStrictTransportSecurity, hsts)
+		}
+
+		next(ctx)
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/pt_BR"
+	ut "github.com/go-playground/universal-translator"
+	validatorv10 "github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	ptbrtranslations "github.com/go-playground/validator/v10/translations/pt_BR"
+	"github.com/valyala/fasthttp"
+)
+
+const validationFailedKey = "validation_failed"
+
+var validator, translator = newValidator()
+
+// FieldError descreve uma falha de validação de um campo do corpo da requisição
+type FieldError struct {
+	Field   string `json:"field" example:"email"`
+	Rule    string `json:"rule" example:"email"`
+	Param   string `json:"param,omitempty" example:""`
+	Message string `json:"message" example:"email must be a valid email address"`
+}
+
+// validationError carrega a falha do validator e o corpo validado, usado para achar o
+// nome JSON dos campos comparados pelas regras entre campos
+type validationError struct {
+	err     error
+	request any
+}
+
+func (e validationError) Error() string {
+	return "validation failed: " + e.err.Error()
+}
+
+func (e validationError) Unwrap() error {
+	return e.err
+}
+
+// newValidator cria o validator usando o nome JSON dos campos nas mensagens e registra as
+// traduções em inglês (padrão) e pt-BR
+func newValidator() (*validatorv10.Validate, *ut.UniversalTranslator) {
+	v := validatorv10.New()
+	v.RegisterTagNameFunc(jsonName)
+
+	english := en.New()
+	translator := ut.New(english, english, pt_BR.New())
+
+	enTrans, _ := translator.GetTranslator("en")
+	ptTrans, _ := translator.GetTranslator("pt_BR")
+	mustRegister(entranslations.RegisterDefaultTranslations(v, enTrans))
+	mustRegister(ptbrtranslations.RegisterDefaultTranslations(v, ptTrans))
+
+	// a tradução em pt-BR do validator não cobre fqdn
+	mustRegister(v.RegisterTranslation("fqdn", ptTrans, func(trans ut.Translator) error {
+		return trans.Add("fqdn", "{0} deve ser um nome de domínio válido", false)
+	}, func(trans ut.Translator, fe validatorv10.FieldError) string {
+		message, _ := trans.T(fe.Tag(), fe.Field())
+		return message
+	}))
+
+	mustRegister(enTrans.Add(validationFailedKey, "one or more fields are invalid", false))
+	mustRegister(ptTrans.Add(validationFailedKey, "um ou mais campos são inválidos", false))
+
+	return v, translator
+}
+
+// jsonName devolve o nome JSON do campo; vazio faz o validator usar o nome Go
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func mustRegister(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// translatorFor escolhe a tradução pelo Accept-Language, respeitando os pesos q; sem
+// idioma suportado, responde em inglês
+func translatorFor(ctx *fasthttp.RequestCtx) (ut.Translator, string) {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(string(ctx.Request.Header.Peek(fasthttp.HeaderAcceptLanguage)), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+		if tag != "" && quality > 0 {
+			languages = append(languages, language{tag: tag, quality: quality})
+		}
+	}
+	sort.SliceStable(languages, func(i, j int) bool { return languages[i].quality > languages[j].quality })
+
+	for _, language := range languages {
+		base, _, _ := strings.Cut(strings.ToLower(language.tag), "-")
+		switch base {
+		case "pt":
+			trans, _ := translator.GetTranslator("pt_BR")
+			return trans, "pt-BR"
+		case "en":
+			trans, _ := translator.GetTranslator("en")
+			return trans, "en"
+		}
+	}
+
+	return translator.GetFallback(), "en"
+}
+
+// crossFieldTags são as regras cujo param é o nome Go de outro campo da mesma struct
+var crossFieldTags = map[string]struct{}{
+	"eqfield":  {},
+	"nefield":  {},
+	"gtfield":  {},
+	"gtefield": {},
+	"ltfield":  {},
+	"ltefield": {},
+}
+
+// fieldErrors traduz cada falha do validator para o campo JSON correspondente; campos
+// aninhados usam o caminho completo, como callback_urls[0]. Nas regras entre campos o
+// campo comparado também sai pelo nome JSON, tanto no param quanto na mensagem
+func fieldErrors(err error, request any, trans ut.Translator) []FieldError {
+	var validationErrs validatorv10.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil
+	}
+
+	fields := make([]FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		param, message := fe.Param(), fe.Translate(trans)
+		if _, ok := crossFieldTags[fe.Tag()]; ok {
+			param = crossFieldParam(reflect.TypeOf(request), fe)
+			// as traduções padrão dessas regras são "{0} ... {1}" com o campo e o param
+			if translated, err := trans.T(fe.Tag(), fe.Field(), param); err == nil {
+				message = translated
+			}
+		}
+
+		fields = append(fields, FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Param:   param,
+			Message: message,
+		})
+	}
+	return fields
+}
+
+// crossFieldParam acha, seguindo o caminho Go da falha a partir do corpo validado, a struct
+// que contém o campo e devolve o nome JSON do campo comparado
+func crossFieldParam(request reflect.Type, fe validatorv10.FieldError) string {
+	parent, ok := structType(request)
+	path := strings.Split(fe.StructNamespace(), ".")
+	for _, name := range path[1 : len(path)-1] {
+		if !ok {
+			return fe.Param()
+		}
+		name, _, _ = strings.Cut(name, "[")
+		field, found := parent.FieldByName(name)
+		if !found {
+			return fe.Param()
+		}
+		parent, ok = structType(field.Type)
+	}
+
+	if !ok {
+		return fe.Param()
+	}
+	field, found := parent.FieldByName(fe.Param())
+	if !found {
+		return fe.Param()
+	}
+	if name := jsonName(field); name != "" {
+		return name
+	}
+	return fe.Param()
+}
+
+// structType desce por ponteiros, slices e mapas até a struct dos elementos
+func structType(t reflect.Type) (reflect.Type, bool) {
+	for t != nil {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		case reflect.Struct:
+			return t, true
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// validationProblem monta o problema de validação no idioma pedido pelo cliente
+func validationProblem(ctx *fasthttp.RequestCtx, err validationError) Problem {
+	trans, language := translatorFor(ctx)
+	ctx.Response.Header.Set(fasthttp.HeaderContentLanguage, language)
+
+	detail, _ := trans.T(validationFailedKey)
+	problem := newProblem(fasthttp.StatusBadRequest, "validation_failed", detail)
+	problem.Errors = fieldErrors(err.err, err.request, trans)
+	return problem
+}
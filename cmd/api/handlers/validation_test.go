@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestTranslatorFor(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		language       string
+	}{
+		{acceptLanguage: "", language: "en"},
+		{acceptLanguage: "pt-BR", language: "pt-BR"},
+		{acceptLanguage: "pt", language: "pt-BR"},
+		{acceptLanguage: "fr-FR,en-US;q=0.8", language: "en"},
+		{acceptLanguage: "en;q=0.5,pt-BR;q=0.9", language: "pt-BR"},
+		{acceptLanguage: "pt-BR;q=0,de", language: "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.Set(fasthttp.HeaderAcceptLanguage, tt.acceptLanguage)
+
+			_, language := translatorFor(ctx)
+			require.Equal(t, tt.language, language)
+		})
+	}
+}
+
+func TestUserHandler_ValidationErrors(t *testing.T) {
+	body := `{"name":"Us","email":"not-an-email","password":"correct-horse-battery","confirm_password":"other","zip_code":"74360400"}`
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		detail         string
+		messages       []string
+	}{
+		{
+			name:     "english by default",
+			detail:   "one or more fields are invalid",
+			messages: []string{"name must be at least 3 characters in length", "email must be a valid email address", "confirm_password must be equal to password"},
+		},
+		{
+			name:           "portuguese",
+			acceptLanguage: "pt-BR,pt;q=0.9",
+			detail:         "um ou mais campos são inválidos",
+			messages:       []string{"name deve ter pelo menos 3 caracteres", "email deve ser um endereço de e-mail válido", "confirm_password deve ser igual a password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewUserHandler(nil, nil)
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/users")
+			ctx.Request.Header.Set(fasthttp.HeaderAcceptLanguage, tt.acceptLanguage)
+			ctx.Request.SetBodyString(body)
+			handler.CreateUser(ctx)
+
+			require.Equal(t, fasthttp.StatusBadRequest, ctx.Response.StatusCode())
+
+			var problem Problem
+			require.NoError(t, json.Unmarshal(ctx.Response.Body(), &problem))
+			require.Equal(t, "validation_failed", problem.Code)
+			require.Equal(t, tt.detail, problem.Detail)
+			require.Len(t, problem.Errors, 3)
+
+			require.Equal(t, FieldError{Field: "name", Rule: "min", Param: "3", Message: tt.messages[0]}, problem.Errors[0])
+			require.Equal(t, FieldError{Field: "email", Rule: "email", Message: tt.messages[1]}, problem.Errors[1])
+			require.Equal(t, FieldError{Field: "confirm_password", Rule: "eqfield", Param: "password", Message: tt.messages[2]}, problem.Errors[2])
+		})
+	}
+}
+
+func TestFieldErrors_CrossFieldParam(t *testing.T) {
+	type period struct {
+		Start int `json:"start_at"`
+		End   int `json:"end_at" validate:"gtfield=Start"`
+	}
+	type request struct {
+		Periods []period `json:"periods" validate:"dive"`
+	}
+
+	body := request{Periods: []period{{Start: 2, End: 1}}}
+	trans, _ := translator.GetTranslator("en")
+
+	fields := fieldErrors(validator.Struct(body), body, trans)
+	require.Equal(t, []FieldError{{
+		Field:   "periods[0].end_at",
+		Rule:    "gtfield",
+		Param:   "start_at",
+		Message: "end_at must be greater than start_at",
+	}}, fields)
+}
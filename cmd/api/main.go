@@ -1,16 +1,38 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/fasthttp/router"
 	"github.com/juliovcruz/user-register/cmd/api/handlers"
 	_ "github.com/juliovcruz/user-register/docs"
 	"github.com/juliovcruz/user-register/internal/mailvalidation"
 	"github.com/juliovcruz/user-register/internal/mailvalidation/sender"
 	"github.com/juliovcruz/user-register/internal/platform/database"
+	"github.com/juliovcruz/user-register/internal/platform/health"
+	"github.com/juliovcruz/user-register/internal/platform/logging"
+	"github.com/juliovcruz/user-register/internal/platform/metrics"
+	"github.com/juliovcruz/user-register/internal/platform/server"
+	"github.com/juliovcruz/user-register/internal/platform/tracing"
+	"github.com/juliovcruz/user-register/internal/security/apikey"
+	"github.com/juliovcruz/user-register/internal/security/encryption"
 	"github.com/juliovcruz/user-register/internal/security/hash"
+	"github.com/juliovcruz/user-register/internal/security/lockout"
+	"github.com/juliovcruz/user-register/internal/security/mtls"
+	"github.com/juliovcruz/user-register/internal/security/oauth"
+	"github.com/juliovcruz/user-register/internal/security/oidc"
 	"github.com/juliovcruz/user-register/internal/security/token"
 	"github.com/juliovcruz/user-register/internal/settings"
 	"github.com/juliovcruz/user-register/internal/users"
+	"github.com/juliovcruz/user-register/internal/users/mfa"
+	"github.com/juliovcruz/user-register/internal/users/normalization"
+	"github.com/juliovcruz/user-register/internal/users/password"
+	"github.com/juliovcruz/user-register/internal/users/registration"
 	"github.com/juliovcruz/user-register/internal/users/zipcode"
 	"github.com/juliovcruz/user-register/internal/users/zipcode/viacep"
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -24,14 +46,34 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
-	sett, err := settings.LoadSettings(settings.Local)
+	sett, err := settings.Load()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfigCommand(os.Args[2:], sett, err); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	logger, err := logging.New(sett.Logging, os.Stdout)
 	if err != nil {
 		panic(err)
 	}
+	slog.SetDefault(logger)
 
+	shutdownTracing, err := tracing.New(context.Background(), sett.Tracing)
+	if err != nil {
+		panic(err)
+	}
+
+	metricsRecorder := metrics.NewRecorder()
 	tokenService := token.NewService(sett)
-	zipCodeService := zipcode.NewService(viacep.NewClient(sett.ZipCodeSettings))
-	hashService := hash.NewService(sett)
+	viaCEPClient := viacep.NewClient(sett.ZipCodeSettings, metricsRecorder)
+	zipCodeService := zipcode.NewService(viaCEPClient)
+	hashService := hash.NewService(sett, metricsRecorder)
 
 	db, err := database.NewDatabase(sett.Database.FilePath, sett.Database.Driver)
 	if err != nil {
@@ -43,23 +85,147 @@ func main() {
 		panic(err)
 	}
 
-	mailValidationService := mailvalidation.NewService(mailvalidation.NewRepository(db), sender.NewClient(), sett.MailValidationExpirationTime)
+	mailValidationService := mailvalidation.NewService(mailvalidation.NewRepository(db), sender.NewClient(logger), sett.MailValidationExpirationTime, sett.MagicLinkSettings, metricsRecorder)
+
+	emailNormalizer := normalization.NewService(sett.EmailNormalization)
+	mfaService := mfa.NewService(mfa.NewRepository(db), encryption.NewService(sett), sett.MFA)
+
+	registrationService, err := registration.NewService(registration.NewRepository(db), sett.RegistrationPolicy)
+	if err != nil {
+		panic(err)
+	}
+
+	passwordPolicy, err := password.NewService(sett.PasswordPolicy)
+	if err != nil {
+		panic(err)
+	}
+
+	userService := users.NewService(
+		userRepository, tokenService, zipCodeService, hashService,
+		mailValidationService, emailNormalizer, registrationService, passwordPolicy,
+		lockout.NewService(lockout.NewRepository(db), sett.Lockout), mfaService, metricsRecorder, logger,
+	)
+	if err := userService.PromoteAdmins(context.Background(), sett.AdminEmails); err != nil {
+		panic(err)
+	}
+
+	if len(os.Args) > 1 {
+		defer db.Close()
+		if err := runCommand(context.Background(), os.Args[1:], userService); err != nil {
+			panic(err)
+		}
+		return
+	}
 
-	userService := users.NewService(userRepository, tokenService, zipCodeService, hashService, mailValidationService)
 	userHandler := handlers.NewUserHandler(userService, tokenService)
+	magicLinkHandler := handlers.NewMagicLinkHandler(mailValidationService)
+	registrationHandler := handlers.NewRegistrationHandler(registrationService)
+	mfaHandler := handlers.NewMFAHandler(mfaService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apikey.NewService(apikey.NewRepository(db)))
+	oidcService, err := oidc.NewService(userService, sett.OIDC)
+	if err != nil {
+		panic(err)
+	}
+
+	oauthService := oauth.NewService(oauth.NewRepository(db), tokenService, userService, oidcService, sett.OAuth)
+	oauthHandler := handlers.NewOAuthHandler(oauthService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService, oauthService)
+	dependencies := []health.Dependency{
+		{Name: "database", Required: true, Check: db.PingContext},
+		{Name: "migrations", Required: true, Check: func(ctx context.Context) error { return database.CheckMigrations(ctx, db) }},
+	}
+	if sett.Health.CheckZipCode {
+		dependencies = append(dependencies, health.Dependency{Name: "zip_code", Check: viaCEPClient.Check})
+	}
+	healthHandler := handlers.NewHealthHandler(health.NewService(sett.Health, dependencies...))
+	mtlsHandler := handlers.NewMTLSHandler(mtls.NewService(sett.Server.TLS.ClientIdentities))
 	r := router.New()
+	r.SaveMatchedRoutePath = true
+
+	// GET /users aceita certificado de cliente, chave de API, access token OAuth com
+	// users:read ou o token de sessão
+	withOAuth := func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return oauthHandler.Middleware(oauth.ScopeUsersRead, userHandler.JWTMiddleware, next)
+	}
+	withAPIKey := func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return apiKeyHandler.Middleware(apikey.ScopeUsersRead, withOAuth, next)
+	}
 
 	r.POST("/users", userHandler.CreateUser)
-	r.GET("/users", userHandler.JWTMiddleware(userHandler.ListUsers))
+	r.GET("/users", mtlsHandler.Middleware(oauth.ScopeUsersRead, withAPIKey, userHandler.ListUsers))
 	r.PUT("/users/password", userHandler.UpdatePassword)
 	r.POST("/users/forgot_password", userHandler.ForgotPassword)
+	r.PUT("/users/password/link", userHandler.ResetPasswordWithLink)
+	r.POST("/users/email_verification", userHandler.RequestEmailVerification)
+	r.POST("/users/email_verification/confirm", userHandler.VerifyEmail)
+	r.POST("/users/me/email", userHandler.JWTMiddleware(userHandler.RequestEmailChange))
+	r.POST("/users/me/email/confirm", userHandler.JWTMiddleware(userHandler.ConfirmEmailChange))
+	r.POST("/users/email/undo", userHandler.UndoEmailChange)
+	r.POST("/users/me/password", userHandler.JWTMiddleware(userHandler.ChangePassword))
+	r.GET("/users/me/sessions", userHandler.JWTMiddleware(userHandler.ListSessions))
+	r.DELETE("/users/me/sessions/{id}", userHandler.JWTMiddleware(userHandler.RevokeSession))
+	r.POST("/users/me/mfa/totp", userHandler.JWTMiddleware(mfaHandler.EnrollTOTP))
+	r.POST("/users/me/mfa/totp/confirm", userHandler.JWTMiddleware(mfaHandler.ConfirmTOTP))
+
+	r.GET("/admin/email_domains", userHandler.AdminMiddleware(registrationHandler.ListDomainRules))
+	r.POST("/admin/email_domains", userHandler.AdminMiddleware(registrationHandler.CreateDomainRule))
+	r.DELETE("/admin/email_domains/{domain}", userHandler.AdminMiddleware(registrationHandler.DeleteDomainRule))
+
+	r.DELETE("/admin/users/{id}/lockout", userHandler.AdminMiddleware(userHandler.AdminUnlock))
+	r.DELETE("/admin/users/{id}/mfa", userHandler.AdminMiddleware(mfaHandler.AdminResetMFA))
+	r.GET("/admin/users/{id}/sessions", userHandler.AdminMiddleware(userHandler.AdminListSessions))
+	r.DELETE("/admin/users/{id}/sessions", userHandler.AdminMiddleware(userHandler.AdminRevokeSessions))
+	r.DELETE("/admin/users/{id}/sessions/{session_id}", userHandler.AdminMiddleware(userHandler.AdminRevokeSession))
+
+	r.GET("/admin/api_keys", userHandler.AdminMiddleware(apiKeyHandler.ListAPIKeys))
+	r.POST("/admin/api_keys", userHandler.AdminMiddleware(apiKeyHandler.CreateAPIKey))
+	r.POST("/admin/api_keys/{id}/rotate", userHandler.AdminMiddleware(apiKeyHandler.RotateAPIKey))
+	r.DELETE("/admin/api_keys/{id}", userHandler.AdminMiddleware(apiKeyHandler.RevokeAPIKey))
+
+	r.GET("/admin/oauth/clients", userHandler.AdminMiddleware(oauthHandler.ListOAuthClients))
+	r.POST("/admin/oauth/clients", userHandler.AdminMiddleware(oauthHandler.CreateOAuthClient))
+	r.DELETE("/admin/oauth/clients/{id}", userHandler.AdminMiddleware(oauthHandler.DeleteOAuthClient))
+
+	r.GET("/admin/password_hashes/peppers", userHandler.AdminMiddleware(userHandler.AdminPepperStatus))
+	r.POST("/admin/password_hashes/force_reset", userHandler.AdminMiddleware(userHandler.AdminForcePepperReset))
 
 	r.POST("/login", userHandler.Login)
+	r.POST("/login/mfa", userHandler.LoginMFA)
+	r.POST("/login/link", userHandler.RequestLoginLink)
+	r.POST("/login/link/confirm", userHandler.LoginWithLink)
+	r.POST("/login/unlock", userHandler.RequestUnlock)
+	r.POST("/login/unlock/confirm", userHandler.UnlockWithLink)
+	r.GET("/magic-link", magicLinkHandler.OpenMagicLink)
+
+	r.GET("/oauth/authorize", userHandler.JWTMiddleware(oauthHandler.Authorize))
+	r.POST("/oauth/authorize", userHandler.JWTMiddleware(oauthHandler.Consent))
+	r.POST("/oauth/token", oauthHandler.Token)
+	r.GET("/userinfo", oidcHandler.UserInfo)
+	r.POST("/userinfo", oidcHandler.UserInfo)
+	r.GET("/.well-known/openid-configuration", oidcHandler.Discovery)
+	r.GET("/.well-known/jwks.json", oidcHandler.JWKS)
+
+	r.GET("/healthz", healthHandler.Liveness)
+	r.GET("/readyz", healthHandler.Readiness)
+	r.GET("/status", userHandler.AdminMiddleware(healthHandler.Status))
+	r.GET("/metrics", handlers.MetricsMiddleware(sett.Metrics, metrics.Handler()))
+
+	r.GET("/swagger/{filepath:*}", fasthttpadaptor.NewFastHTTPHandler(httpSwagger.WrapHandler))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := metrics.RegisterDB(db, "main"); err != nil {
+		panic(err)
+	}
 
-	r.GET("/{filepath:*}", fasthttpadaptor.NewFastHTTPHandler(httpSwagger.WrapHandler))
+	handler := handlers.SecurityHeadersMiddleware(sett.SecurityHeaders, handlers.CorsMiddleware(sett.CORS, r.Handler))
+	handler = metrics.Middleware(logging.Middleware(logger, tracing.Middleware(handler)))
+	srv := server.New(handler, sett.Server, logger)
+	srv.OnShutdown(shutdownTracing)
+	srv.OnShutdown(db.Close)
 
-	println("Server on port 8080")
-	if err := fasthttp.ListenAndServe(":8080", handlers.CorsMiddleware(r.Handler)); err != nil {
+	if err := srv.ListenAndServe(ctx); err != nil {
 		panic(err)
 	}
 }
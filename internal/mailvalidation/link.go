@@ -0,0 +1,81 @@
+package mailvalidation
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func signLink(secret string, link LinkToken) string {
+	payload := strings.Join([]string{
+		string(link.Purpose),
+		link.Email,
+		strconv.FormatInt(link.ExpiredAt.Unix(), 10),
+		link.ID,
+		link.Reference,
+	}, "\n")
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	signature := base64.RawURLEncoding.EncodeToString(linkMAC(secret, encodedPayload))
+
+	return encodedPayload + "." + signature
+}
+
+func parseLink(secret, token string) (LinkToken, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return LinkToken{}, ErrInvalidLink
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return LinkToken{}, ErrInvalidLink
+	}
+
+	if !hmac.Equal(signature, linkMAC(secret, encodedPayload)) {
+		return LinkToken{}, ErrInvalidLink
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return LinkToken{}, ErrInvalidLink
+	}
+
+	parts := strings.Split(string(payload), "\n")
+	if len(parts) != 5 {
+		return LinkToken{}, ErrInvalidLink
+	}
+
+	expiredAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return LinkToken{}, ErrInvalidLink
+	}
+
+	return LinkToken{
+		Purpose:   Purpose(parts[0]),
+		Email:     parts[1],
+		ExpiredAt: time.Unix(expiredAt, 0),
+		ID:        parts[3],
+		Reference: parts[4],
+	}, nil
+}
+
+func linkMAC(secret, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func newLinkID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate link id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
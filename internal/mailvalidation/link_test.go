@@ -0,0 +1,57 @@
+package mailvalidation
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndParseLink(t *testing.T) {
+	link := LinkToken{
+		ID:        "abc123",
+		Email:     "test@example.com",
+		Purpose:   PurposeEmailChangeUndo,
+		Reference: "42",
+		ExpiredAt: time.Unix(1700000000, 0),
+	}
+
+	token := signLink("secret", link)
+
+	t.Run("Valid token", func(t *testing.T) {
+		parsed, err := parseLink("secret", token)
+		require.NoError(t, err)
+		require.Equal(t, link.ID, parsed.ID)
+		require.Equal(t, link.Email, parsed.Email)
+		require.Equal(t, link.Purpose, parsed.Purpose)
+		require.Equal(t, link.Reference, parsed.Reference)
+		require.True(t, link.ExpiredAt.Equal(parsed.ExpiredAt))
+	})
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		_, err := parseLink("other", token)
+		require.ErrorIs(t, err, ErrInvalidLink)
+	})
+
+	t.Run("Tampered payload", func(t *testing.T) {
+		tampered := signLink("other", LinkToken{ID: "abc123", Email: "attacker@example.com", Purpose: PurposeLogin, ExpiredAt: link.ExpiredAt})
+		_, signature, _ := strings.Cut(token, ".")
+		payload, _, _ := strings.Cut(tampered, ".")
+		_, err := parseLink("secret", payload+"."+signature)
+		require.ErrorIs(t, err, ErrInvalidLink)
+	})
+
+	t.Run("Signed payload without the reference", func(t *testing.T) {
+		payload := base64.RawURLEncoding.EncodeToString([]byte("login\ntest@example.com\n1700000000\nabc123"))
+		signature := base64.RawURLEncoding.EncodeToString(linkMAC("secret", payload))
+		_, err := parseLink("secret", payload+"."+signature)
+		require.ErrorIs(t, err, ErrInvalidLink)
+	})
+
+	t.Run("Malformed token", func(t *testing.T) {
+		_, err := parseLink("secret", "not-a-token")
+		require.ErrorIs(t, err, ErrInvalidLink)
+	})
+}
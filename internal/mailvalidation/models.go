@@ -12,8 +12,41 @@ var (
 	ErrCodeExpired     = errors.New("code expired, try again")
 )
 
+var (
+	ErrInvalidLink     = errors.New("invalid link")
+	ErrLinkExpired     = errors.New("link expired, try again")
+	ErrLinkAlreadyUsed = errors.New("link already used")
+)
+
+type Purpose string
+
+const (
+	PurposePasswordReset     Purpose = "password_reset"
+	PurposeEmailVerification Purpose = "email_verification"
+	PurposeLogin             Purpose = "login"
+	PurposeEmailChangeUndo   Purpose = "email_change_undo"
+	PurposeAccountUnlock     Purpose = "account_unlock"
+)
+
+type Notification string
+
+const (
+	NotificationPasswordChanged Notification = "password_changed"
+)
+
 type MailValidation struct {
 	Email     string    `json:"email"`
 	Code      int       `json:"code"`
 	ExpiredAt time.Time `json:"expired_at"`
 }
+
+// LinkToken.Reference amarra o link a um registro específico, como a troca de e-mail que
+// ele desfaz; vai assinada no token e não é gravada
+type LinkToken struct {
+	ID         string     `json:"id"`
+	Email      string     `json:"email"`
+	Purpose    Purpose    `json:"purpose"`
+	Reference  string     `json:"reference,omitempty"`
+	ExpiredAt  time.Time  `json:"expired_at"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+}
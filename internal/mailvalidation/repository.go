@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -49,3 +50,43 @@ func (repo *sqliteMailValidationRepo) Delete(ctx context.Context, email string)
 	}
 	return nil
 }
+
+func (repo *sqliteMailValidationRepo) CreateLink(ctx context.Context, link LinkToken) error {
+	_, err := repo.db.ExecContext(ctx, `
+		INSERT INTO link_tokens (id, email, purpose, expired_at)
+		VALUES (?, ?, ?, ?);
+	`, link.ID, link.Email, link.Purpose, link.ExpiredAt)
+	if err != nil {
+		return fmt.Errorf("failed to create link token: %w", err)
+	}
+	return nil
+}
+
+func (repo *sqliteMailValidationRepo) ConsumeLink(ctx context.Context, id string, consumedAt time.Time) error {
+	res, err := repo.db.ExecContext(ctx, `
+		UPDATE link_tokens SET consumed_at = ?
+		WHERE id = ? AND consumed_at IS NULL;
+	`, consumedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to consume link token: %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		var exists bool
+		err := repo.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM link_tokens WHERE id = ?)", id).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to get link token: %w", err)
+		}
+		if exists {
+			return ErrLinkAlreadyUsed
+		}
+		return ErrInvalidLink
+	}
+
+	return nil
+}
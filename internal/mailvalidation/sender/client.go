@@ -1,14 +1,33 @@
 package sender
 
-import "context"
+import (
+	"context"
+	"log/slog"
 
-type Client struct{}
+	"github.com/juliovcruz/user-register/internal/mailvalidation"
+)
 
-func NewClient() *Client {
-	return &Client{}
+// Client ainda não entrega e-mails, apenas registra o envio. Códigos e links nunca vão para
+// o log, já que dão acesso à conta
+type Client struct {
+	logger *slog.Logger
+}
+
+func NewClient(logger *slog.Logger) *Client {
+	return &Client{logger: logger}
 }
 
 func (c *Client) Send(ctx context.Context, email string, code int) error {
-	println("sending email to", email, "with code", code)
+	c.logger.InfoContext(ctx, "sending verification code", "email", email)
+	return nil
+}
+
+func (c *Client) SendLink(ctx context.Context, email string, purpose mailvalidation.Purpose, link string) error {
+	c.logger.InfoContext(ctx, "sending link", "email", email, "purpose", string(purpose))
+	return nil
+}
+
+func (c *Client) SendNotification(ctx context.Context, email string, notification mailvalidation.Notification) error {
+	c.logger.InfoContext(ctx, "sending notification", "email", email, "notification", string(notification))
 	return nil
 }
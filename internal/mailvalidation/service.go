@@ -4,42 +4,57 @@ import (
 	"context"
 	"errors"
 	"math/rand"
+	"net/url"
 	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
 )
 
 type Repository interface {
 	CreateOrUpdate(ctx context.Context, mailValidation MailValidation) error
 	GetByEmail(ctx context.Context, email string) (MailValidation, error)
 	Delete(ctx context.Context, email string) error
+	CreateLink(ctx context.Context, link LinkToken) error
+	ConsumeLink(ctx context.Context, id string, consumedAt time.Time) error
 }
 
 type Client interface {
 	Send(ctx context.Context, email string, code int) error
+	SendLink(ctx context.Context, email string, purpose Purpose, link string) error
+	SendNotification(ctx context.Context, email string, notification Notification) error
+}
+
+type metricsRecorder interface {
+	MailSent(kind string, err error)
 }
 
 type Service struct {
-	repo      Repository
-	expiredIn time.Duration
-	client    Client
+	repo         Repository
+	expiredIn    time.Duration
+	client       Client
+	linkSettings settings.MagicLink
+	metrics      metricsRecorder
 }
 
-func NewService(repo Repository, client Client, expirationTime time.Duration) *Service {
-	return &Service{repo: repo, expiredIn: expirationTime, client: client}
+func NewService(repo Repository, client Client, expirationTime time.Duration, linkSettings settings.MagicLink, metrics metricsRecorder) *Service {
+	return &Service{repo: repo, expiredIn: expirationTime, client: client, linkSettings: linkSettings, metrics: metrics}
 }
 
 func (s *Service) Create(ctx context.Context, email string) error {
 	alreadyExists, err := s.repo.GetByEmail(ctx, email)
-	if !errors.Is(err, ErrRecordNotFound) {
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
 		return err
 	}
 
-	if !alreadyExists.ExpiredAt.IsZero() && alreadyExists.ExpiredAt.Before(time.Now()) {
+	if !alreadyExists.ExpiredAt.IsZero() && alreadyExists.ExpiredAt.After(time.Now()) {
 		return ErrCodeAlreadySent
 	}
 
 	code := rand.Intn(999999)
 
-	if err := s.client.Send(ctx, email, code); err != nil {
+	err = s.client.Send(ctx, email, code)
+	s.metrics.MailSent("code", err)
+	if err != nil {
 		return err
 	}
 
@@ -50,7 +65,8 @@ func (s *Service) Create(ctx context.Context, email string) error {
 	})
 }
 
-func (s *Service) Validate(ctx context.Context, email string, code int) error {
+// Check confere o código sem consumi-lo, para validar o restante do pedido antes
+func (s *Service) Check(ctx context.Context, email string, code int) error {
 	mailValidation, err := s.repo.GetByEmail(ctx, email)
 	if err != nil {
 		return err
@@ -61,6 +77,13 @@ func (s *Service) Validate(ctx context.Context, email string, code int) error {
 	if time.Now().After(mailValidation.ExpiredAt) {
 		return ErrCodeExpired
 	}
+	return nil
+}
+
+func (s *Service) Validate(ctx context.Context, email string, code int) error {
+	if err := s.Check(ctx, email, code); err != nil {
+		return err
+	}
 
 	if err := s.repo.Delete(ctx, email); err != nil {
 		return err
@@ -68,3 +91,83 @@ func (s *Service) Validate(ctx context.Context, email string, code int) error {
 
 	return nil
 }
+
+func (s *Service) CreateLink(ctx context.Context, email string, purpose Purpose) error {
+	return s.CreateReferencedLink(ctx, email, purpose, "")
+}
+
+// CreateReferencedLink envia um link que só vale para o registro indicado por reference
+func (s *Service) CreateReferencedLink(ctx context.Context, email string, purpose Purpose, reference string) error {
+	id, err := newLinkID()
+	if err != nil {
+		return err
+	}
+
+	link := LinkToken{
+		ID:        id,
+		Email:     email,
+		Purpose:   purpose,
+		Reference: reference,
+		ExpiredAt: time.Now().Add(s.linkExpiration(purpose)),
+	}
+
+	if err := s.repo.CreateLink(ctx, link); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("purpose", string(purpose))
+	query.Set("token", signLink(s.linkSettings.Secret, link))
+
+	err = s.client.SendLink(ctx, email, purpose, s.linkSettings.BaseURL+"?"+query.Encode())
+	s.metrics.MailSent("link", err)
+	return err
+}
+
+func (s *Service) Notify(ctx context.Context, email string, notification Notification) error {
+	err := s.client.SendNotification(ctx, email, notification)
+	s.metrics.MailSent("notification", err)
+	return err
+}
+
+// InspectLink confere assinatura e validade do link sem consumi-lo, para que a página de
+// destino saiba qual ação concluir
+func (s *Service) InspectLink(token string) (LinkToken, error) {
+	link, err := parseLink(s.linkSettings.Secret, token)
+	if err != nil {
+		return LinkToken{}, err
+	}
+	if time.Now().After(link.ExpiredAt) {
+		return LinkToken{}, ErrLinkExpired
+	}
+	return link, nil
+}
+
+func (s *Service) ValidateLink(ctx context.Context, token string, purpose Purpose) (string, error) {
+	email, _, err := s.ValidateReferencedLink(ctx, token, purpose)
+	return email, err
+}
+
+// ValidateReferencedLink consome o link e retorna o e-mail e a referência com que foi criado
+func (s *Service) ValidateReferencedLink(ctx context.Context, token string, purpose Purpose) (string, string, error) {
+	link, err := s.InspectLink(token)
+	if err != nil {
+		return "", "", err
+	}
+	if link.Purpose != purpose {
+		return "", "", ErrInvalidLink
+	}
+
+	if err := s.repo.ConsumeLink(ctx, link.ID, time.Now()); err != nil {
+		return "", "", err
+	}
+
+	return link.Email, link.Reference, nil
+}
+
+func (s *Service) linkExpiration(purpose Purpose) time.Duration {
+	if purpose == PurposeEmailChangeUndo {
+		return s.linkSettings.UndoExpirationTime
+	}
+	return s.linkSettings.ExpirationTime
+}
@@ -0,0 +1,114 @@
+package mailvalidation
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/platform/database"
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+)
+
+type clientMock struct {
+	links []string
+}
+
+func (c *clientMock) Send(ctx context.Context, email string, code int) error {
+	return nil
+}
+
+func (c *clientMock) SendLink(ctx context.Context, email string, purpose Purpose, link string) error {
+	c.links = append(c.links, link)
+	return nil
+}
+
+func (c *clientMock) SendNotification(ctx context.Context, email string, notification Notification) error {
+	return nil
+}
+
+type metricsRecorderMock struct {
+	sent []string
+}
+
+func (m *metricsRecorderMock) MailSent(kind string, err error) {
+	m.sent = append(m.sent, kind)
+}
+
+func newTestService(t *testing.T, linkSettings settings.MagicLink) (*Service, *clientMock) {
+	db, err := database.NewDatabase(t.TempDir()+"/database.db", "sqlite3")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	client := &clientMock{}
+	return NewService(NewRepository(db), client, time.Hour, linkSettings, &metricsRecorderMock{}), client
+}
+
+// sentToken devolve o token do último link enviado, conferindo o destino montado com BaseURL
+func sentToken(t *testing.T, client *clientMock, purpose Purpose) string {
+	link, err := url.Parse(client.links[len(client.links)-1])
+	require.NoError(t, err)
+	require.Equal(t, "/magic-link", link.Path)
+	require.Equal(t, string(purpose), link.Query().Get("purpose"))
+	return link.Query().Get("token")
+}
+
+func TestService_ValidateLink(t *testing.T) {
+	ctx := context.Background()
+	linkSettings := settings.MagicLink{Secret: "link-secret", BaseURL: "https://app.example.com/magic-link", ExpirationTime: time.Minute}
+
+	t.Run("Single use", func(t *testing.T) {
+		service, client := newTestService(t, linkSettings)
+		require.NoError(t, service.CreateLink(ctx, "user@example.com", PurposeLogin))
+		token := sentToken(t, client, PurposeLogin)
+
+		email, err := service.ValidateLink(ctx, token, PurposeLogin)
+		require.NoError(t, err)
+		require.Equal(t, "user@example.com", email)
+
+		_, err = service.ValidateLink(ctx, token, PurposeLogin)
+		require.ErrorIs(t, err, ErrLinkAlreadyUsed)
+	})
+
+	t.Run("Inspect does not consume", func(t *testing.T) {
+		service, client := newTestService(t, linkSettings)
+		require.NoError(t, service.CreateLink(ctx, "user@example.com", PurposeAccountUnlock))
+		token := sentToken(t, client, PurposeAccountUnlock)
+
+		link, err := service.InspectLink(token)
+		require.NoError(t, err)
+		require.Equal(t, PurposeAccountUnlock, link.Purpose)
+
+		_, err = service.ValidateLink(ctx, token, PurposeAccountUnlock)
+		require.NoError(t, err)
+	})
+
+	t.Run("Wrong purpose", func(t *testing.T) {
+		service, client := newTestService(t, linkSettings)
+		require.NoError(t, service.CreateLink(ctx, "user@example.com", PurposeLogin))
+		token := sentToken(t, client, PurposeLogin)
+
+		_, err := service.ValidateLink(ctx, token, PurposePasswordReset)
+		require.ErrorIs(t, err, ErrInvalidLink)
+
+		_, err = service.ValidateLink(ctx, token, PurposeLogin)
+		require.NoError(t, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		service, _ := newTestService(t, linkSettings)
+		token := signLink(linkSettings.Secret, LinkToken{ID: "expired", Email: "user@example.com", Purpose: PurposeLogin, ExpiredAt: time.Now().Add(-time.Minute)})
+
+		_, err := service.ValidateLink(ctx, token, PurposeLogin)
+		require.ErrorIs(t, err, ErrLinkExpired)
+	})
+
+	t.Run("Signed but never issued", func(t *testing.T) {
+		service, _ := newTestService(t, linkSettings)
+		token := signLink(linkSettings.Secret, LinkToken{ID: "unknown", Email: "user@example.com", Purpose: PurposeLogin, ExpiredAt: time.Now().Add(time.Minute)})
+
+		_, err := service.ValidateLink(ctx, token, PurposeLogin)
+		require.ErrorIs(t, err, ErrInvalidLink)
+	})
+}
@@ -1,15 +1,20 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 )
 
 func NewDatabase(path, driver string) (*sql.DB, error) {
-	db, err := sql.Open(driver, path)
+	registered, err := sql.Open(driver, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open sqlite database: %v", err)
 	}
+	db := sql.OpenDB(&tracedConnector{driver: registered.Driver(), dsn: path})
+	if err := registered.Close(); err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %v", err)
+	}
 
 	createTableQuery := `
 		CREATE TABLE IF NOT EXISTS users (
@@ -32,5 +37,9 @@ func NewDatabase(path, driver string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create users table: %v", err)
 	}
 
+	if err := runMigrations(context.Background(), db); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
@@ -0,0 +1,343 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrPendingMigrations = errors.New("database has pending migrations")
+
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+func execQuery(query string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query)
+		return err
+	}
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "add email verification and link tokens",
+		up: execQuery(`
+			ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+			CREATE TABLE IF NOT EXISTS link_tokens (
+				id TEXT PRIMARY KEY,
+				email TEXT NOT NULL,
+				purpose TEXT NOT NULL,
+				expired_at DATETIME NOT NULL,
+				consumed_at DATETIME
+			);
+		`),
+	},
+	{
+		version: 2,
+		name:    "add email changes and session revocation",
+		up: execQuery(`
+			ALTER TABLE users ADD COLUMN sessions_revoked_at DATETIME;
+
+			CREATE TABLE IF NOT EXISTS email_changes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				old_email TEXT NOT NULL,
+				new_email TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				confirmed_at DATETIME,
+				undone_at DATETIME
+			);
+		`),
+	},
+	{
+		version: 3,
+		name:    "add case-insensitive unique index on users email",
+		up:      addEmailNoCaseIndex,
+	},
+	{
+		version: 4,
+		name:    "add user roles and email domain rules",
+		up: execQuery(`
+			ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+
+			CREATE TABLE IF NOT EXISTS email_domain_rules (
+				domain TEXT PRIMARY KEY,
+				rule TEXT NOT NULL CHECK (rule IN ('allow', 'deny')),
+				created_at DATETIME NOT NULL
+			);
+		`),
+	},
+	{
+		version: 5,
+		name:    "add login attempts",
+		up: execQuery(`
+			CREATE TABLE IF NOT EXISTS login_attempts (
+				key TEXT PRIMARY KEY,
+				failures INTEGER NOT NULL,
+				last_failure_at DATETIME NOT NULL,
+				locked_until DATETIME
+			);
+		`),
+	},
+	{
+		version: 6,
+		name:    "add totp and recovery codes",
+		up: execQuery(`
+			CREATE TABLE IF NOT EXISTS mfa_totp (
+				user_id INTEGER PRIMARY KEY REFERENCES users(id),
+				secret TEXT NOT NULL,
+				confirmed_at DATETIME,
+				last_used_step INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME NOT NULL
+			);
+
+			CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				code_hash TEXT NOT NULL,
+				used_at DATETIME
+			);
+
+			CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+		`),
+	},
+	{
+		version: 7,
+		name:    "add password history",
+		up: execQuery(`
+			CREATE TABLE IF NOT EXISTS password_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				password TEXT NOT NULL,
+				created_at DATETIME NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS password_history_user_id ON password_history (user_id);
+		`),
+	},
+	{
+		version: 8,
+		name:    "add sessions",
+		up: execQuery(`
+			CREATE TABLE IF NOT EXISTS sessions (
+				id TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				ip TEXT NOT NULL,
+				user_agent TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				last_used_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				revoked_at DATETIME
+			);
+
+			CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
+		`),
+	},
+	{
+		version: 9,
+		name:    "add api keys",
+		up: execQuery(`
+			CREATE TABLE IF NOT EXISTS api_keys (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				prefix TEXT NOT NULL UNIQUE,
+				hash TEXT NOT NULL,
+				scopes TEXT NOT NULL,
+				created_by INTEGER NOT NULL REFERENCES users(id),
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME,
+				last_used_at DATETIME,
+				revoked_at DATETIME
+			);
+		`),
+	},
+	{
+		version: 10,
+		name:    "add oauth clients, codes, refresh tokens and consents",
+		up: execQuery(`
+			CREATE TABLE IF NOT EXISTS oauth_clients (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				secret_hash TEXT,
+				redirect_uris TEXT NOT NULL,
+				grant_types TEXT NOT NULL,
+				scopes TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				deleted_at DATETIME
+			);
+
+			CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+				code_hash TEXT PRIMARY KEY,
+				client_id TEXT NOT NULL REFERENCES oauth_clients(id),
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				redirect_uri TEXT NOT NULL,
+				scopes TEXT NOT NULL,
+				code_challenge TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				consumed_at DATETIME
+			);
+
+			CREATE TABLE IF NOT EXISTS oauth_refresh_tokens (
+				token_hash TEXT PRIMARY KEY,
+				client_id TEXT NOT NULL REFERENCES oauth_clients(id),
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				scopes TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				revoked_at DATETIME
+			);
+
+			CREATE INDEX IF NOT EXISTS oauth_refresh_tokens_client_user ON oauth_refresh_tokens (client_id, user_id);
+
+			CREATE TABLE IF NOT EXISTS oauth_consents (
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				client_id TEXT NOT NULL REFERENCES oauth_clients(id),
+				scopes TEXT NOT NULL,
+				granted_at DATETIME NOT NULL,
+				PRIMARY KEY (user_id, client_id)
+			);
+		`),
+	},
+	{
+		version: 11,
+		name:    "add openid connect nonce and auth time",
+		up: execQuery(`
+			ALTER TABLE oauth_authorization_codes ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
+			ALTER TABLE oauth_authorization_codes ADD COLUMN auth_time DATETIME;
+			ALTER TABLE oauth_refresh_tokens ADD COLUMN auth_time DATETIME;
+		`),
+	},
+	{
+		// até aqui o e-mail guardado já era a forma normalizada, que passa a ser só a chave
+		version: 12,
+		name:    "add canonical email key",
+		up: execQuery(`
+			ALTER TABLE users ADD COLUMN email_canonical TEXT NOT NULL DEFAULT '' COLLATE NOCASE;
+			UPDATE users SET email_canonical = email;
+			CREATE UNIQUE INDEX IF NOT EXISTS users_email_canonical ON users (email_canonical);
+		`),
+	},
+	{
+		// grant_id liga os refresh tokens ao código que deu origem a eles
+		version: 13,
+		name:    "link oauth tokens to their authorization code",
+		up: execQuery(`
+			ALTER TABLE oauth_authorization_codes ADD COLUMN revoked_at DATETIME;
+			ALTER TABLE oauth_refresh_tokens ADD COLUMN grant_id TEXT NOT NULL DEFAULT '';
+			CREATE INDEX IF NOT EXISTS oauth_refresh_tokens_grant ON oauth_refresh_tokens (grant_id);
+		`),
+	},
+	{
+		// users_email_canonical substitui o índice da versão 3 como chave de unicidade
+		version: 14,
+		name:    "drop case-insensitive unique index on users email",
+		up: execQuery(`
+			DROP INDEX IF EXISTS users_email_nocase;
+		`),
+	},
+}
+
+func addEmailNoCaseIndex(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT LOWER(TRIM(email)), GROUP_CONCAT(id, ', ') FROM users
+		GROUP BY LOWER(TRIM(email)) HAVING COUNT(*) > 1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to detect email collisions: %v", err)
+	}
+	defer rows.Close()
+
+	var collisions []string
+	for rows.Next() {
+		var email, ids string
+		if err := rows.Scan(&email, &ids); err != nil {
+			return fmt.Errorf("failed to scan email collision: %v", err)
+		}
+		collisions = append(collisions, fmt.Sprintf("%s (user ids: %s)", email, ids))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows iteration error: %v", err)
+	}
+
+	if len(collisions) > 0 {
+		return fmt.Errorf("found %d emails registered more than once ignoring case, merge or rename them before migrating: %s",
+			len(collisions), strings.Join(collisions, "; "))
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET email = TRIM(email) WHERE email != TRIM(email);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS users_email_nocase ON users (email COLLATE NOCASE);
+	`)
+	return err
+}
+
+func runMigrations(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to get current schema version: %v", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// CheckMigrations confere se o banco está na última versão conhecida pela aplicação
+func CheckMigrations(ctx context.Context, db *sql.DB) error {
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to get current schema version: %w", err)
+	}
+
+	if latest := migrations[len(migrations)-1].version; current < latest {
+		return fmt.Errorf("%w: at version %d, expected %d", ErrPendingMigrations, current, latest)
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(ctx, tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
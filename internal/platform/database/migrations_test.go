@@ -0,0 +1,25 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_CanonicalEmailIsTheUniquenessKey(t *testing.T) {
+	db, err := NewDatabase(t.TempDir()+"/database.db", "sqlite3")
+	require.NoError(t, err)
+	defer db.Close()
+
+	var indexes int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'users_email_nocase'`).Scan(&indexes))
+	require.Zero(t, indexes)
+
+	insert := `INSERT INTO users (name, email, email_canonical, password) VALUES ('User', ?, ?, 'hash')`
+
+	// formas digitadas diferentes com a mesma chave canônica colidem só em users_email_canonical
+	_, err = db.Exec(insert, "Walter.White+news@example.com", "walter.white@example.com")
+	require.NoError(t, err)
+	_, err = db.Exec(insert, "walter.white@example.com", "Walter.White@example.com")
+	require.ErrorContains(t, err, "users.email_canonical")
+}
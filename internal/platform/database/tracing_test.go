@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func attributeValue(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracedConn(t *testing.T) {
+	db, err := NewDatabase(t.TempDir()+"/database.db", "sqlite3")
+	require.NoError(t, err)
+	defer db.Close()
+
+	// as migrações rodam antes do recorder para que só as consultas do teste sejam gravadas
+	recorder := newRecorder(t)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+
+	t.Run("Spans named by operation without argument values", func(t *testing.T) {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO users (name, email, password)
+			VALUES (?, ?, ?)`, "User Name", "user@example.com", "secret-hash")
+		require.NoError(t, err)
+
+		var name string
+		require.NoError(t, db.QueryRowContext(ctx, "select name from users where email = ?", "user@example.com").Scan(&name))
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 2)
+		insert, query := spans[0], spans[1]
+
+		require.Equal(t, "sqlite INSERT", insert.Name())
+		require.Equal(t, "INSERT INTO users (name, email, password) VALUES (?, ?, ?)", attributeValue(insert, semconv.DBQueryTextKey))
+		require.Equal(t, "INSERT", attributeValue(insert, semconv.DBOperationNameKey))
+		require.Equal(t, "sqlite", attributeValue(insert, semconv.DBSystemKey))
+		require.Equal(t, codes.Unset, insert.Status().Code)
+
+		require.Equal(t, "sqlite SELECT", query.Name())
+		require.Equal(t, "select name from users where email = ?", attributeValue(query, semconv.DBQueryTextKey))
+
+		for _, span := range spans {
+			require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+			for _, attr := range span.Attributes() {
+				require.NotContains(t, attr.Value.Emit(), "user@example.com")
+				require.NotContains(t, attr.Value.Emit(), "secret-hash")
+			}
+		}
+	})
+
+	t.Run("Failed queries mark the span as error", func(t *testing.T) {
+		_, err := db.ExecContext(ctx, "INSERT INTO missing_table (id) VALUES (?)", 1)
+		require.Error(t, err)
+
+		spans := recorder.Ended()
+		failed := spans[len(spans)-1]
+		require.Equal(t, "sqlite INSERT", failed.Name())
+		require.Equal(t, codes.Error, failed.Status().Code)
+	})
+
+	t.Run("ErrSkip is not a failure", func(t *testing.T) {
+		_, span := startQuery(ctx, "SELECT 1")
+		endQuery(span, driver.ErrSkip)
+
+		spans := recorder.Ended()
+		skipped := spans[len(spans)-1]
+		require.Equal(t, codes.Unset, skipped.Status().Code)
+		require.Empty(t, skipped.Events())
+	})
+}
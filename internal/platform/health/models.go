@@ -0,0 +1,52 @@
+package health
+
+import (
+	"context"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// Dependency é um recurso verificado pela prontidão. Dependências opcionais aparecem no
+// status mas não tiram a aplicação de serviço quando falham
+type Dependency struct {
+	Name     string
+	Required bool
+	Check    func(ctx context.Context) error
+}
+
+type DependencyStatus struct {
+	Name        string     `json:"name"`
+	Status      Status     `json:"status"`
+	Required    bool       `json:"required"`
+	LatencyMS   float64    `json:"latency_ms"`
+	CheckedAt   time.Time  `json:"checked_at"`
+	Error       string     `json:"error,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Report é o status detalhado exibido para administradores
+type Report struct {
+	Status       Status             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// Readiness é o resumo do Report exposto sem autenticação, sem mensagens de erro
+type Readiness struct {
+	Status Status            `json:"status"`
+	Checks map[string]Status `json:"checks,omitempty"`
+}
+
+func (r Report) Readiness() Readiness {
+	readiness := Readiness{Status: r.Status, Checks: make(map[string]Status, len(r.Dependencies))}
+	for _, dependency := range r.Dependencies {
+		readiness.Checks[dependency.Name] = dependency.Status
+	}
+	return readiness
+}
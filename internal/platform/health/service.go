@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+)
+
+type lastError struct {
+	message string
+	at      time.Time
+}
+
+type Service struct {
+	dependencies []Dependency
+	timeout      time.Duration
+
+	mu         sync.Mutex
+	lastErrors map[string]lastError
+}
+
+func NewService(settings settings.Health, dependencies ...Dependency) *Service {
+	return &Service{
+		dependencies: dependencies,
+		timeout:      settings.Timeout,
+		lastErrors:   map[string]lastError{},
+	}
+}
+
+// Check verifica as dependências em paralelo, cada uma com o timeout configurado. A
+// aplicação fica fora do ar quando alguma dependência obrigatória falha
+func (s *Service) Check(ctx context.Context) Report {
+	statuses := make([]DependencyStatus, len(s.dependencies))
+
+	var wg sync.WaitGroup
+	for i, dependency := range s.dependencies {
+		wg.Add(1)
+		go func(i int, dependency Dependency) {
+			defer wg.Done()
+			statuses[i] = s.check(ctx, dependency)
+		}(i, dependency)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Dependencies: statuses}
+	for _, status := range statuses {
+		if status.Required && status.Status == StatusDown {
+			report.Status = StatusDown
+		}
+	}
+
+	return report
+}
+
+func (s *Service) check(ctx context.Context, dependency Dependency) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := dependency.Check(ctx)
+
+	status := DependencyStatus{
+		Name:      dependency.Name,
+		Status:    StatusUp,
+		Required:  dependency.Required,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start.UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+		s.lastErrors[dependency.Name] = lastError{message: err.Error(), at: status.CheckedAt}
+	}
+
+	if last, found := s.lastErrors[dependency.Name]; found {
+		status.LastError = last.message
+		status.LastErrorAt = &last.at
+	}
+
+	return status
+}
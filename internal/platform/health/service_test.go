@@ -0,0 +1,51 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Check(t *testing.T) {
+	zipCodeErr := errors.New("viacep unreachable")
+	var databaseErr error
+
+	service := NewService(settings.Health{Timeout: time.Millisecond * 50},
+		Dependency{Name: "database", Required: true, Check: func(ctx context.Context) error { return databaseErr }},
+		Dependency{Name: "zip_code", Check: func(ctx context.Context) error { return zipCodeErr }},
+		Dependency{Name: "slow", Check: func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }},
+	)
+
+	t.Run("Optional dependencies do not affect readiness", func(t *testing.T) {
+		report := service.Check(context.Background())
+
+		require.Equal(t, StatusUp, report.Status)
+		require.Equal(t, Readiness{Status: StatusUp, Checks: map[string]Status{
+			"database": StatusUp, "zip_code": StatusDown, "slow": StatusDown,
+		}}, report.Readiness())
+		require.Equal(t, "viacep unreachable", report.Dependencies[1].Error)
+		require.Equal(t, context.DeadlineExceeded.Error(), report.Dependencies[2].Error)
+	})
+
+	t.Run("Required dependency down", func(t *testing.T) {
+		databaseErr = errors.New("database is locked")
+
+		report := service.Check(context.Background())
+		require.Equal(t, StatusDown, report.Status)
+		require.Equal(t, "database is locked", report.Dependencies[0].Error)
+	})
+
+	t.Run("Last error is kept after recovering", func(t *testing.T) {
+		databaseErr = nil
+
+		report := service.Check(context.Background())
+		require.Equal(t, StatusUp, report.Status)
+		require.Empty(t, report.Dependencies[0].Error)
+		require.Equal(t, "database is locked", report.Dependencies[0].LastError)
+		require.NotNil(t, report.Dependencies[0].LastErrorAt)
+	})
+}
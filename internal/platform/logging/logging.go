@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+)
+
+const redacted = "[REDACTED]"
+
+var ErrInvalidLevel = errors.New("invalid log level")
+
+// sensitiveKeys são os atributos cujo valor nunca vai para o log, em qualquer grupo
+var sensitiveKeys = map[string]struct{}{
+	"password":         {},
+	"confirm_password": {},
+	"current_password": {},
+	"token":            {},
+	"access_token":     {},
+	"refresh_token":    {},
+	"id_token":         {},
+	"mfa_token":        {},
+	"code":             {},
+	"code_verifier":    {},
+	"recovery_code":    {},
+	"secret":           {},
+	"client_secret":    {},
+	"authorization":    {},
+	"api_key":          {},
+	"link":             {},
+}
+
+var emailPattern = regexp.MustCompile(`([A-Za-z0-9._%+\-])[A-Za-z0-9._%+\-]*@([A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+
+// New cria o logger da aplicação. Todo atributo passa por redact, inclusive a mensagem
+func New(settings settings.Logging, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(settings.Level)); err != nil {
+		return nil, ErrInvalidLevel
+	}
+
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+
+	var handler slog.Handler = slog.NewJSONHandler(w, options)
+	if settings.Format == "text" {
+		handler = slog.NewTextHandler(w, options)
+	}
+
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+func redact(_ []string, attr slog.Attr) slog.Attr {
+	if _, found := sensitiveKeys[strings.ToLower(attr.Key)]; found {
+		return slog.String(attr.Key, redacted)
+	}
+
+	switch value := attr.Value.Any().(type) {
+	case string:
+		return slog.String(attr.Key, MaskEmails(value))
+	case error:
+		return slog.String(attr.Key, MaskEmails(value.Error()))
+	}
+
+	return attr
+}
+
+// MaskEmails mantém apenas a primeira letra e o domínio de cada e-mail em text
+func MaskEmails(text string) string {
+	return emailPattern.ReplaceAllString(text, "$1***@$2")
+}
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// FromContext retorna o logger guardado pelo Middleware ou o logger padrão
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID funciona tanto com contextos criados por WithRequestID quanto com o
+// *fasthttp.RequestCtx que passou pelo Middleware
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adiciona o request_id do contexto a cada registro feito com os métodos
+// *Context do logger
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
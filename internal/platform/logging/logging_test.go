@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestLogger(t *testing.T) (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger, err := New(settings.Logging{Level: "debug", Format: "json"}, &buf)
+	require.NoError(t, err)
+	return logger, &buf
+}
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var result []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		result = append(result, record)
+	}
+	return result
+}
+
+func TestNew_InvalidLevel(t *testing.T) {
+	_, err := New(settings.Logging{Level: "verbose", Format: "json"}, &bytes.Buffer{})
+	require.ErrorIs(t, err, ErrInvalidLevel)
+}
+
+func TestLogger_Redacts(t *testing.T) {
+	logger, buf := newTestLogger(t)
+
+	logger.Info("code sent to john.doe@example.com",
+		"password", "Secret123!",
+		"Authorization", "Bearer abc",
+		slog.Group("mail", "link", "https://app/confirm?token=abc", "email", "john.doe@example.com"),
+		"error", errors.New("user maria@example.com not found"),
+	)
+
+	record := records(t, buf)[0]
+	require.Equal(t, "code sent to j***@example.com", record["msg"])
+	require.Equal(t, redacted, record["password"])
+	require.Equal(t, redacted, record["Authorization"])
+	require.Equal(t, map[string]any{"link": redacted, "email": "j***@example.com"}, record["mail"])
+	require.Equal(t, "user m***@example.com not found", record["error"])
+	require.NotContains(t, buf.String(), "Secret123!")
+}
+
+func TestLogger_RequestIDFromContext(t *testing.T) {
+	logger, buf := newTestLogger(t)
+
+	logger.InfoContext(WithRequestID(context.Background(), "abc-123"), "with id")
+	logger.InfoContext(context.Background(), "without id")
+
+	result := records(t, buf)
+	require.Equal(t, "abc-123", result[0]["request_id"])
+	require.NotContains(t, result[1], "request_id")
+}
+
+func TestMiddleware(t *testing.T) {
+	logger, buf := newTestLogger(t)
+	handler := Middleware(logger, func(ctx *fasthttp.RequestCtx) {
+		FromContext(ctx).InfoContext(ctx, "inside handler")
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod("GET")
+	ctx.Request.SetRequestURI("/mail/confirm?token=secret-token")
+	ctx.Request.Header.Set(RequestIDHeader, "incoming-id")
+	handler(ctx)
+
+	require.Equal(t, "incoming-id", string(ctx.Response.Header.Peek(RequestIDHeader)))
+	result := records(t, buf)
+	require.Len(t, result, 2)
+	require.Equal(t, "incoming-id", result[0]["request_id"])
+	require.Equal(t, "incoming-id", result[1]["request_id"])
+	require.Equal(t, "ERROR", result[1]["level"])
+	require.Equal(t, "/mail/confirm", result[1]["path"])
+	require.NotContains(t, buf.String(), "secret-token")
+}
+
+func TestMiddleware_ReplacesInvalidRequestID(t *testing.T) {
+	logger, _ := newTestLogger(t)
+	handler := Middleware(logger, func(ctx *fasthttp.RequestCtx) {})
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.Set(RequestIDHeader, "bad id\twith spaces")
+	handler(ctx)
+
+	id := string(ctx.Response.Header.Peek(RequestIDHeader))
+	require.Len(t, id, 32)
+	require.Equal(t, id, RequestID(ctx))
+}
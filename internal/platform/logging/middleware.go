@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,128}$`)
+
+// Middleware aceita o X-Request-ID recebido ou gera um novo, devolve no response, o
+// disponibiliza pelo contexto da requisição e registra o access log ao final
+func Middleware(logger *slog.Logger, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+
+		id := string(ctx.Request.Header.Peek(RequestIDHeader))
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		ctx.SetUserValue(requestIDKey{}, id)
+		ctx.SetUserValue(loggerKey{}, logger)
+		ctx.Response.Header.Set(RequestIDHeader, id)
+
+		next(ctx)
+
+		level := slog.LevelInfo
+		if ctx.Response.StatusCode() >= fasthttp.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		// o caminho é registrado sem a query string, que pode carregar tokens de links
+		logger.LogAttrs(ctx, level, "request",
+			slog.String("method", string(ctx.Method())),
+			slog.String("path", string(ctx.Path())),
+			slog.Int("status", ctx.Response.StatusCode()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", len(ctx.Response.Body())),
+			slog.String("remote_ip", ctx.RemoteIP().String()),
+			slog.String("user_agent", string(ctx.UserAgent())),
+		)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+const namespace = "user_register"
+
+// unmatchedRoute agrupa as requisições sem rota para que caminhos arbitrários não criem séries
+const unmatchedRoute = "unmatched"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	hashDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Password hashing duration by algorithm and operation.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"algorithm", "operation"})
+
+	externalDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "external_request_duration_seconds",
+		Help:      "Latency of calls to external services.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service"})
+
+	externalErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "external_request_errors_total",
+		Help:      "Failed calls to external services.",
+	}, []string{"service"})
+
+	mailSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_sent_total",
+		Help:      "Emails sent by kind and outcome.",
+	}, []string{"kind", "outcome"})
+
+	registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Users registered.",
+	})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+
+	passwordResets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "password_resets_total",
+		Help:      "Password resets by stage.",
+	}, []string{"stage"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, hashDuration, externalDuration, externalErrors,
+		mailSent, registrations, logins, passwordResets,
+	)
+}
+
+// Handler expõe as métricas no formato de exposição do Prometheus
+func Handler() fasthttp.RequestHandler {
+	return fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+}
+
+// RegisterDB publica as estatísticas do pool de conexões de db
+func RegisterDB(db *sql.DB, name string) error {
+	return registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Middleware mede as requisições pela rota do router, que precisa ter SaveMatchedRoutePath
+// habilitado antes do registro das rotas
+func Middleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		next(ctx)
+
+		route, ok := ctx.UserValue(router.MatchedRoutePathParam).(string)
+		if !ok {
+			route = unmatchedRoute
+		}
+
+		labels := prometheus.Labels{
+			"method": string(ctx.Method()),
+			"route":  route,
+			"status": strconv.Itoa(ctx.Response.StatusCode()),
+		}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Recorder registra as métricas de domínio. Os serviços recebem o Recorder pelo construtor,
+// cada um declarando só os métodos que usa, em vez de chamar o pacote diretamente
+type Recorder struct{}
+
+func NewRecorder() Recorder {
+	return Recorder{}
+}
+
+func (Recorder) ObserveHash(algorithm, operation string, start time.Time) {
+	hashDuration.WithLabelValues(algorithm, operation).Observe(time.Since(start).Seconds())
+}
+
+func (Recorder) ObserveExternal(service string, start time.Time, err error) {
+	externalDuration.WithLabelValues(service).Observe(time.Since(start).Seconds())
+	if err != nil {
+		externalErrors.WithLabelValues(service).Inc()
+	}
+}
+
+func (Recorder) MailSent(kind string, err error) {
+	outcome := "sent"
+	if err != nil {
+		outcome = "failed"
+	}
+	mailSent.WithLabelValues(kind, outcome).Inc()
+}
+
+func (Recorder) Registration() {
+	registrations.Inc()
+}
+
+func (Recorder) Login(result string) {
+	logins.WithLabelValues(result).Inc()
+}
+
+func (Recorder) PasswordReset(stage string) {
+	passwordResets.WithLabelValues(stage).Inc()
+}
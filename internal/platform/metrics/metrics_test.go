@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := router.New()
+	r.SaveMatchedRoutePath = true
+	r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+	handler := Middleware(r.Handler)
+
+	for _, path := range []string{"/users/1", "/users/2", "/unknown/1"} {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod("GET")
+		ctx.Request.SetRequestURI(path)
+		handler(ctx)
+	}
+
+	require.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/users/{id}", "200")))
+	require.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+	require.Equal(t, 2, testutil.CollectAndCount(httpDuration))
+}
+
+func TestObserveExternal(t *testing.T) {
+	NewRecorder().ObserveExternal("viacep", time.Now(), nil)
+	NewRecorder().ObserveExternal("viacep", time.Now(), errors.New("timeout"))
+
+	require.Equal(t, 1.0, testutil.ToFloat64(externalErrors.WithLabelValues("viacep")))
+	require.Equal(t, 1, testutil.CollectAndCount(externalDuration))
+}
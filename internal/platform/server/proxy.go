@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const forwardedForHeader = "X-Forwarded-For"
+
+// forwardedFor troca o endereço remoto pelo cliente informado no X-Forwarded-For quando a
+// conexão vem de um proxy confiável, para que o lockout por IP, as sessões e os logs vejam
+// o cliente real. Conexões diretas mantêm o endereço da conexão
+func forwardedFor(proxies []netip.Prefix, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		remote, ok := netip.AddrFromSlice(ctx.RemoteIP())
+		if ok {
+			if client := clientAddr(proxies, remote.Unmap(), ctx.Request.Header.PeekAll(forwardedForHeader)); client != remote.Unmap() {
+				ctx.SetRemoteAddr(&net.TCPAddr{IP: client.AsSlice()})
+			}
+		}
+		next(ctx)
+	}
+}
+
+// clientAddr percorre o X-Forwarded-For da direita para a esquerda enquanto o salto atual
+// for um proxy confiável; o primeiro endereço fora deles é o cliente. O que fica à esquerda
+// pode ter sido enviado pelo próprio cliente e é ignorado, assim como tudo a partir de um
+// valor inválido
+func clientAddr(proxies []netip.Prefix, remote netip.Addr, headers [][]byte) netip.Addr {
+	var hops []string
+	for _, header := range headers {
+		hops = append(hops, strings.Split(string(header), ",")...)
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0 && trusted(proxies, client); i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+	}
+	return client
+}
+
+func trusted(proxies []netip.Prefix, addr netip.Addr) bool {
+	for _, proxy := range proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
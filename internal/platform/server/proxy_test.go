@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestClientAddr(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.1/32")}
+
+	tests := []struct {
+		name     string
+		remote   string
+		headers  []string
+		expected string
+	}{
+		{name: "Untrusted connection ignores the header", remote: "203.0.113.9", headers: []string{"198.51.100.1"}, expected: "203.0.113.9"},
+		{name: "Trusted proxy without header", remote: "10.0.0.2", expected: "10.0.0.2"},
+		{name: "Client behind one proxy", remote: "10.0.0.2", headers: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "Spoofed entries left of the client are ignored", remote: "10.0.0.2", headers: []string{"1.1.1.1, 198.51.100.1, 192.168.1.1"}, expected: "198.51.100.1"},
+		{name: "Repeated headers are joined in order", remote: "10.0.0.2", headers: []string{"1.1.1.1", "198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "Only proxies in the chain", remote: "10.0.0.2", headers: []string{"10.0.0.5, 10.0.0.3"}, expected: "10.0.0.5"},
+		{name: "Invalid entry stops the walk", remote: "10.0.0.2", headers: []string{"198.51.100.1, unknown, 10.0.0.3"}, expected: "10.0.0.3"},
+		{name: "IPv4-mapped addresses", remote: "::ffff:10.0.0.2", headers: []string{"::ffff:198.51.100.1"}, expected: "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers [][]byte
+			for _, header := range tt.headers {
+				headers = append(headers, []byte(header))
+			}
+
+			client := clientAddr(proxies, netip.MustParseAddr(tt.remote).Unmap(), headers)
+			require.Equal(t, tt.expected, client.String())
+		})
+	}
+}
+
+func TestServer_TrustedProxies(t *testing.T) {
+	run := func(t *testing.T, trustedProxies []string) string {
+		sett := testSettings(time.Second)
+		sett.TrustedProxies = trustedProxies
+		srv := New(func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(ctx.RemoteIP().String())
+		}, sett, slog.Default())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		addr, done := start(t, srv, ctx)
+		defer func() { cancel(); <-done }()
+
+		req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI("http://" + addr + "/")
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		require.NoError(t, fasthttp.Do(req, resp))
+		return string(resp.Body())
+	}
+
+	require.Equal(t, "127.0.0.1", run(t, nil))
+	require.Equal(t, "198.51.100.1", run(t, []string{"127.0.0.1"}))
+}
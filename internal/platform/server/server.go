@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/valyala/fasthttp"
+)
+
+// Server envolve o fasthttp.Server com o ciclo de vida da aplicação: ao encerrar, para de
+// aceitar conexões, espera as requisições em andamento, para os workers em segundo plano e
+// só então fecha os recursos registrados, como o banco
+type Server struct {
+	server   *fasthttp.Server
+	settings settings.Server
+	logger   *slog.Logger
+
+	workers       sync.WaitGroup
+	workersCtx    context.Context
+	cancelWorkers context.CancelFunc
+
+	closers []func() error
+}
+
+func New(handler fasthttp.RequestHandler, settings settings.Server, logger *slog.Logger) *Server {
+	workersCtx, cancelWorkers := context.WithCancel(context.Background())
+
+	// as faixas já foram validadas no carregamento das configurações
+	if proxies, _ := settings.Proxies(); len(proxies) > 0 {
+		handler = forwardedFor(proxies, handler)
+	}
+
+	return &Server{
+		server: &fasthttp.Server{
+			Handler:            handler,
+			ReadTimeout:        settings.ReadTimeout,
+			WriteTimeout:       settings.WriteTimeout,
+			IdleTimeout:        settings.IdleTimeout,
+			MaxRequestBodySize: settings.MaxRequestBodySize,
+			Concurrency:        settings.Concurrency,
+			MaxConnsPerIP:      settings.MaxConnsPerIP,
+			CloseOnShutdown:    true,
+			Logger:             slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+		},
+		settings:      settings,
+		logger:        logger,
+		workersCtx:    workersCtx,
+		cancelWorkers: cancelWorkers,
+	}
+}
+
+// Go inicia um worker em segundo plano; o contexto recebido é cancelado no encerramento
+// e o servidor espera o worker retornar antes de fechar os recursos
+func (s *Server) Go(worker func(ctx context.Context)) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		worker(s.workersCtx)
+	}()
+}
+
+// OnShutdown registra um recurso a ser fechado depois que as requisições e os workers
+// terminam. Os recursos são fechados na ordem inversa do registro
+func (s *Server) OnShutdown(close func() error) {
+	s.closers = append(s.closers, close)
+}
+
+// ListenAndServe escuta no endereço configurado até ctx ser cancelado
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.settings.Addr())
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.settings.Addr(), err)
+	}
+
+	return s.Serve(ctx, listener)
+}
+
+// Serve atende as conexões de listener, com TLS quando configurado, até ctx ser cancelado
+// e então encerra o servidor dentro do ShutdownTimeout
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	wrapped, err := s.tlsListener(listener)
+	if err != nil {
+		return errors.Join(err, listener.Close())
+	}
+
+	s.logger.Info("server listening", "addr", listener.Addr().String(), "tls", s.settings.TLS.Enabled())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.server.Serve(wrapped)
+	}()
+
+	var serveErr error
+	select {
+	case serveErr = <-served:
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("shutting down server", "timeout", s.settings.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.settings.ShutdownTimeout)
+	defer cancel()
+
+	return errors.Join(serveErr, s.shutdown(shutdownCtx))
+}
+
+func (s *Server) shutdown(ctx context.Context) error {
+	var errs []error
+	if err := s.server.ShutdownWithContext(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain requests: %w", err))
+	}
+
+	s.cancelWorkers()
+	stopped := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("failed to stop workers: %w", ctx.Err()))
+	}
+
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i](); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close resource: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
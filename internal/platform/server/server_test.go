@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func testSettings(shutdownTimeout time.Duration) settings.Server {
+	return settings.Server{
+		ReadTimeout:        time.Second,
+		WriteTimeout:       time.Second,
+		IdleTimeout:        time.Second,
+		MaxRequestBodySize: 1024,
+		Concurrency:        16,
+		ShutdownTimeout:    shutdownTimeout,
+	}
+}
+
+func start(t *testing.T, srv *Server, ctx context.Context) (string, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx, listener)
+	}()
+
+	return listener.Addr().String(), done
+}
+
+// blockingHandler avisa em started e só responde depois que release é fechado
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		started <- struct{}{}
+		<-release
+		ctx.SetStatusCode(fasthttp.StatusOK)
+	}
+}
+
+func TestServer_DrainsInFlightRequests(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	srv := New(blockingHandler(started, release), testSettings(time.Second*5), slog.Default())
+
+	var closed []string
+	srv.OnShutdown(func() error { closed = append(closed, "database"); return nil })
+	srv.OnShutdown(func() error { closed = append(closed, "cache"); return nil })
+
+	workerStopped := make(chan struct{})
+	srv.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerStopped)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, done := start(t, srv, ctx)
+
+	responses := make(chan int, 1)
+	go func() {
+		status, _, _ := fasthttp.Get(nil, "http://"+addr+"/")
+		responses <- status
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+		t.Fatal("server stopped before the in-flight request finished")
+	case <-time.After(time.Millisecond * 100):
+	}
+	require.Empty(t, closed)
+
+	close(release)
+	require.Equal(t, fasthttp.StatusOK, <-responses)
+	require.NoError(t, <-done)
+
+	<-workerStopped
+	require.Equal(t, []string{"cache", "database"}, closed)
+
+	_, err := net.Dial("tcp", addr)
+	require.Error(t, err)
+}
+
+func TestServer_ShutdownDeadline(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	srv := New(blockingHandler(started, release), testSettings(time.Millisecond*50), slog.Default())
+
+	closed := false
+	srv.OnShutdown(func() error { closed = true; return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, done := start(t, srv, ctx)
+
+	go fasthttp.Get(nil, "http://"+addr+"/")
+	<-started
+	cancel()
+
+	err := <-done
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, closed)
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+)
+
+var ErrInvalidClientCA = errors.New("no certificates found in client ca file")
+
+// certificateReloader mantém o certificado atual e o troca quando os arquivos mudam, sem
+// derrubar as conexões abertas
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (r *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certificate, nil
+}
+
+// reload carrega o par de arquivos se algum deles mudou desde a última carga. Em caso de
+// erro o certificado anterior continua em uso
+func (r *certificateReloader) reload() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat tls certificate: %w", err)
+	}
+
+	r.mu.RLock()
+	unchanged := r.certificate != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.certificate, r.modTime = &certificate, modTime
+	r.mu.Unlock()
+	return true, nil
+}
+
+func (r *certificateReloader) watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				logger.Warn("keeping current tls certificate", "error", err)
+			}
+			if reloaded {
+				logger.Info("tls certificate reloaded", "cert_file", r.certFile)
+			}
+		}
+	}
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func tlsConfig(settings settings.TLS, reloader *certificateReloader) (*tls.Config, error) {
+	minVersion, err := settings.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	ciphers, err := settings.Ciphers()
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth, err := settings.ClientAuthType()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		GetCertificate: reloader.getCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   ciphers,
+		ClientAuth:     clientAuth,
+		NextProtos:     []string{"http/1.1"},
+	}
+
+	if settings.ClientCAFile != "" {
+		content, err := os.ReadFile(settings.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client ca file: %w", err)
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(content) {
+			return nil, ErrInvalidClientCA
+		}
+	}
+
+	return config, nil
+}
+
+// tlsListener envolve listener com TLS quando habilitado e inicia a recarga periódica
+// do certificado como worker do servidor
+func (s *Server) tlsListener(listener net.Listener) (net.Listener, error) {
+	if !s.settings.TLS.Enabled() {
+		return listener, nil
+	}
+
+	reloader, err := newCertificateReloader(s.settings.TLS.CertFile, s.settings.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := tlsConfig(s.settings.TLS, reloader)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Go(func(ctx context.Context) {
+		reloader.watch(ctx, s.settings.TLS.ReloadInterval, s.logger)
+	})
+
+	return tls.NewListener(listener, config), nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// testCA emite certificados gerados localmente para os testes de TLS
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	dir         string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{certificate: certificate, key: key, dir: t.TempDir()}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.certificate)
+	return pool
+}
+
+func (ca *testCA) file(t *testing.T) string {
+	path := filepath.Join(ca.dir, "ca.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw}), 0o600))
+	return path
+}
+
+// issue grava em name.pem e name-key.pem um certificado assinado pela CA
+func (ca *testCA) issue(t *testing.T, name, commonName string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(ca.dir, name+".pem")
+	keyFile := filepath.Join(ca.dir, name+"-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func tlsSettings(certFile, keyFile string) settings.Server {
+	sett := testSettings(time.Second)
+	sett.TLS = settings.TLS{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		MinVersion:     "1.2",
+		ReloadInterval: time.Millisecond * 20,
+		ClientAuth:     "none",
+	}
+	return sett
+}
+
+func servedSerial(t *testing.T, addr string, ca *testCA) int64 {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: ca.pool(), ServerName: "localhost"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestServer_TLSReloadsCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "server", "localhost", 10, x509.ExtKeyUsageServerAuth)
+
+	srv := New(func(ctx *fasthttp.RequestCtx) {}, tlsSettings(certFile, keyFile), slog.Default())
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, done := start(t, srv, ctx)
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	require.Equal(t, int64(10), servedSerial(t, addr, ca))
+
+	ca.issue(t, "server", "localhost", 11, x509.ExtKeyUsageServerAuth)
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+
+	require.Eventually(t, func() bool {
+		return servedSerial(t, addr, ca) == 11
+	}, time.Second*2, time.Millisecond*20)
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "server", "localhost", 10, x509.ExtKeyUsageServerAuth)
+	clientCertFile, clientKeyFile := ca.issue(t, "client", "billing.internal", 20, x509.ExtKeyUsageClientAuth)
+
+	sett := tlsSettings(certFile, keyFile)
+	sett.TLS.ClientAuth = "required"
+	sett.TLS.ClientCAFile = ca.file(t)
+
+	srv := New(func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(ctx.TLSConnectionState().PeerCertificates[0].Subject.CommonName)
+	}, sett, slog.Default())
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, done := start(t, srv, ctx)
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	client := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      ca.pool(),
+			Certificates: certificates,
+		}}}
+	}
+
+	_, err := client().Get("https://" + addr + "/")
+	require.Error(t, err)
+
+	clientCertificate, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	require.NoError(t, err)
+
+	resp, err := client(clientCertificate).Get("https://" + addr + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "billing.internal", string(body))
+}
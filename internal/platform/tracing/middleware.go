@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestHeaderCarrier adapta os headers do fasthttp para os propagadores do OpenTelemetry
+type requestHeaderCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (c requestHeaderCarrier) Get(key string) string {
+	return string(c.header.Peek(key))
+}
+
+func (c requestHeaderCarrier) Set(key, value string) {
+	c.header.Set(key, value)
+}
+
+func (c requestHeaderCarrier) Keys() []string {
+	var keys []string
+	c.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// Middleware abre o span de servidor de cada requisição, continuando o trace recebido no
+// traceparent. O nome do span usa a rota do router, que precisa ter SaveMatchedRoutePath
+// habilitado antes do registro das rotas
+func Middleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		parent := otel.GetTextMapPropagator().Extract(context.Background(), requestHeaderCarrier{&ctx.Request.Header})
+
+		method := string(ctx.Method())
+		_, span := otel.Tracer(instrumentationName).Start(parent, method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.URLPath(string(ctx.Path())),
+				semconv.UserAgentOriginal(string(ctx.UserAgent())),
+			),
+		)
+		defer span.End()
+		ctx.SetUserValue(spanKey{}, span)
+
+		next(ctx)
+
+		if route, ok := ctx.UserValue(router.MatchedRoutePathParam).(string); ok {
+			span.SetName(method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+
+		status := ctx.Response.StatusCode()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fasthttp.StatusInternalServerError {
+			span.SetStatus(codes.Error, fasthttp.StatusMessage(status))
+		}
+	}
+}
+
+// StartClient abre um span de cliente para uma chamada externa e escreve o traceparent
+// dele na requisição. O span registra o template da rota em vez da URL, que pode levar
+// dados do usuário como o CEP consultado
+func StartClient(ctx context.Context, name, template string, req *fasthttp.Request) (context.Context, trace.Span) {
+	ctx, span := start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(string(req.Header.Method())),
+			semconv.ServerAddress(string(req.URI().Host())),
+			semconv.URLTemplate(template),
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, requestHeaderCarrier{&req.Header})
+	return ctx, span
+}
@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/juliovcruz/user-register/internal/platform/logging"
+	"github.com/juliovcruz/user-register/internal/settings"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/juliovcruz/user-register"
+
+var ErrInvalidExporter = errors.New("invalid tracing exporter")
+
+// New configura o TracerProvider global e a propagação W3C (traceparent, tracestate e
+// baggage). A função devolvida envia os spans pendentes e fecha o exporter. Com o exporter
+// none nenhum span é exportado, mas cada requisição continua recebendo um trace ID, que é
+// propagado e devolvido nos erros
+func New(ctx context.Context, settings settings.Tracing) (func() error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, closeOutput, err := newExporter(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.NeverSample())))
+		otel.SetTracerProvider(provider)
+		return func() error { return provider.Shutdown(context.Background()) }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(settings.ServiceName),
+	))
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create tracing resource: %w", err), closeOutput())
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(settings.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func() error {
+		return errors.Join(provider.Shutdown(context.Background()), closeOutput())
+	}, nil
+}
+
+func newExporter(ctx context.Context, settings settings.Tracing) (sdktrace.SpanExporter, func() error, error) {
+	noClose := func() error { return nil }
+
+	switch settings.Exporter {
+	case "none":
+		return nil, noClose, nil
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exporter, noClose, err
+	case "file":
+		file, err := os.OpenFile(settings.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open tracing file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			return nil, nil, errors.Join(err, file.Close())
+		}
+		return exporter, file.Close, nil
+	case "otlp":
+		var options []otlptracehttp.Option
+		if settings.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(settings.Endpoint))
+		}
+		exporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+		}
+		return exporter, noClose, nil
+	default:
+		return nil, nil, ErrInvalidExporter
+	}
+}
+
+type spanKey struct{}
+
+// Start abre um span filho do span atual de ctx. Aceita tanto contextos comuns quanto o
+// *fasthttp.RequestCtx que passou pelo Middleware, cujo span fica nos user values
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if span, ok := ctx.Value(spanKey{}).(trace.Span); ok {
+			ctx = trace.ContextWithSpan(ctx, span)
+		}
+	}
+
+	return otel.Tracer(instrumentationName).Start(ctx, name, options...)
+}
+
+// TraceID retorna o trace ID do span atual de ctx, ou vazio quando não há trace
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if span, ok := ctx.Value(spanKey{}).(trace.Span); ok && !spanContext.IsValid() {
+		spanContext = span.SpanContext()
+	}
+
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// End registra err no span, quando houver, e o encerra. Assim como nos logs, os e-mails da
+// mensagem de erro são mascarados
+func End(span trace.Span, err error) {
+	if err != nil {
+		message := logging.MaskEmails(err.Error())
+		span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+			semconv.ExceptionType(fmt.Sprintf("%T", err)),
+			semconv.ExceptionMessage(message),
+		))
+		span.SetStatus(codes.Error, message)
+	}
+	span.End()
+}
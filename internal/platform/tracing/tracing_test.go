@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const incomingTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := newRecorder(t)
+
+	var outgoing string
+	r := router.New()
+	r.SaveMatchedRoutePath = true
+	r.POST("/users/{id}", func(ctx *fasthttp.RequestCtx) {
+		spanCtx, span := Start(ctx, "users.Service.Create")
+		defer span.End()
+
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		req.SetRequestURI("http://viacep.test/01001000/json")
+		_, client := StartClient(spanCtx, "viacep.GetAddressByZipCode", "/{cep}/json", req)
+		client.End()
+		outgoing = string(req.Header.Peek("traceparent"))
+
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI("/users/1")
+	ctx.Request.Header.Set("traceparent", incomingTraceparent)
+	Middleware(r.Handler)(ctx)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	client, service, server := spans[0], spans[1], spans[2]
+
+	require.Equal(t, "POST /users/{id}", server.Name())
+	require.Equal(t, trace.SpanKindServer, server.SpanKind())
+	require.Equal(t, codes.Error, server.Status().Code)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+
+	require.Equal(t, server.SpanContext().SpanID(), service.Parent().SpanID())
+	require.Equal(t, service.SpanContext().SpanID(), client.Parent().SpanID())
+	require.Equal(t, trace.SpanKindClient, client.SpanKind())
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+client.SpanContext().SpanID().String()+"-01", outgoing)
+
+	// o CEP consultado não pode aparecer nos atributos do span de cliente
+	require.Contains(t, client.Attributes(), semconv.URLTemplate("/{cep}/json"))
+	require.Contains(t, client.Attributes(), semconv.ServerAddress("viacep.test"))
+	for _, attr := range client.Attributes() {
+		require.NotContains(t, attr.Value.Emit(), "01001000")
+	}
+}
+
+func TestEnd_MasksEmails(t *testing.T) {
+	recorder := newRecorder(t)
+
+	_, span := Start(context.Background(), "users.Service.Login")
+	End(span, errors.New("user john.doe@example.com is locked"))
+
+	ended := recorder.Ended()[0]
+	require.Equal(t, codes.Error, ended.Status().Code)
+	require.Equal(t, "user j***@example.com is locked", ended.Status().Description)
+	require.Len(t, ended.Events(), 1)
+	require.NotContains(t, ended.Events()[0].Attributes[1].Value.AsString(), "john.doe")
+}
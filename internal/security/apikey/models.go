@@ -0,0 +1,59 @@
+package apikey
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidKey        = errors.New("invalid api key")
+	ErrInsufficientScope = errors.New("api key does not have the required scope")
+	ErrInvalidScope      = errors.New("invalid api key scope")
+	ErrKeyNotFound       = errors.New("api key not found")
+	ErrInvalidExpiration = errors.New("api key expiration must be in the future")
+)
+
+type Scope string
+
+const (
+	ScopeUsersRead Scope = "users:read"
+)
+
+var scopes = map[Scope]struct{}{
+	ScopeUsersRead: {},
+}
+
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []Scope    `json:"scopes"`
+	CreatedBy  int64      `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	Hash string `json:"-"`
+}
+
+func (k APIKey) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateAPIKey struct {
+	Name      string     `json:"name" validate:"required,min=3,max=100" example:"batch-job"`
+	Scopes    []Scope    `json:"scopes" validate:"required,min=1" example:"users:read"`
+	ExpiresAt *time.Time `json:"expires_at" example:"2030-01-01T00:00:00Z"`
+}
+
+// CreatedAPIKey é retornada apenas na criação e na rotação, única vez em que o segredo fica visível
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
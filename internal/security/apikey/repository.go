@@ -0,0 +1,150 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const columns = `id, name, prefix, hash, scopes, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &sqliteRepository{db: db}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scan(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &scopes, &key.CreatedBy,
+		&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+	if err != nil {
+		return key, err
+	}
+
+	for _, scope := range strings.Split(scopes, ",") {
+		key.Scopes = append(key.Scopes, Scope(scope))
+	}
+
+	return key, nil
+}
+
+func joinScopes(scopes []Scope) string {
+	values := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		values = append(values, string(scope))
+	}
+	return strings.Join(values, ",")
+}
+
+func (r *sqliteRepository) Create(ctx context.Context, key APIKey) (APIKey, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO api_keys (name, prefix, hash, scopes, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, key.Name, key.Prefix, key.Hash, joinScopes(key.Scopes), key.CreatedBy, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return key, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	key.ID, err = result.LastInsertId()
+	if err != nil {
+		return key, fmt.Errorf("failed to retrieve last insert ID: %w", err)
+	}
+
+	return key, nil
+}
+
+func (r *sqliteRepository) GetByID(ctx context.Context, id int64) (APIKey, error) {
+	key, err := scan(r.db.QueryRowContext(ctx, `SELECT `+columns+` FROM api_keys WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, ErrKeyNotFound
+	} else if err != nil {
+		return key, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (r *sqliteRepository) GetByPrefix(ctx context.Context, prefix string) (APIKey, error) {
+	key, err := scan(r.db.QueryRowContext(ctx, `SELECT `+columns+` FROM api_keys WHERE prefix = ?`, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, ErrKeyNotFound
+	} else if err != nil {
+		return key, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (r *sqliteRepository) GetAll(ctx context.Context) ([]APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+columns+` FROM api_keys WHERE revoked_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *sqliteRepository) UpdateSecret(ctx context.Context, id int64, prefix, hash string) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE api_keys SET prefix = ?, hash = ?, last_used_at = NULL WHERE id = ? AND revoked_at IS NULL
+	`, prefix, hash, id)
+	if err != nil {
+		return fmt.Errorf("failed to rotate api key: %w", err)
+	}
+
+	return requireRow(res)
+}
+
+func (r *sqliteRepository) Touch(ctx context.Context, id int64, usedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, usedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) Revoke(ctx context.Context, id int64, revokedAt time.Time) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, revokedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	return requireRow(res)
+}
+
+func requireRow(res sql.Result) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrKeyNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// keyPrefix identifica as chaves desta API em logs e ferramentas de detecção de segredos
+const keyPrefix = "ur"
+
+// touchInterval evita uma escrita no banco a cada requisição autenticada
+const touchInterval = time.Minute
+
+type Repository interface {
+	Create(ctx context.Context, key APIKey) (APIKey, error)
+	GetByID(ctx context.Context, id int64) (APIKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (APIKey, error)
+	GetAll(ctx context.Context) ([]APIKey, error)
+	UpdateSecret(ctx context.Context, id int64, prefix, hash string) error
+	Touch(ctx context.Context, id int64, usedAt time.Time) error
+	Revoke(ctx context.Context, id int64, revokedAt time.Time) error
+}
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func (s *Service) Create(ctx context.Context, createdBy int64, request CreateAPIKey) (CreatedAPIKey, error) {
+	for _, scope := range request.Scopes {
+		if _, found := scopes[scope]; !found {
+			return CreatedAPIKey{}, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+
+	now := time.Now()
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		return CreatedAPIKey{}, ErrInvalidExpiration
+	}
+
+	prefix, secret, raw, err := generate()
+	if err != nil {
+		return CreatedAPIKey{}, err
+	}
+
+	key, err := s.repo.Create(ctx, APIKey{
+		Name:      request.Name,
+		Prefix:    prefix,
+		Hash:      hashSecret(secret),
+		Scopes:    request.Scopes,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: request.ExpiresAt,
+	})
+	if err != nil {
+		return CreatedAPIKey{}, err
+	}
+
+	return CreatedAPIKey{APIKey: key, Key: raw}, nil
+}
+
+func (s *Service) List(ctx context.Context) ([]APIKey, error) {
+	return s.repo.GetAll(ctx)
+}
+
+// Rotate gera um novo segredo mantendo nome, escopos e validade; o segredo anterior deixa de ser aceito
+func (s *Service) Rotate(ctx context.Context, id int64) (CreatedAPIKey, error) {
+	prefix, secret, raw, err := generate()
+	if err != nil {
+		return CreatedAPIKey{}, err
+	}
+
+	if err := s.repo.UpdateSecret(ctx, id, prefix, hashSecret(secret)); err != nil {
+		return CreatedAPIKey{}, err
+	}
+
+	key, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return CreatedAPIKey{}, err
+	}
+
+	return CreatedAPIKey{APIKey: key, Key: raw}, nil
+}
+
+func (s *Service) Revoke(ctx context.Context, id int64) error {
+	return s.repo.Revoke(ctx, id, time.Now())
+}
+
+// Authenticate valida a chave no formato ur_<prefixo>_<segredo> e exige o escopo informado
+func (s *Service) Authenticate(ctx context.Context, raw string, scope Scope) (APIKey, error) {
+	parts := strings.Split(raw, "_")
+	if len(parts) != 3 || parts[0] != keyPrefix {
+		return APIKey{}, ErrInvalidKey
+	}
+
+	key, err := s.repo.GetByPrefix(ctx, parts[1])
+	if errors.Is(err, ErrKeyNotFound) {
+		return APIKey{}, ErrInvalidKey
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(parts[2])), []byte(key.Hash)) != 1 {
+		return APIKey{}, ErrInvalidKey
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return APIKey{}, ErrInvalidKey
+	}
+
+	if !key.HasScope(scope) {
+		return APIKey{}, ErrInsufficientScope
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > touchInterval {
+		if err := s.repo.Touch(ctx, key.ID, now); err != nil {
+			return APIKey{}, err
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, nil
+}
+
+func generate() (prefix, secret, raw string, err error) {
+	prefixBytes := make([]byte, 4)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	// hex garante que "_" continue separando as partes da chave
+	secret = hex.EncodeToString(secretBytes)
+	return prefix, secret, fmt.Sprintf("%s_%s_%s", keyPrefix, prefix, secret), nil
+}
+
+// hashSecret usa SHA-256 sem salt porque o segredo já tem 256 bits aleatórios
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return base64.RawStdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,145 @@
+package apikey
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type repositoryMock struct {
+	keys map[int64]APIKey
+}
+
+func (r *repositoryMock) Create(ctx context.Context, key APIKey) (APIKey, error) {
+	key.ID = int64(len(r.keys) + 1)
+	r.keys[key.ID] = key
+	return key, nil
+}
+
+func (r *repositoryMock) GetByID(ctx context.Context, id int64) (APIKey, error) {
+	key, found := r.keys[id]
+	if !found {
+		return APIKey{}, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (r *repositoryMock) GetByPrefix(ctx context.Context, prefix string) (APIKey, error) {
+	for _, key := range r.keys {
+		if key.Prefix == prefix {
+			return key, nil
+		}
+	}
+	return APIKey{}, ErrKeyNotFound
+}
+
+func (r *repositoryMock) GetAll(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (r *repositoryMock) UpdateSecret(ctx context.Context, id int64, prefix, hash string) error {
+	key, found := r.keys[id]
+	if !found {
+		return ErrKeyNotFound
+	}
+	key.Prefix, key.Hash = prefix, hash
+	r.keys[id] = key
+	return nil
+}
+
+func (r *repositoryMock) Touch(ctx context.Context, id int64, usedAt time.Time) error {
+	key := r.keys[id]
+	key.LastUsedAt = &usedAt
+	r.keys[id] = key
+	return nil
+}
+
+func (r *repositoryMock) Revoke(ctx context.Context, id int64, revokedAt time.Time) error {
+	key, found := r.keys[id]
+	if !found {
+		return ErrKeyNotFound
+	}
+	key.RevokedAt = &revokedAt
+	r.keys[id] = key
+	return nil
+}
+
+func TestService_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	repo := &repositoryMock{keys: map[int64]APIKey{}}
+	service := NewService(repo)
+
+	_, err := service.Create(ctx, 1, CreateAPIKey{Name: "invalid", Scopes: []Scope{"users:write"}})
+	require.ErrorIs(t, err, ErrInvalidScope)
+
+	created, err := service.Create(ctx, 1, CreateAPIKey{Name: "batch-job", Scopes: []Scope{ScopeUsersRead}})
+	require.NoError(t, err)
+	require.Regexp(t, `^ur_[0-9a-f]{8}_[0-9a-f]{64}$`, created.Key)
+	require.NotContains(t, repo.keys[created.ID].Hash, created.Key)
+
+	key, err := service.Authenticate(ctx, created.Key, ScopeUsersRead)
+	require.NoError(t, err)
+	require.Equal(t, created.ID, key.ID)
+	require.NotNil(t, repo.keys[created.ID].LastUsedAt)
+
+	_, err = service.Authenticate(ctx, created.Key, "users:write")
+	require.ErrorIs(t, err, ErrInsufficientScope)
+
+	tampered := []byte(created.Key)
+	tampered[len(tampered)-1] ^= 1
+	_, err = service.Authenticate(ctx, string(tampered), ScopeUsersRead)
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = service.Authenticate(ctx, "invalid", ScopeUsersRead)
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	rotated, err := service.Rotate(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.Name, rotated.Name)
+
+	_, err = service.Authenticate(ctx, created.Key, ScopeUsersRead)
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = service.Authenticate(ctx, rotated.Key, ScopeUsersRead)
+	require.NoError(t, err)
+
+	require.NoError(t, service.Revoke(ctx, created.ID))
+	_, err = service.Authenticate(ctx, rotated.Key, ScopeUsersRead)
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestService_AuthenticateExpired(t *testing.T) {
+	ctx := context.Background()
+	repo := &repositoryMock{keys: map[int64]APIKey{}}
+	service := NewService(repo)
+
+	expiresAt := time.Now().Add(time.Minute)
+	created, err := service.Create(ctx, 1, CreateAPIKey{Name: "expired", Scopes: []Scope{ScopeUsersRead}, ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	expired := repo.keys[created.ID]
+	past := time.Now().Add(-time.Second)
+	expired.ExpiresAt = &past
+	repo.keys[created.ID] = expired
+
+	_, err = service.Authenticate(ctx, created.Key, ScopeUsersRead)
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestService_CreateRejectsPastExpiration(t *testing.T) {
+	ctx := context.Background()
+	repo := &repositoryMock{keys: map[int64]APIKey{}}
+	service := NewService(repo)
+
+	for _, expiresAt := range []time.Time{time.Now().Add(-time.Minute), time.Now()} {
+		_, err := service.Create(ctx, 1, CreateAPIKey{Name: "expired", Scopes: []Scope{ScopeUsersRead}, ExpiresAt: &expiresAt})
+		require.ErrorIs(t, err, ErrInvalidExpiration)
+	}
+	require.Empty(t, repo.keys)
+}
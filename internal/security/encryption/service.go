@@ -0,0 +1,107 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+)
+
+var ErrDecrypt = errors.New("failed to decrypt value")
+
+type Service struct {
+	PreviousSecret string
+	CurrentSecret  string
+}
+
+func NewService(settings settings.Settings) *Service {
+	return &Service{
+		PreviousSecret: settings.Database.Secrets.Previous,
+		CurrentSecret:  settings.Database.Secrets.Current,
+	}
+}
+
+func (s *Service) Encrypt(plaintext string) (string, error) {
+	aead, err := newAEAD(s.CurrentSecret)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt tenta a chave atual e depois a anterior; stale indica que o valor
+// foi cifrado com a chave anterior e deve ser cifrado novamente
+func (s *Service) Decrypt(ciphertext string) (plaintext string, stale bool, err error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", false, ErrDecrypt
+	}
+
+	for i, secret := range []string{s.CurrentSecret, s.PreviousSecret} {
+		aead, err := newAEAD(secret)
+		if err != nil {
+			return "", false, err
+		}
+
+		if len(sealed) < aead.NonceSize() {
+			return "", false, ErrDecrypt
+		}
+
+		opened, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+		if err == nil {
+			return string(opened), i > 0, nil
+		}
+	}
+
+	return "", false, ErrDecrypt
+}
+
+// Digest calcula o HMAC-SHA256 de value com a chave atual, para valores que só precisam
+// ser comparados, como códigos de recuperação; sem a chave, um vazamento do banco não
+// permite testar candidatos por força bruta
+func (s *Service) Digest(value string) string {
+	return digest(s.CurrentSecret, value)
+}
+
+// Digests retorna o digest com a chave atual e com a anterior, para buscar valores
+// guardados antes da rotação
+func (s *Service) Digests(value string) []string {
+	digests := []string{digest(s.CurrentSecret, value)}
+	if s.PreviousSecret != "" && s.PreviousSecret != s.CurrentSecret {
+		digests = append(digests, digest(s.PreviousSecret, value))
+	}
+	return digests
+}
+
+// digest deriva uma chave própria para o HMAC, separada da chave de cifragem
+func digest(secret, value string) string {
+	key := sha256.Sum256([]byte("digest:" + secret))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newAEAD(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,72 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_EncryptDecrypt(t *testing.T) {
+	service := &Service{CurrentSecret: "current", PreviousSecret: "previous"}
+
+	ciphertext, err := service.Encrypt("totp-secret")
+	require.NoError(t, err)
+	require.NotContains(t, ciphertext, "totp-secret")
+
+	again, err := service.Encrypt("totp-secret")
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext, again)
+
+	plaintext, stale, err := service.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "totp-secret", plaintext)
+	require.False(t, stale)
+}
+
+func TestService_DecryptRotatedKey(t *testing.T) {
+	old := &Service{CurrentSecret: "previous"}
+	ciphertext, err := old.Encrypt("totp-secret")
+	require.NoError(t, err)
+
+	plaintext, stale, err := (&Service{CurrentSecret: "current", PreviousSecret: "previous"}).Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "totp-secret", plaintext)
+	require.True(t, stale)
+
+	_, _, err = (&Service{CurrentSecret: "current", PreviousSecret: "other"}).Decrypt(ciphertext)
+	require.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestService_DecryptTampered(t *testing.T) {
+	service := &Service{CurrentSecret: "current", PreviousSecret: "previous"}
+	ciphertext, err := service.Encrypt("totp-secret")
+	require.NoError(t, err)
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	require.NoError(t, err)
+
+	for _, i := range []int{0, len(sealed) / 2, len(sealed) - 1} {
+		tampered := append([]byte(nil), sealed...)
+		tampered[i] ^= 0x01
+		_, _, err := service.Decrypt(base64.StdEncoding.EncodeToString(tampered))
+		require.ErrorIs(t, err, ErrDecrypt)
+	}
+
+	for _, invalid := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short")), ""} {
+		_, _, err := service.Decrypt(invalid)
+		require.ErrorIs(t, err, ErrDecrypt)
+	}
+}
+
+func TestService_Digest(t *testing.T) {
+	service := &Service{CurrentSecret: "current", PreviousSecret: "previous"}
+
+	require.Equal(t, service.Digest("abcd-efgh"), service.Digest("abcd-efgh"))
+	require.NotEqual(t, service.Digest("abcd-efgh"), service.Digest("abcd-efgi"))
+	require.NotEqual(t, service.Digest("abcd-efgh"), (&Service{CurrentSecret: "other"}).Digest("abcd-efgh"))
+
+	rotated := &Service{CurrentSecret: "next", PreviousSecret: "current"}
+	require.Equal(t, []string{rotated.Digest("abcd-efgh"), service.Digest("abcd-efgh")}, rotated.Digests("abcd-efgh"))
+	require.Len(t, (&Service{CurrentSecret: "current"}).Digests("abcd-efgh"), 1)
+}
@@ -1,38 +1,259 @@
 package hash
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/platform/tracing"
 	"github.com/juliovcruz/user-register/internal/settings"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const argon2idPrefix = "$argon2id$"
+
+var (
+	ErrInvalidHash     = errors.New("invalid password hash")
+	ErrInvalidSettings = errors.New("invalid hashing settings")
+)
+
+type metricsRecorder interface {
+	ObserveHash(algorithm, operation string, start time.Time)
+}
+
 type Service struct {
 	PreviousSecret string
 	CurrentSecret  string
+	PreviousKeyID  string
+	CurrentKeyID   string
+	Settings       settings.Hashing
+	Metrics        metricsRecorder
 }
 
-func NewService(settings settings.Settings) *Service {
+// Secret indica qual pepper foi usado para gerar um hash
+type Secret string
+
+const (
+	SecretCurrent  Secret = "current"
+	SecretPrevious Secret = "previous"
+	SecretLegacy   Secret = "legacy"
+	SecretUnknown  Secret = "unknown"
+)
+
+// Result informa se a senha confere, qual pepper a validou e se o hash armazenado
+// deve ser refeito com o algoritmo, os parâmetros e o pepper atuais
+type Result struct {
+	Valid       bool
+	Secret      Secret
+	NeedsRehash bool
+}
+
+func NewService(settings settings.Settings, metrics metricsRecorder) *Service {
 	return &Service{
 		PreviousSecret: settings.Database.Secrets.Previous,
 		CurrentSecret:  settings.Database.Secrets.Current,
+		PreviousKeyID:  settings.Database.Secrets.PreviousID,
+		CurrentKeyID:   settings.Database.Secrets.CurrentID,
+		Settings:       settings.Hashing,
+		Metrics:        metrics,
+	}
+}
+
+// Create gera um hash argon2id no formato
+// $argon2id$v=19$m=<memória>,t=<iterações>,p=<paralelismo>,k=<pepper>$<salt>$<hash>
+func (s *Service) Create(ctx context.Context, password string) (string, error) {
+	if s.Settings.Argon2Iterations < 1 || s.Settings.Argon2Parallelism < 1 || s.Settings.KeyLength < 1 ||
+		s.Settings.SaltLength < 1 || s.Settings.Argon2Memory < 8*uint32(s.Settings.Argon2Parallelism) || !validKeyID(s.CurrentKeyID) {
+		return "", ErrInvalidSettings
+	}
+	defer s.Metrics.ObserveHash("argon2id", "create", time.Now())
+	_, span := tracing.Start(ctx, "hash.Create", attribute.String("hash.algorithm", "argon2id"))
+	defer span.End()
+
+	salt := make([]byte, s.Settings.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	params := argon2Params{
+		Memory:      s.Settings.Argon2Memory,
+		Iterations:  s.Settings.Argon2Iterations,
+		Parallelism: s.Settings.Argon2Parallelism,
+		KeyID:       s.CurrentKeyID,
 	}
+	key := params.derive(pepper(s.CurrentSecret, password), salt, s.Settings.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$%s$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		params.encode(),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
-func (s *Service) Create(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password+s.CurrentSecret), bcrypt.DefaultCost)
+func (s *Service) Verify(ctx context.Context, inputPassword, password string) Result {
+	if strings.HasPrefix(password, argon2idPrefix) {
+		defer s.Metrics.ObserveHash("argon2id", "verify", time.Now())
+		_, span := tracing.Start(ctx, "hash.Verify", attribute.String("hash.algorithm", "argon2id"))
+		defer span.End()
+		return s.verifyArgon2id(inputPassword, password)
+	}
+
+	defer s.Metrics.ObserveHash("bcrypt", "verify", time.Now())
+	_, span := tracing.Start(ctx, "hash.Verify", attribute.String("hash.algorithm", "bcrypt"))
+	defer span.End()
+	return s.verifyBcrypt(inputPassword, password)
+}
+
+func (s *Service) verifyArgon2id(inputPassword, password string) Result {
+	params, salt, key, err := parseArgon2id(password)
 	if err != nil {
-		return "", err
+		return Result{}
+	}
+
+	matched := s.secretByKeyID(params.KeyID)
+	if matched == SecretUnknown {
+		return Result{}
+	}
+
+	secret := s.CurrentSecret
+	if matched == SecretPrevious {
+		secret = s.PreviousSecret
+	}
+
+	derived := params.derive(pepper(secret, inputPassword), salt, uint32(len(key)))
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return Result{}
+	}
+
+	current := argon2Params{
+		Memory:      s.Settings.Argon2Memory,
+		Iterations:  s.Settings.Argon2Iterations,
+		Parallelism: s.Settings.Argon2Parallelism,
+		KeyID:       s.CurrentKeyID,
+	}
+
+	return Result{
+		Valid:       true,
+		Secret:      matched,
+		NeedsRehash: params != current || uint32(len(key)) != s.Settings.KeyLength,
+	}
+}
+
+// SecretOf identifica o pepper de um hash armazenado sem precisar da senha. Hashes
+// bcrypt legados não guardam essa informação e são reportados como SecretLegacy
+func (s *Service) SecretOf(password string) Secret {
+	if strings.HasPrefix(password, argon2idPrefix) {
+		params, _, _, err := parseArgon2id(password)
+		if err != nil {
+			return SecretUnknown
+		}
+		return s.secretByKeyID(params.KeyID)
+	}
+
+	if _, err := bcrypt.Cost([]byte(password)); err == nil {
+		return SecretLegacy
+	}
+
+	return SecretUnknown
+}
+
+func (s *Service) secretByKeyID(id string) Secret {
+	switch {
+	case id == "":
+		return SecretUnknown
+	case id == s.CurrentKeyID:
+		return SecretCurrent
+	case id == s.PreviousKeyID:
+		return SecretPrevious
+	default:
+		return SecretUnknown
 	}
-	return string(hashedPassword), nil
 }
 
-func (s *Service) IsValid(inputPassword, password string) bool {
-	secrets := []string{s.CurrentSecret, s.PreviousSecret}
+// verifyBcrypt aceita apenas os hashes legados, gerados com o pepper concatenado à
+// senha, e sempre pede um novo hash para migrá-los para argon2id
+func (s *Service) verifyBcrypt(inputPassword, password string) Result {
+	secrets := map[Secret]string{SecretCurrent: s.CurrentSecret, SecretPrevious: s.PreviousSecret}
 
-	for _, secret := range secrets {
-		if err := bcrypt.CompareHashAndPassword([]byte(password), []byte(inputPassword+secret)); err == nil {
-			return true
+	for _, matched := range []Secret{SecretCurrent, SecretPrevious} {
+		if err := bcrypt.CompareHashAndPassword([]byte(password), []byte(inputPassword+secrets[matched])); err == nil {
+			return Result{Valid: true, Secret: matched, NeedsRehash: true}
 		}
 	}
 
-	return false
+	return Result{}
+}
+
+type argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	KeyID       string
+}
+
+func (p argon2Params) derive(password, salt []byte, keyLength uint32) []byte {
+	return argon2.IDKey(password, salt, p.Iterations, p.Memory, p.Parallelism, keyLength)
+}
+
+func (p argon2Params) encode() string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d,k=%s", p.Memory, p.Iterations, p.Parallelism, p.KeyID)
+}
+
+func parseArgon2id(password string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(password, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var keyID string
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d,k=%s", &params.Memory, &params.Iterations, &params.Parallelism, &keyID); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return params, nil, nil, ErrInvalidHash
+	}
+	params.KeyID = keyID
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	return params, salt, key, nil
+}
+
+// pepper aplica o segredo com HMAC, o que mantém o tamanho da entrada fixo
+// independente do tamanho da senha
+func pepper(secret, password string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// validKeyID aceita IDs que não quebram o formato do hash
+func validKeyID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, "$, \t\n")
 }
@@ -0,0 +1,151 @@
+package hash
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type metricsRecorderMock struct {
+	observed []string
+}
+
+func (m *metricsRecorderMock) ObserveHash(algorithm, operation string, start time.Time) {
+	m.observed = append(m.observed, algorithm+":"+operation)
+}
+
+func newTestService(current, previous string) *Service {
+	return &Service{
+		CurrentSecret:  current,
+		PreviousSecret: previous,
+		CurrentKeyID:   current + "-id",
+		PreviousKeyID:  previous + "-id",
+		Metrics:        &metricsRecorderMock{},
+		Settings: settings.Hashing{
+			Argon2Memory:      1024,
+			Argon2Iterations:  1,
+			Argon2Parallelism: 1,
+			SaltLength:        16,
+			KeyLength:         32,
+		},
+	}
+}
+
+func TestService_CreateAndVerify(t *testing.T) {
+	service := newTestService("current", "previous")
+
+	hashed, err := service.Create(context.Background(), "password")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hashed, "$argon2id$v=19$m=1024,t=1,p=1,k=current-id$"))
+
+	require.Equal(t, Result{Valid: true, Secret: SecretCurrent}, service.Verify(context.Background(), "password", hashed))
+	require.Equal(t, Result{}, service.Verify(context.Background(), "wrong", hashed))
+	require.Equal(t, Result{}, service.Verify(context.Background(), "password", "$argon2id$invalid"))
+}
+
+func TestService_ObservesHashDuration(t *testing.T) {
+	service := newTestService("current", "previous")
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"+"previous"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	hashed, err := service.Create(context.Background(), "password")
+	require.NoError(t, err)
+	service.Verify(context.Background(), "password", hashed)
+	service.Verify(context.Background(), "password", string(legacy))
+
+	require.Equal(t, []string{"argon2id:create", "argon2id:verify", "bcrypt:verify"}, service.Metrics.(*metricsRecorderMock).observed)
+}
+
+func TestService_LongPasswordsAreNotTruncated(t *testing.T) {
+	service := newTestService("current", "previous")
+	base := strings.Repeat("a", 100)
+
+	hashed, err := service.Create(context.Background(), base+"1")
+	require.NoError(t, err)
+
+	require.True(t, service.Verify(context.Background(), base+"1", hashed).Valid)
+	require.False(t, service.Verify(context.Background(), base+"2", hashed).Valid)
+}
+
+func TestService_VerifyNeedsRehash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"+"previous"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	previousPepper, err := newTestService("previous", "").Create(context.Background(), "password")
+	require.NoError(t, err)
+
+	outdated := newTestService("current", "previous")
+	outdated.Settings.Argon2Iterations = 2
+	outdatedParams, err := outdated.Create(context.Background(), "password")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		hashed         string
+		expectedSecret Secret
+		storedSecret   Secret
+	}{
+		{name: "Legacy bcrypt hash", hashed: string(legacy), expectedSecret: SecretPrevious, storedSecret: SecretLegacy},
+		{name: "Previous pepper", hashed: previousPepper, expectedSecret: SecretPrevious, storedSecret: SecretPrevious},
+		{name: "Outdated argon2id parameters", hashed: outdatedParams, expectedSecret: SecretCurrent, storedSecret: SecretCurrent},
+	}
+
+	service := newTestService("current", "previous")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, Result{Valid: true, Secret: tt.expectedSecret, NeedsRehash: true}, service.Verify(context.Background(), "password", tt.hashed))
+			require.Equal(t, Result{}, service.Verify(context.Background(), "wrong", tt.hashed))
+			require.Equal(t, tt.storedSecret, service.SecretOf(tt.hashed))
+		})
+	}
+}
+
+func TestService_CreateInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *Service)
+	}{
+		{name: "Zero salt length", change: func(s *Service) { s.Settings.SaltLength = 0 }},
+		{name: "Zero memory", change: func(s *Service) { s.Settings.Argon2Memory = 0 }},
+		{name: "Zero iterations", change: func(s *Service) { s.Settings.Argon2Iterations = 0 }},
+		{name: "Missing key ID", change: func(s *Service) { s.CurrentKeyID = "" }},
+		{name: "Key ID breaking the format", change: func(s *Service) { s.CurrentKeyID = "v1$x" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestService("current", "previous")
+			tt.change(service)
+
+			_, err := service.Create(context.Background(), "password")
+			require.ErrorIs(t, err, ErrInvalidSettings)
+		})
+	}
+}
+
+func TestService_KeyID(t *testing.T) {
+	service := newTestService("current", "previous")
+
+	hashed, err := service.Create(context.Background(), "password")
+	require.NoError(t, err)
+	require.Contains(t, hashed, "k=current-id$")
+
+	// na rotação o ID atual passa a ser o anterior
+	rotated := &Service{CurrentSecret: "next", PreviousSecret: "current", CurrentKeyID: "next-id", PreviousKeyID: "current-id", Settings: service.Settings, Metrics: service.Metrics}
+	require.Equal(t, Result{Valid: true, Secret: SecretPrevious, NeedsRehash: true}, rotated.Verify(context.Background(), "password", hashed))
+}
+
+func TestService_VerifyUnknownPepper(t *testing.T) {
+	hashed, err := newTestService("retired", "").Create(context.Background(), "password")
+	require.NoError(t, err)
+
+	service := newTestService("current", "previous")
+	require.Equal(t, Result{}, service.Verify(context.Background(), "password", hashed))
+	require.Equal(t, SecretUnknown, service.SecretOf(hashed))
+	require.Equal(t, SecretUnknown, service.SecretOf(""))
+}
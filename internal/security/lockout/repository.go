@@ -0,0 +1,70 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &sqliteRepository{db: db}
+}
+
+func (r *sqliteRepository) Get(ctx context.Context, key string) (Attempt, error) {
+	attempt := Attempt{Key: key}
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE key = ?
+	`, key).Scan(&attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return attempt, nil
+	} else if err != nil {
+		return attempt, fmt.Errorf("failed to get login attempt: %w", err)
+	}
+
+	attempt.LockedUntil = lockedUntil.Time
+	return attempt, nil
+}
+
+func (r *sqliteRepository) Increment(ctx context.Context, key string, failedAt, windowStart time.Time) (Attempt, error) {
+	attempt := Attempt{Key: key, LastFailureAt: failedAt}
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO login_attempts (key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+			locked_until = CASE WHEN last_failure_at < ? THEN NULL ELSE locked_until END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures, locked_until;
+	`, key, failedAt, windowStart, windowStart).Scan(&attempt.Failures, &lockedUntil)
+	if err != nil {
+		return attempt, fmt.Errorf("failed to register login failure: %w", err)
+	}
+
+	attempt.LockedUntil = lockedUntil.Time
+	return attempt, nil
+}
+
+func (r *sqliteRepository) Lock(ctx context.Context, key string, lockedUntil time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE login_attempts SET locked_until = ? WHERE key = ?`, lockedUntil, key)
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	return nil
+}
+
+func (r *sqliteRepository) Delete(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = ?`, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete login attempts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+)
+
+type Repository interface {
+	Get(ctx context.Context, key string) (Attempt, error)
+	Increment(ctx context.Context, key string, failedAt, windowStart time.Time) (Attempt, error)
+	Lock(ctx context.Context, key string, lockedUntil time.Time) error
+	Delete(ctx context.Context, key string) error
+}
+
+type Service struct {
+	repo     Repository
+	settings settings.Lockout
+	now      func() time.Time
+}
+
+func NewService(repo Repository, settings settings.Lockout) *Service {
+	return &Service{repo: repo, settings: settings, now: time.Now}
+}
+
+func accountKey(email string) string {
+	return "account:" + email
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (s *Service) Check(ctx context.Context, email, ip string) error {
+	var retryAfter time.Duration
+	for _, key := range s.keys(email, ip) {
+		attempt, err := s.repo.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if wait := s.wait(attempt, key == accountKey(email)); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+func (s *Service) RegisterFailure(ctx context.Context, email, ip string) error {
+	now := s.now()
+	windowStart := now.Add(-s.settings.FailureWindow)
+
+	thresholds := map[string]int{
+		accountKey(email): s.settings.AccountThreshold,
+		ipKey(ip):         s.settings.IPThreshold,
+	}
+
+	for _, key := range s.keys(email, ip) {
+		attempt, err := s.repo.Increment(ctx, key, now, windowStart)
+		if err != nil {
+			return err
+		}
+
+		if threshold := thresholds[key]; threshold > 0 && attempt.Failures >= threshold && attempt.LockedUntil.Before(now) {
+			if err := s.repo.Lock(ctx, key, now.Add(s.settings.LockoutDuration)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) RegisterSuccess(ctx context.Context, email string) error {
+	return s.repo.Delete(ctx, accountKey(email))
+}
+
+func (s *Service) Unlock(ctx context.Context, email string) error {
+	return s.repo.Delete(ctx, accountKey(email))
+}
+
+func (s *Service) keys(email, ip string) []string {
+	keys := []string{accountKey(email)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
+
+func (s *Service) wait(attempt Attempt, progressive bool) time.Duration {
+	now := s.now()
+
+	if attempt.LockedUntil.After(now) {
+		return attempt.LockedUntil.Sub(now)
+	}
+
+	if !progressive || attempt.Failures == 0 || attempt.LastFailureAt.Before(now.Add(-s.settings.FailureWindow)) {
+		return 0
+	}
+
+	if wait := attempt.LastFailureAt.Add(s.delay(attempt.Failures)).Sub(now); wait > 0 {
+		return wait
+	}
+
+	return 0
+}
+
+func (s *Service) delay(failures int) time.Duration {
+	extra := failures - s.settings.FreeAttempts
+	if extra <= 0 || s.settings.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := s.settings.BaseDelay
+	for i := 1; i < extra && delay < s.settings.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if s.settings.MaxDelay > 0 && delay > s.settings.MaxDelay {
+		delay = s.settings.MaxDelay
+	}
+
+	return delay
+}
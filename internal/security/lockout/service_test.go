@@ -0,0 +1,95 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+)
+
+type repositoryMock struct {
+	attempts map[string]Attempt
+}
+
+func (r *repositoryMock) Get(ctx context.Context, key string) (Attempt, error) {
+	attempt, found := r.attempts[key]
+	if !found {
+		return Attempt{Key: key}, nil
+	}
+	return attempt, nil
+}
+
+func (r *repositoryMock) Increment(ctx context.Context, key string, failedAt, windowStart time.Time) (Attempt, error) {
+	attempt := r.attempts[key]
+	if attempt.LastFailureAt.Before(windowStart) {
+		attempt = Attempt{Key: key}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = failedAt
+	r.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (r *repositoryMock) Lock(ctx context.Context, key string, lockedUntil time.Time) error {
+	attempt := r.attempts[key]
+	attempt.LockedUntil = lockedUntil
+	r.attempts[key] = attempt
+	return nil
+}
+
+func (r *repositoryMock) Delete(ctx context.Context, key string) error {
+	delete(r.attempts, key)
+	return nil
+}
+
+func TestService_Lockout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := NewService(&repositoryMock{attempts: map[string]Attempt{}}, settings.Lockout{
+		AccountThreshold: 5,
+		IPThreshold:      100,
+		FreeAttempts:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Second * 4,
+		FailureWindow:    time.Minute * 15,
+		LockoutDuration:  time.Minute * 10,
+	})
+	service.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	fail := func() {
+		require.NoError(t, service.RegisterFailure(ctx, "user@example.com", "10.0.0.1"))
+	}
+	retryAfter := func() time.Duration {
+		err := service.Check(ctx, "user@example.com", "10.0.0.1")
+		if err == nil {
+			return 0
+		}
+		var lockedErr *LockedError
+		require.ErrorAs(t, err, &lockedErr)
+		return lockedErr.RetryAfter
+	}
+
+	fail()
+	fail()
+	require.Zero(t, retryAfter(), "free attempts should not be delayed")
+
+	fail()
+	require.Equal(t, time.Second, retryAfter())
+
+	fail()
+	require.Equal(t, time.Second*2, retryAfter())
+
+	fail()
+	require.Equal(t, time.Minute*10, retryAfter(), "threshold should lock the account")
+
+	now = now.Add(time.Minute * 11)
+	require.Equal(t, time.Duration(0), retryAfter(), "max delay already elapsed after lockout")
+
+	require.NoError(t, service.Unlock(ctx, "user@example.com"))
+	fail()
+	require.Zero(t, retryAfter())
+
+	require.NoError(t, service.Check(ctx, "other@example.com", "10.0.0.2"))
+}
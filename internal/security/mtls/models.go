@@ -0,0 +1,24 @@
+package mtls
+
+import "errors"
+
+var (
+	ErrUnknownIdentity   = errors.New("client certificate is not mapped to a service identity")
+	ErrInsufficientScope = errors.New("service identity does not have the required scope")
+)
+
+// Identity é o serviço autenticado por certificado de cliente
+type Identity struct {
+	Name    string   `json:"name"`
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+}
+
+func (i Identity) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package mtls
+
+import (
+	"crypto/x509"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+)
+
+type Service struct {
+	identities map[string]Identity
+}
+
+func NewService(identities []settings.ClientIdentity) *Service {
+	service := &Service{identities: make(map[string]Identity, len(identities))}
+	for _, identity := range identities {
+		service.identities[identity.Subject] = Identity{
+			Name:    identity.Name,
+			Subject: identity.Subject,
+			Scopes:  identity.Scopes,
+		}
+	}
+	return service
+}
+
+// Authenticate mapeia um certificado já verificado pelo handshake TLS para a identidade
+// configurada. O subject pode ser o CN, um SAN DNS ou um SAN URI, como um ID SPIFFE
+func (s *Service) Authenticate(certificate *x509.Certificate, scope string) (Identity, error) {
+	for _, subject := range subjects(certificate) {
+		identity, found := s.identities[subject]
+		if !found {
+			continue
+		}
+
+		if !identity.HasScope(scope) {
+			return Identity{}, ErrInsufficientScope
+		}
+		return identity, nil
+	}
+
+	return Identity{}, ErrUnknownIdentity
+}
+
+func subjects(certificate *x509.Certificate) []string {
+	var subjects []string
+	for _, uri := range certificate.URIs {
+		subjects = append(subjects, uri.String())
+	}
+	subjects = append(subjects, certificate.DNSNames...)
+	if certificate.Subject.CommonName != "" {
+		subjects = append(subjects, certificate.Subject.CommonName)
+	}
+	return subjects
+}
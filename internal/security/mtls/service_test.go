@@ -0,0 +1,62 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Authenticate(t *testing.T) {
+	service := NewService([]settings.ClientIdentity{
+		{Name: "billing", Subject: "billing.internal", Scopes: []string{"users:read"}},
+		{Name: "reports", Subject: "spiffe://example.org/reports"},
+	})
+
+	spiffeID, err := url.Parse("spiffe://example.org/reports")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		certificate   *x509.Certificate
+		expected      string
+		expectedError error
+	}{
+		{
+			name:        "Common name",
+			certificate: &x509.Certificate{Subject: pkix.Name{CommonName: "billing.internal"}},
+			expected:    "billing",
+		},
+		{
+			name:        "DNS SAN",
+			certificate: &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, DNSNames: []string{"billing.internal"}},
+			expected:    "billing",
+		},
+		{
+			name:          "URI SAN without the scope",
+			certificate:   &x509.Certificate{URIs: []*url.URL{spiffeID}},
+			expectedError: ErrInsufficientScope,
+		},
+		{
+			name:          "Unknown subject",
+			certificate:   &x509.Certificate{Subject: pkix.Name{CommonName: "unknown.internal"}},
+			expectedError: ErrUnknownIdentity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := service.Authenticate(tt.certificate, "users:read")
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, identity.Name)
+		})
+	}
+}
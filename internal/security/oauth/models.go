@@ -0,0 +1,212 @@
+package oauth
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrClientNotFound  = errors.New("oauth client not found")
+	ErrInvalidClient   = errors.New("invalid oauth client")
+	ErrCodeNotFound    = errors.New("authorization code not found")
+	ErrCodeAlreadyUsed = errors.New("authorization code already used")
+	ErrTokenNotFound   = errors.New("refresh token not found")
+	ErrConsentNotFound = errors.New("consent not found")
+)
+
+// Error segue o formato de erro da RFC 6749; Status é o código HTTP usado pelo endpoint de token
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func newError(status int, code, description string) *Error {
+	return &Error{Code: code, Description: description, Status: status}
+}
+
+type GrantType string
+
+const (
+	GrantAuthorizationCode GrantType = "authorization_code"
+	GrantRefreshToken      GrantType = "refresh_token"
+	GrantClientCredentials GrantType = "client_credentials"
+)
+
+var grantTypes = map[GrantType]struct{}{
+	GrantAuthorizationCode: {},
+	GrantRefreshToken:      {},
+	GrantClientCredentials: {},
+}
+
+const (
+	ScopeUsersRead = "users:read"
+	ScopeOpenID    = "openid"
+	ScopeProfile   = "profile"
+	ScopeEmail     = "email"
+	ScopeAddress   = "address"
+)
+
+var scopes = map[string]struct{}{
+	ScopeUsersRead: {},
+	ScopeOpenID:    {},
+	ScopeProfile:   {},
+	ScopeEmail:     {},
+	ScopeAddress:   {},
+}
+
+// Scopes lista os escopos aceitos pelo servidor
+func Scopes() []string {
+	return []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeAddress, ScopeUsersRead}
+}
+
+type Client struct {
+	ID           string      `json:"client_id"`
+	Name         string      `json:"name"`
+	RedirectURIs []string    `json:"redirect_uris"`
+	GrantTypes   []GrantType `json:"grant_types"`
+	Scopes       []string    `json:"scopes"`
+	Confidential bool        `json:"confidential"`
+	CreatedAt    time.Time   `json:"created_at"`
+
+	SecretHash string `json:"-"`
+}
+
+func (c Client) AllowsGrant(grant GrantType) bool {
+	for _, g := range c.GrantTypes {
+		if g == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRedirectURI compara a URI inteira, sem aceitar prefixos ou curingas
+func (c Client) AllowsRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateClient struct {
+	Name         string      `json:"name" validate:"required,min=3,max=100" example:"Billing"`
+	RedirectURIs []string    `json:"redirect_uris" validate:"dive,url" example:"https://billing.example.com/callback"`
+	GrantTypes   []GrantType `json:"grant_types" validate:"required,min=1" example:"authorization_code"`
+	Scopes       []string    `json:"scopes" validate:"required,min=1" example:"users:read"`
+	Confidential bool        `json:"confidential" example:"true"`
+}
+
+// CreatedClient é retornado apenas no cadastro, única vez em que o segredo fica visível
+type CreatedClient struct {
+	Client
+	Secret string `json:"client_secret,omitempty"`
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Nonce               string `json:"nonce"`
+}
+
+type ConsentDecision struct {
+	AuthorizeRequest
+	Approved bool `json:"approved"`
+}
+
+// AuthorizeResult traz a URL de retorno ao cliente ou, quando o usuário ainda não
+// consentiu com os escopos pedidos, os dados para exibir a tela de consentimento
+type AuthorizeResult struct {
+	RedirectURL     string   `json:"redirect_url,omitempty"`
+	ConsentRequired bool     `json:"consent_required"`
+	ClientID        string   `json:"client_id,omitempty"`
+	ClientName      string   `json:"client_name,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
+}
+
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        int64
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	Nonce         string
+	AuthTime      time.Time
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+}
+
+// RefreshToken guarda em GrantID o hash do código de autorização de origem, mantido na rotação
+type RefreshToken struct {
+	TokenHash string
+	ClientID  string
+	UserID    int64
+	GrantID   string
+	Scopes    []string
+	AuthTime  time.Time
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+type Consent struct {
+	UserID    int64
+	ClientID  string
+	Scopes    []string
+	GrantedAt time.Time
+}
+
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// AccessClaims descreve um access token emitido pelo servidor OAuth. Subject é o ID do
+// usuário ou, no client_credentials, o próprio client_id. GrantID identifica o código de
+// autorização de origem, para que o token deixe de valer se o código for reapresentado
+type AccessClaims struct {
+	Subject   string
+	ClientID  string
+	GrantID   string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// IDTokenClaims são os dados da autorização que entram no ID token do OpenID Connect
+type IDTokenClaims struct {
+	ClientID string
+	Nonce    string
+	AuthTime time.Time
+	Scopes   []string
+}
@@ -0,0 +1,351 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const clientColumns = `id, name, secret_hash, redirect_uris, grant_types, scopes, created_at`
+
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &sqliteRepository{db: db}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// listas são gravadas separadas por espaço, o mesmo formato do parâmetro scope da RFC 6749
+func join[T ~string](values []T) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		parts = append(parts, string(value))
+	}
+	return strings.Join(parts, " ")
+}
+
+func split[T ~string](value string) []T {
+	values := []T{}
+	for _, part := range strings.Fields(value) {
+		values = append(values, T(part))
+	}
+	return values
+}
+
+func scanClient(row rowScanner) (Client, error) {
+	var client Client
+	var secretHash sql.NullString
+	var redirectURIs, grants, clientScopes string
+	err := row.Scan(&client.ID, &client.Name, &secretHash, &redirectURIs, &grants, &clientScopes, &client.CreatedAt)
+	if err != nil {
+		return client, err
+	}
+
+	client.SecretHash = secretHash.String
+	client.Confidential = secretHash.Valid
+	client.RedirectURIs = split[string](redirectURIs)
+	client.GrantTypes = split[GrantType](grants)
+	client.Scopes = split[string](clientScopes)
+
+	return client, nil
+}
+
+func (r *sqliteRepository) CreateClient(ctx context.Context, client Client) error {
+	var secretHash sql.NullString
+	if client.Confidential {
+		secretHash = sql.NullString{String: client.SecretHash, Valid: true}
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, grant_types, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, client.ID, client.Name, secretHash, join(client.RedirectURIs), join(client.GrantTypes), join(client.Scopes), client.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create oauth client: %w", err)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) GetClient(ctx context.Context, id string) (Client, error) {
+	client, err := scanClient(r.db.QueryRowContext(ctx, `
+		SELECT `+clientColumns+` FROM oauth_clients WHERE id = ? AND deleted_at IS NULL
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return client, ErrClientNotFound
+	} else if err != nil {
+		return client, fmt.Errorf("failed to get oauth client: %w", err)
+	}
+
+	return client, nil
+}
+
+func (r *sqliteRepository) GetClients(ctx context.Context) ([]Client, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+clientColumns+` FROM oauth_clients WHERE deleted_at IS NULL ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth clients: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []Client{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan oauth client: %w", err)
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+// DeleteClient desativa o cliente e revoga os refresh tokens emitidos para ele
+func (r *sqliteRepository) DeleteClient(ctx context.Context, id string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE oauth_clients SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, at, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth client: %w", err)
+	}
+	if err := requireRow(res, ErrClientNotFound); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE oauth_refresh_tokens SET revoked_at = ? WHERE client_id = ? AND revoked_at IS NULL`, at, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) CreateCode(ctx context.Context, code AuthorizationCode) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, nonce, auth_time, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, join(code.Scopes), code.CodeChallenge, code.Nonce, code.AuthTime,
+		code.CreatedAt, code.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create authorization code: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeCode marca o código como usado e o retorna. Um código já consumido é retornado
+// com ErrCodeAlreadyUsed para que os tokens emitidos a partir dele sejam revogados
+func (r *sqliteRepository) ConsumeCode(ctx context.Context, codeHash string, at time.Time) (AuthorizationCode, error) {
+	var code AuthorizationCode
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return code, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE oauth_authorization_codes SET consumed_at = ? WHERE code_hash = ? AND consumed_at IS NULL
+	`, at, codeHash)
+	if err != nil {
+		return code, fmt.Errorf("failed to consume authorization code: %w", err)
+	}
+	consumed := requireRow(res, ErrCodeAlreadyUsed)
+	if consumed != nil && !errors.Is(consumed, ErrCodeAlreadyUsed) {
+		return code, consumed
+	}
+
+	var codeScopes string
+	var authTime sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, nonce, auth_time, created_at, expires_at
+		FROM oauth_authorization_codes WHERE code_hash = ?
+	`, codeHash).Scan(&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, &codeScopes,
+		&code.CodeChallenge, &code.Nonce, &authTime, &code.CreatedAt, &code.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return code, ErrCodeNotFound
+	} else if err != nil {
+		return code, fmt.Errorf("failed to get authorization code: %w", err)
+	}
+	code.Scopes = split[string](codeScopes)
+	code.AuthTime = authTime.Time
+
+	if consumed != nil {
+		return code, consumed
+	}
+
+	return code, tx.Commit()
+}
+
+// RevokeGrant revoga o código de autorização e todos os refresh tokens emitidos a partir dele
+func (r *sqliteRepository) RevokeGrant(ctx context.Context, codeHash string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE oauth_authorization_codes SET revoked_at = ? WHERE code_hash = ? AND revoked_at IS NULL
+	`, at, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke authorization code: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE oauth_refresh_tokens SET revoked_at = ? WHERE grant_id = ? AND revoked_at IS NULL
+	`, at, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) IsGrantRevoked(ctx context.Context, codeHash string) (bool, error) {
+	var revokedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT revoked_at FROM oauth_authorization_codes WHERE code_hash = ?
+	`, codeHash).Scan(&revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get authorization code: %w", err)
+	}
+
+	return revokedAt.Valid, nil
+}
+
+func (r *sqliteRepository) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	return createRefreshToken(ctx, r.db, token)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func createRefreshToken(ctx context.Context, db execer, token RefreshToken) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO oauth_refresh_tokens (token_hash, client_id, user_id, grant_id, scopes, auth_time, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, token.TokenHash, token.ClientID, token.UserID, token.GrantID, join(token.Scopes), token.AuthTime, token.CreatedAt,
+		token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	var token RefreshToken
+	var tokenScopes string
+	var authTime sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT token_hash, client_id, user_id, grant_id, scopes, auth_time, created_at, expires_at, revoked_at
+		FROM oauth_refresh_tokens WHERE token_hash = ?
+	`, tokenHash).Scan(&token.TokenHash, &token.ClientID, &token.UserID, &token.GrantID, &tokenScopes,
+		&authTime, &token.CreatedAt, &token.ExpiresAt, &token.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, ErrTokenNotFound
+	} else if err != nil {
+		return token, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	token.Scopes = split[string](tokenScopes)
+	token.AuthTime = authTime.Time
+
+	return token, nil
+}
+
+// RotateRefreshToken revoga o token usado e grava o próximo na mesma transação, de modo
+// que duas requisições concorrentes com o mesmo token não recebem tokens válidos
+func (r *sqliteRepository) RotateRefreshToken(ctx context.Context, tokenHash string, next RefreshToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE oauth_refresh_tokens SET revoked_at = ? WHERE token_hash = ? AND revoked_at IS NULL
+	`, next.CreatedAt, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	if err := requireRow(res, ErrTokenNotFound); err != nil {
+		return err
+	}
+
+	if err := createRefreshToken(ctx, tx, next); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) RevokeRefreshTokens(ctx context.Context, clientID string, userID int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE oauth_refresh_tokens SET revoked_at = ? WHERE client_id = ? AND user_id = ? AND revoked_at IS NULL
+	`, at, clientID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) GetConsent(ctx context.Context, userID int64, clientID string) (Consent, error) {
+	consent := Consent{UserID: userID, ClientID: clientID}
+	var consentScopes string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT scopes, granted_at FROM oauth_consents WHERE user_id = ? AND client_id = ?
+	`, userID, clientID).Scan(&consentScopes, &consent.GrantedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return consent, ErrConsentNotFound
+	} else if err != nil {
+		return consent, fmt.Errorf("failed to get consent: %w", err)
+	}
+	consent.Scopes = split[string](consentScopes)
+
+	return consent, nil
+}
+
+func (r *sqliteRepository) SaveConsent(ctx context.Context, consent Consent) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO oauth_consents (user_id, client_id, scopes, granted_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = excluded.scopes, granted_at = excluded.granted_at
+	`, consent.UserID, consent.ClientID, join(consent.Scopes), consent.GrantedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save consent: %w", err)
+	}
+
+	return nil
+}
+
+func requireRow(res sql.Result, notFound error) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return notFound
+	}
+
+	return nil
+}
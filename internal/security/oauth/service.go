@@ -0,0 +1,646 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/juliovcruz/user-register/internal/users"
+)
+
+const codeChallengeMethodS256 = "S256"
+
+var (
+	ErrInvalidToken      = errors.New("invalid oauth access token")
+	ErrInsufficientScope = errors.New("oauth access token does not have the required scope")
+)
+
+type Repository interface {
+	CreateClient(ctx context.Context, client Client) error
+	GetClient(ctx context.Context, id string) (Client, error)
+	GetClients(ctx context.Context) ([]Client, error)
+	DeleteClient(ctx context.Context, id string, at time.Time) error
+	CreateCode(ctx context.Context, code AuthorizationCode) error
+	ConsumeCode(ctx context.Context, codeHash string, at time.Time) (AuthorizationCode, error)
+	RevokeGrant(ctx context.Context, codeHash string, at time.Time) error
+	IsGrantRevoked(ctx context.Context, codeHash string) (bool, error)
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, tokenHash string, next RefreshToken) error
+	RevokeRefreshTokens(ctx context.Context, clientID string, userID int64, at time.Time) error
+	GetConsent(ctx context.Context, userID int64, clientID string) (Consent, error)
+	SaveConsent(ctx context.Context, consent Consent) error
+}
+
+type tokenService interface {
+	CreateOAuthAccess(claims AccessClaims) (string, error)
+	ParseOAuthAccess(tokenStr string) (AccessClaims, error)
+}
+
+type userService interface {
+	Get(ctx context.Context, id int64) (users.User, error)
+}
+
+type idTokenService interface {
+	CreateIDToken(user users.User, claims IDTokenClaims) (string, error)
+}
+
+type Service struct {
+	repo           Repository
+	tokenService   tokenService
+	userService    userService
+	idTokenService idTokenService
+	settings       settings.OAuth
+}
+
+func NewService(repo Repository, tokenService tokenService, userService userService, idTokenService idTokenService, settings settings.OAuth) *Service {
+	return &Service{
+		repo:           repo,
+		tokenService:   tokenService,
+		userService:    userService,
+		idTokenService: idTokenService,
+		settings:       settings,
+	}
+}
+
+func (s *Service) CreateClient(ctx context.Context, request CreateClient) (CreatedClient, error) {
+	for _, grant := range request.GrantTypes {
+		if _, found := grantTypes[grant]; !found {
+			return CreatedClient{}, fmt.Errorf("%w: unsupported grant type %s", ErrInvalidClient, grant)
+		}
+	}
+
+	for _, scope := range request.Scopes {
+		if _, found := scopes[scope]; !found {
+			return CreatedClient{}, fmt.Errorf("%w: unsupported scope %s", ErrInvalidClient, scope)
+		}
+	}
+
+	client := Client{
+		Name:         request.Name,
+		RedirectURIs: request.RedirectURIs,
+		GrantTypes:   request.GrantTypes,
+		Scopes:       request.Scopes,
+		Confidential: request.Confidential,
+		CreatedAt:    time.Now(),
+	}
+
+	if client.AllowsGrant(GrantAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return CreatedClient{}, fmt.Errorf("%w: authorization_code requires at least one redirect uri", ErrInvalidClient)
+	}
+
+	// sem segredo não há como autenticar o cliente, que agiria em nome de si mesmo
+	if client.AllowsGrant(GrantClientCredentials) && !client.Confidential {
+		return CreatedClient{}, fmt.Errorf("%w: client_credentials requires a confidential client", ErrInvalidClient)
+	}
+
+	id, err := randomString(16)
+	if err != nil {
+		return CreatedClient{}, err
+	}
+	client.ID = id
+
+	var secret string
+	if client.Confidential {
+		if secret, err = randomString(32); err != nil {
+			return CreatedClient{}, err
+		}
+		client.SecretHash = hashSecret(secret)
+	}
+
+	if err := s.repo.CreateClient(ctx, client); err != nil {
+		return CreatedClient{}, err
+	}
+
+	return CreatedClient{Client: client, Secret: secret}, nil
+}
+
+func (s *Service) ListClients(ctx context.Context) ([]Client, error) {
+	return s.repo.GetClients(ctx)
+}
+
+func (s *Service) DeleteClient(ctx context.Context, id string) error {
+	return s.repo.DeleteClient(ctx, id, time.Now())
+}
+
+// Authorize valida o pedido de autorização do usuário autenticado. Erros em client_id ou
+// redirect_uri são retornados e nunca redirecionados; os demais voltam ao cliente na URL.
+// Se o usuário já consentiu com os escopos pedidos o código é emitido direto
+func (s *Service) Authorize(ctx context.Context, user users.User, request AuthorizeRequest) (AuthorizeResult, error) {
+	client, redirectURI, err := s.authorizeClient(ctx, request)
+	if err != nil {
+		return AuthorizeResult{}, err
+	}
+
+	requested, authErr := checkAuthorizeRequest(client, request)
+	if authErr != nil {
+		return AuthorizeResult{RedirectURL: redirectWith(redirectURI, request.State, authErr.query())}, nil
+	}
+
+	consent, err := s.repo.GetConsent(ctx, user.ID, client.ID)
+	if err != nil && !errors.Is(err, ErrConsentNotFound) {
+		return AuthorizeResult{}, err
+	}
+
+	if !contains(consent.Scopes, requested) {
+		return AuthorizeResult{
+			ConsentRequired: true,
+			ClientID:        client.ID,
+			ClientName:      client.Name,
+			Scopes:          requested,
+		}, nil
+	}
+
+	return s.issueCode(ctx, user, client, redirectURI, requested, request)
+}
+
+// Consent registra a decisão do usuário na tela de consentimento e, se aprovada, emite o código
+func (s *Service) Consent(ctx context.Context, user users.User, request AuthorizeRequest, approved bool) (AuthorizeResult, error) {
+	client, redirectURI, err := s.authorizeClient(ctx, request)
+	if err != nil {
+		return AuthorizeResult{}, err
+	}
+
+	requested, authErr := checkAuthorizeRequest(client, request)
+	if authErr == nil && !approved {
+		authErr = newError(400, "access_denied", "the user denied the request")
+	}
+	if authErr != nil {
+		return AuthorizeResult{RedirectURL: redirectWith(redirectURI, request.State, authErr.query())}, nil
+	}
+
+	consent, err := s.repo.GetConsent(ctx, user.ID, client.ID)
+	if err != nil && !errors.Is(err, ErrConsentNotFound) {
+		return AuthorizeResult{}, err
+	}
+
+	consent.Scopes = union(consent.Scopes, requested)
+	consent.GrantedAt = time.Now()
+	if err := s.repo.SaveConsent(ctx, consent); err != nil {
+		return AuthorizeResult{}, err
+	}
+
+	return s.issueCode(ctx, user, client, redirectURI, requested, request)
+}
+
+func (s *Service) authorizeClient(ctx context.Context, request AuthorizeRequest) (Client, string, error) {
+	client, err := s.repo.GetClient(ctx, request.ClientID)
+	if errors.Is(err, ErrClientNotFound) {
+		return Client{}, "", newError(400, "invalid_request", "unknown client_id")
+	}
+	if err != nil {
+		return Client{}, "", err
+	}
+
+	redirectURI := request.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+
+	if !client.AllowsRedirectURI(redirectURI) {
+		return Client{}, "", newError(400, "invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	return client, redirectURI, nil
+}
+
+func checkAuthorizeRequest(client Client, request AuthorizeRequest) ([]string, *Error) {
+	if request.ResponseType != "code" {
+		return nil, newError(400, "unsupported_response_type", "only the code response type is supported")
+	}
+
+	if !client.AllowsGrant(GrantAuthorizationCode) {
+		return nil, newError(400, "unauthorized_client", "client is not allowed to use authorization_code")
+	}
+
+	// PKCE é exigido de todos os clientes, inclusive os confidenciais
+	if request.CodeChallenge == "" {
+		return nil, newError(400, "invalid_request", "code_challenge is required")
+	}
+
+	if request.CodeChallengeMethod != codeChallengeMethodS256 {
+		return nil, newError(400, "invalid_request", "code_challenge_method must be S256")
+	}
+
+	return requestedScopes(client, request.Scope)
+}
+
+func (s *Service) issueCode(ctx context.Context, user users.User, client Client, redirectURI string, scopes []string, request AuthorizeRequest) (AuthorizeResult, error) {
+	code, err := randomString(32)
+	if err != nil {
+		return AuthorizeResult{}, err
+	}
+
+	// guarda a redirect_uri como foi enviada, vazia quando omitida, para conferir no endpoint de token
+	now := time.Now()
+	err = s.repo.CreateCode(ctx, AuthorizationCode{
+		CodeHash:      hashSecret(code),
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectURI:   request.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: request.CodeChallenge,
+		Nonce:         request.Nonce,
+		AuthTime:      user.AuthenticatedAt,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(s.settings.AuthorizationCodeExpirationTime),
+	})
+	if err != nil {
+		return AuthorizeResult{}, err
+	}
+
+	return AuthorizeResult{RedirectURL: redirectWith(redirectURI, request.State, url.Values{"code": {code}})}, nil
+}
+
+// Token implementa o endpoint de token; erros de protocolo são retornados como *Error
+func (s *Service) Token(ctx context.Context, request TokenRequest) (TokenResponse, error) {
+	client, err := s.authenticateClient(ctx, request.ClientID, request.ClientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	grantType := GrantType(request.GrantType)
+	if _, found := grantTypes[grantType]; !found {
+		return TokenResponse{}, newError(400, "unsupported_grant_type", "")
+	}
+
+	if !client.AllowsGrant(grantType) {
+		return TokenResponse{}, newError(400, "unauthorized_client", "client is not allowed to use "+request.GrantType)
+	}
+
+	switch grantType {
+	case GrantAuthorizationCode:
+		return s.exchangeCode(ctx, client, request)
+	case GrantRefreshToken:
+		return s.refresh(ctx, client, request)
+	default:
+		return s.clientCredentials(client, request)
+	}
+}
+
+func (s *Service) authenticateClient(ctx context.Context, clientID, secret string) (Client, error) {
+	invalid := newError(401, "invalid_client", "client authentication failed")
+
+	client, err := s.repo.GetClient(ctx, clientID)
+	if errors.Is(err, ErrClientNotFound) {
+		return Client{}, invalid
+	}
+	if err != nil {
+		return Client{}, err
+	}
+
+	if !client.Confidential {
+		if secret != "" {
+			return Client{}, invalid
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return Client{}, invalid
+	}
+
+	return client, nil
+}
+
+func (s *Service) exchangeCode(ctx context.Context, client Client, request TokenRequest) (TokenResponse, error) {
+	invalid := newError(400, "invalid_grant", "invalid authorization code")
+
+	now := time.Now()
+	code, err := s.repo.ConsumeCode(ctx, hashSecret(request.Code), now)
+	if errors.Is(err, ErrCodeNotFound) {
+		return TokenResponse{}, invalid
+	}
+	// a reapresentação do código revoga os tokens emitidos a partir dele (RFC 6749, seção 4.1.2)
+	if errors.Is(err, ErrCodeAlreadyUsed) {
+		if code.ClientID == client.ID {
+			if err := s.repo.RevokeGrant(ctx, code.CodeHash, now); err != nil {
+				return TokenResponse{}, err
+			}
+		}
+		return TokenResponse{}, invalid
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	// a redirect_uri enviada na autorização precisa ser repetida e idêntica (RFC 6749, seção 4.1.3);
+	// se foi omitida lá, só é aceita aqui uma das registradas para o cliente
+	redirectMismatch := request.RedirectURI != code.RedirectURI
+	if code.RedirectURI == "" {
+		redirectMismatch = request.RedirectURI != "" && !client.AllowsRedirectURI(request.RedirectURI)
+	}
+	if code.ClientID != client.ID || !now.Before(code.ExpiresAt) || redirectMismatch {
+		return TokenResponse{}, invalid
+	}
+
+	if !verifyCodeChallenge(request.CodeVerifier, code.CodeChallenge) {
+		return TokenResponse{}, newError(400, "invalid_grant", "code_verifier does not match the code_challenge")
+	}
+
+	user, err := s.userService.Get(ctx, code.UserID)
+	if errors.Is(err, users.ErrNotFound) {
+		return TokenResponse{}, invalid
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return s.issueTokens(ctx, client, user, authorization{
+		scopes:   code.Scopes,
+		original: code.Scopes,
+		grantID:  code.CodeHash,
+		nonce:    code.Nonce,
+		authTime: code.AuthTime,
+	})
+}
+
+// refresh rotaciona o refresh token a cada uso. A reapresentação de um token já
+// rotacionado indica vazamento e revoga todos os tokens do usuário para o cliente
+func (s *Service) refresh(ctx context.Context, client Client, request TokenRequest) (TokenResponse, error) {
+	invalid := newError(400, "invalid_grant", "invalid refresh token")
+
+	current, err := s.repo.GetRefreshToken(ctx, hashSecret(request.RefreshToken))
+	if errors.Is(err, ErrTokenNotFound) {
+		return TokenResponse{}, invalid
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if current.ClientID != client.ID {
+		return TokenResponse{}, invalid
+	}
+
+	now := time.Now()
+	if current.RevokedAt != nil {
+		if err := s.repo.RevokeRefreshTokens(ctx, client.ID, current.UserID, now); err != nil {
+			return TokenResponse{}, err
+		}
+		return TokenResponse{}, invalid
+	}
+
+	if !now.Before(current.ExpiresAt) {
+		return TokenResponse{}, invalid
+	}
+
+	// troca de senha e revogação de sessões também invalidam os refresh tokens anteriores
+	user, err := s.userService.Get(ctx, current.UserID)
+	if errors.Is(err, users.ErrNotFound) {
+		return TokenResponse{}, invalid
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if current.CreatedAt.Before(user.SessionsRevokedAt) {
+		return TokenResponse{}, invalid
+	}
+
+	granted := current.Scopes
+	if request.Scope != "" {
+		requested := strings.Fields(request.Scope)
+		if !contains(current.Scopes, requested) {
+			return TokenResponse{}, newError(400, "invalid_scope", "requested scope exceeds the original grant")
+		}
+		granted = requested
+	}
+
+	return s.issueTokens(ctx, client, user, authorization{
+		scopes:      granted,
+		original:    current.Scopes,
+		grantID:     current.GrantID,
+		authTime:    current.AuthTime,
+		rotatedHash: current.TokenHash,
+	})
+}
+
+func (s *Service) clientCredentials(client Client, request TokenRequest) (TokenResponse, error) {
+	granted, authErr := requestedScopes(client, request.Scope)
+	if authErr != nil {
+		return TokenResponse{}, authErr
+	}
+
+	return s.accessToken(client.ID, client.ID, "", granted)
+}
+
+// authorization descreve a autorização de um usuário que está sendo trocada por tokens
+type authorization struct {
+	scopes      []string
+	original    []string
+	grantID     string
+	nonce       string
+	authTime    time.Time
+	rotatedHash string
+}
+
+// issueTokens emite o access token com os escopos concedidos, o ID token quando openid
+// foi concedido e, se o cliente usa refresh_token, um novo refresh token com os escopos
+// originais da autorização
+func (s *Service) issueTokens(ctx context.Context, client Client, user users.User, g authorization) (TokenResponse, error) {
+	response, err := s.accessToken(strconv.FormatInt(user.ID, 10), client.ID, g.grantID, g.scopes)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if contains(g.scopes, []string{ScopeOpenID}) {
+		response.IDToken, err = s.idTokenService.CreateIDToken(user, IDTokenClaims{
+			ClientID: client.ID,
+			Nonce:    g.nonce,
+			AuthTime: g.authTime,
+			Scopes:   g.scopes,
+		})
+		if err != nil {
+			return TokenResponse{}, fmt.Errorf("failed to create id token: %w", err)
+		}
+	}
+
+	if !client.AllowsGrant(GrantRefreshToken) {
+		return response, nil
+	}
+
+	raw, err := randomString(32)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	now := time.Now()
+	next := RefreshToken{
+		TokenHash: hashSecret(raw),
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		GrantID:   g.grantID,
+		Scopes:    g.original,
+		AuthTime:  g.authTime,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.settings.RefreshTokenExpirationTime),
+	}
+
+	if g.rotatedHash == "" {
+		err = s.repo.CreateRefreshToken(ctx, next)
+	} else {
+		err = s.repo.RotateRefreshToken(ctx, g.rotatedHash, next)
+	}
+	if errors.Is(err, ErrTokenNotFound) {
+		return TokenResponse{}, newError(400, "invalid_grant", "invalid refresh token")
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	response.RefreshToken = raw
+	return response, nil
+}
+
+func (s *Service) accessToken(subject, clientID, grantID string, granted []string) (TokenResponse, error) {
+	now := time.Now()
+	accessToken, err := s.tokenService.CreateOAuthAccess(AccessClaims{
+		Subject:   subject,
+		ClientID:  clientID,
+		GrantID:   grantID,
+		Scopes:    granted,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(s.settings.AccessTokenExpirationTime),
+	})
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("failed to create access token: %w", err)
+	}
+
+	return TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.settings.AccessTokenExpirationTime.Seconds()),
+		Scope:       strings.Join(granted, " "),
+	}, nil
+}
+
+// Authenticate valida um access token emitido pelo servidor OAuth e exige o escopo informado
+func (s *Service) Authenticate(ctx context.Context, raw, scope string) (AccessClaims, error) {
+	claims, err := s.tokenService.ParseOAuthAccess(raw)
+	if err != nil {
+		return AccessClaims{}, ErrInvalidToken
+	}
+
+	// tokens de clientes removidos deixam de valer antes de expirar
+	if _, err := s.repo.GetClient(ctx, claims.ClientID); errors.Is(err, ErrClientNotFound) {
+		return AccessClaims{}, ErrInvalidToken
+	} else if err != nil {
+		return AccessClaims{}, err
+	}
+
+	if claims.GrantID != "" {
+		revoked, err := s.repo.IsGrantRevoked(ctx, claims.GrantID)
+		if err != nil {
+			return AccessClaims{}, err
+		}
+		if revoked {
+			return AccessClaims{}, ErrInvalidToken
+		}
+	}
+
+	if !contains(claims.Scopes, []string{scope}) {
+		return AccessClaims{}, ErrInsufficientScope
+	}
+
+	return claims, nil
+}
+
+func requestedScopes(client Client, scope string) ([]string, *Error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return client.Scopes, nil
+	}
+
+	if !contains(client.Scopes, requested) {
+		return nil, newError(400, "invalid_scope", "requested scope is not allowed for this client")
+	}
+
+	return requested, nil
+}
+
+func (e *Error) query() url.Values {
+	values := url.Values{"error": {e.Code}}
+	if e.Description != "" {
+		values.Set("error_description", e.Description)
+	}
+	return values
+}
+
+// redirectWith acrescenta os parâmetros à redirect_uri preservando a query já registrada
+func redirectWith(redirectURI, state string, values url.Values) string {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := target.Query()
+	for key, value := range values {
+		query[key] = value
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	target.RawQuery = query.Encode()
+
+	return target.String()
+}
+
+// verifyCodeChallenge compara BASE64URL(SHA256(code_verifier)) com o code_challenge (RFC 7636)
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func contains(granted, requested []string) bool {
+	for _, scope := range requested {
+		found := false
+		for _, g := range granted {
+			if g == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func union(current, added []string) []string {
+	result := append([]string{}, current...)
+	for _, scope := range added {
+		if !contains(result, []string{scope}) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+func randomString(size int) (string, error) {
+	value := make([]byte, size)
+	if _, err := rand.Read(value); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return hex.EncodeToString(value), nil
+}
+
+// hashSecret usa SHA-256 sem salt porque segredos, códigos e tokens já têm ao menos 128 bits aleatórios
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return base64.RawStdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,38 @@
+package oauth
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// exemplo do apêndice B da RFC 7636
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	require.True(t, verifyCodeChallenge(verifier, challenge))
+	require.False(t, verifyCodeChallenge(verifier+"x", challenge))
+	require.False(t, verifyCodeChallenge("short", challenge))
+}
+
+func TestRedirectWith(t *testing.T) {
+	redirect := redirectWith("https://app.example.com/callback?tenant=1", "xyz", url.Values{"code": {"abc"}})
+
+	target, err := url.Parse(redirect)
+	require.NoError(t, err)
+	require.Equal(t, "app.example.com", target.Host)
+	require.Equal(t, url.Values{"tenant": {"1"}, "code": {"abc"}, "state": {"xyz"}}, target.Query())
+}
+
+func TestRequestedScopes(t *testing.T) {
+	client := Client{Scopes: []string{ScopeUsersRead}}
+
+	granted, err := requestedScopes(client, "")
+	require.Nil(t, err)
+	require.Equal(t, []string{ScopeUsersRead}, granted)
+
+	_, err = requestedScopes(client, ScopeUsersRead+" users:write")
+	require.Equal(t, "invalid_scope", err.Code)
+}
@@ -0,0 +1,228 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/juliovcruz/user-register/internal/security/oauth"
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/juliovcruz/user-register/internal/users"
+)
+
+const signingAlgorithm = "RS256"
+
+type userService interface {
+	Get(ctx context.Context, id int64) (users.User, error)
+}
+
+// ID tokens são assinados com RSA para que os clientes validem com a chave pública do
+// JWKS, sem compartilhar o segredo usado nos tokens de sessão
+type Service struct {
+	userService    userService
+	issuer         string
+	expirationTime time.Duration
+	key            *rsa.PrivateKey
+	keyID          string
+}
+
+func NewService(userService userService, settings settings.OIDC) (*Service, error) {
+	key, err := loadSigningKey(settings.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSigningKey, err)
+	}
+	sum := sha256.Sum256(public)
+
+	return &Service{
+		userService:    userService,
+		issuer:         strings.TrimSuffix(settings.Issuer, "/"),
+		expirationTime: settings.IDTokenExpirationTime,
+		key:            key,
+		keyID:          base64.RawURLEncoding.EncodeToString(sum[:8]),
+	}, nil
+}
+
+// loadSigningKey lê uma chave RSA em PEM (PKCS#1 ou PKCS#8). O arquivo é exigido fora do
+// ambiente local; sem ele a chave é gerada na inicialização e os ID tokens emitidos deixam de
+// validar ao reiniciar
+func loadSigningKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oidc signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, ErrInvalidSigningKey
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSigningKey, err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: only RSA keys are supported", ErrInvalidSigningKey)
+	}
+
+	return key, nil
+}
+
+func (s *Service) Discovery() Discovery {
+	return Discovery{
+		Issuer:                            s.issuer,
+		AuthorizationEndpoint:             s.issuer + "/oauth/authorize",
+		TokenEndpoint:                     s.issuer + "/oauth/token",
+		UserInfoEndpoint:                  s.issuer + "/userinfo",
+		JWKSURI:                           s.issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   oauth.Scopes(),
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{string(oauth.GrantAuthorizationCode), string(oauth.GrantRefreshToken), string(oauth.GrantClientCredentials)},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{signingAlgorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "email", "email_verified", "address",
+		},
+	}
+}
+
+func (s *Service) JWKS() JWKS {
+	return JWKS{Keys: []JWK{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: signingAlgorithm,
+		KeyID:     s.keyID,
+		N:         base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+	}}}
+}
+
+// CreateIDToken emite o ID token com as claims de identificação da autorização e as
+// claims do usuário liberadas pelos escopos concedidos
+func (s *Service) CreateIDToken(user users.User, claims oauth.IDTokenClaims) (string, error) {
+	now := time.Now()
+	values := jwt.MapClaims{
+		"iss": s.issuer,
+		"sub": strconv.FormatInt(user.ID, 10),
+		"aud": claims.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(s.expirationTime).Unix(),
+	}
+
+	if !claims.AuthTime.IsZero() {
+		values["auth_time"] = claims.AuthTime.Unix()
+	}
+
+	if claims.Nonce != "" {
+		values["nonce"] = claims.Nonce
+	}
+
+	info := userInfo(user, claims.Scopes)
+	if info.Name != "" {
+		values["name"] = info.Name
+	}
+	if info.Email != "" {
+		values["email"] = info.Email
+		values["email_verified"] = *info.EmailVerified
+	}
+	if info.Address != nil {
+		values["address"] = info.Address
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, values)
+	token.Header["kid"] = s.keyID
+
+	return token.SignedString(s.key)
+}
+
+// UserInfo retorna as claims do usuário dono do access token. Tokens de client_credentials
+// não representam um usuário e são recusados
+func (s *Service) UserInfo(ctx context.Context, claims oauth.AccessClaims) (UserInfo, error) {
+	if claims.Subject == claims.ClientID {
+		return UserInfo{}, ErrInvalidSubject
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return UserInfo{}, ErrInvalidSubject
+	}
+
+	user, err := s.userService.Get(ctx, userID)
+	if errors.Is(err, users.ErrNotFound) {
+		return UserInfo{}, ErrInvalidSubject
+	}
+	if err != nil {
+		return UserInfo{}, err
+	}
+
+	return userInfo(user, claims.Scopes), nil
+}
+
+func userInfo(user users.User, scopes []string) UserInfo {
+	info := UserInfo{Subject: strconv.FormatInt(user.ID, 10)}
+
+	for _, scope := range scopes {
+		switch scope {
+		case oauth.ScopeProfile:
+			info.Name = user.Name
+		case oauth.ScopeEmail:
+			verified := user.EmailVerified
+			info.Email = user.Email
+			info.EmailVerified = &verified
+		case oauth.ScopeAddress:
+			info.Address = address(user.Address)
+		}
+	}
+
+	return info
+}
+
+// address converte o endereço vindo do ViaCEP, sempre brasileiro
+func address(a users.Address) *Address {
+	street := strings.Trim(a.Street+", "+a.Number, ", ")
+
+	formatted := []string{}
+	for _, part := range []string{street, a.Neighborhood, a.City, a.State, a.ZipCode} {
+		if part != "" {
+			formatted = append(formatted, part)
+		}
+	}
+
+	return &Address{
+		Formatted:     strings.Join(formatted, " - "),
+		StreetAddress: street,
+		Locality:      a.City,
+		Region:        a.State,
+		PostalCode:    a.ZipCode,
+		Country:       "BR",
+	}
+}
@@ -0,0 +1,231 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/juliovcruz/user-register/internal/security/oauth"
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/juliovcruz/user-register/internal/users"
+	"github.com/stretchr/testify/require"
+)
+
+type userServiceMock struct {
+	users map[int64]users.User
+}
+
+func (m *userServiceMock) Get(_ context.Context, id int64) (users.User, error) {
+	user, found := m.users[id]
+	if !found {
+		return users.User{}, users.ErrNotFound
+	}
+	return user, nil
+}
+
+func writeKey(t *testing.T, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "oidc.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func newTestService(t *testing.T, key *rsa.PrivateKey, user users.User) *Service {
+	service, err := NewService(&userServiceMock{users: map[int64]users.User{user.ID: user}}, settings.OIDC{
+		Issuer:                "https://id.example.com/",
+		SigningKeyFile:        writeKey(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+		IDTokenExpirationTime: time.Minute * 10,
+	})
+	require.NoError(t, err)
+	return service
+}
+
+var testUser = users.User{
+	ID:            7,
+	Name:          "User Name",
+	Email:         "user@example.com",
+	EmailVerified: true,
+	Address:       users.Address{Street: "Rua 1", Number: "10", City: "Goiânia", State: "GO", ZipCode: "74360400"},
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+
+	t.Run("PKCS#1 and PKCS#8 RSA keys", func(t *testing.T) {
+		for _, path := range []string{
+			writeKey(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+			writeKey(t, "PRIVATE KEY", pkcs8),
+		} {
+			loaded, err := loadSigningKey(path)
+			require.NoError(t, err)
+			require.True(t, key.Equal(loaded))
+		}
+	})
+
+	t.Run("Invalid keys", func(t *testing.T) {
+		notPEM := filepath.Join(t.TempDir(), "oidc.pem")
+		require.NoError(t, os.WriteFile(notPEM, []byte("not a key"), 0o600))
+
+		for _, path := range []string{notPEM, writeKey(t, "PRIVATE KEY", ecPKCS8), writeKey(t, "PRIVATE KEY", []byte("garbage"))} {
+			_, err := loadSigningKey(path)
+			require.ErrorIs(t, err, ErrInvalidSigningKey)
+		}
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := loadSigningKey(filepath.Join(t.TempDir(), "missing.pem"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestService_Discovery(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	discovery := newTestService(t, key, testUser).Discovery()
+
+	require.Equal(t, "https://id.example.com", discovery.Issuer)
+	require.Equal(t, "https://id.example.com/oauth/authorize", discovery.AuthorizationEndpoint)
+	require.Equal(t, "https://id.example.com/oauth/token", discovery.TokenEndpoint)
+	require.Equal(t, "https://id.example.com/userinfo", discovery.UserInfoEndpoint)
+	require.Equal(t, "https://id.example.com/.well-known/jwks.json", discovery.JWKSURI)
+	require.Equal(t, []string{"RS256"}, discovery.IDTokenSigningAlgValuesSupported)
+	require.Equal(t, []string{"S256"}, discovery.CodeChallengeMethodsSupported)
+	require.Equal(t, oauth.Scopes(), discovery.ScopesSupported)
+}
+
+func TestService_JWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	service := newTestService(t, key, testUser)
+
+	jwks := service.JWKS()
+	require.Len(t, jwks.Keys, 1)
+
+	jwk := jwks.Keys[0]
+	require.Equal(t, JWK{KeyType: "RSA", Use: "sig", Algorithm: "RS256", KeyID: service.keyID, N: jwk.N, E: "AQAB"}, jwk)
+
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	require.NoError(t, err)
+	require.Zero(t, key.N.Cmp(new(big.Int).SetBytes(n)))
+
+	// o kid vem da chave pública, então a mesma chave mantém o mesmo kid entre reinícios
+	require.Equal(t, service.keyID, newTestService(t, key, testUser).keyID)
+}
+
+func TestService_CreateIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	service := newTestService(t, key, testUser)
+
+	parse := func(t *testing.T, raw string) jwt.MapClaims {
+		token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+			require.Equal(t, service.keyID, token.Header["kid"])
+			return &key.PublicKey, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, "RS256", token.Method.Alg())
+		return token.Claims.(jwt.MapClaims)
+	}
+
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	t.Run("Identification claims and nonce", func(t *testing.T) {
+		raw, err := service.CreateIDToken(testUser, oauth.IDTokenClaims{
+			ClientID: "client",
+			Nonce:    "n-0S6_WzA2Mj",
+			AuthTime: authTime,
+			Scopes:   []string{oauth.ScopeOpenID},
+		})
+		require.NoError(t, err)
+
+		claims := parse(t, raw)
+		require.Equal(t, "https://id.example.com", claims["iss"])
+		require.Equal(t, "7", claims["sub"])
+		require.Equal(t, "client", claims["aud"])
+		require.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+		require.Equal(t, float64(authTime.Unix()), claims["auth_time"])
+		require.InDelta(t, float64(time.Now().Add(time.Minute*10).Unix()), claims["exp"], 5)
+
+		// sem os escopos de perfil nenhuma claim do usuário é exposta
+		for _, claim := range []string{"name", "email", "email_verified", "address"} {
+			require.NotContains(t, claims, claim)
+		}
+	})
+
+	t.Run("Omits nonce and auth_time when absent", func(t *testing.T) {
+		raw, err := service.CreateIDToken(testUser, oauth.IDTokenClaims{ClientID: "client", Scopes: []string{oauth.ScopeOpenID}})
+		require.NoError(t, err)
+
+		claims := parse(t, raw)
+		require.NotContains(t, claims, "nonce")
+		require.NotContains(t, claims, "auth_time")
+	})
+
+	t.Run("User claims follow the granted scopes", func(t *testing.T) {
+		raw, err := service.CreateIDToken(testUser, oauth.IDTokenClaims{
+			ClientID: "client",
+			Scopes:   []string{oauth.ScopeOpenID, oauth.ScopeProfile, oauth.ScopeEmail, oauth.ScopeAddress},
+		})
+		require.NoError(t, err)
+
+		claims := parse(t, raw)
+		require.Equal(t, "User Name", claims["name"])
+		require.Equal(t, "user@example.com", claims["email"])
+		require.Equal(t, true, claims["email_verified"])
+		require.Equal(t, map[string]interface{}{
+			"formatted":      "Rua 1, 10 - Goiânia - GO - 74360400",
+			"street_address": "Rua 1, 10",
+			"locality":       "Goiânia",
+			"region":         "GO",
+			"postal_code":    "74360400",
+			"country":        "BR",
+		}, claims["address"])
+	})
+
+	t.Run("Tokens signed by another key are rejected", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		raw, err := newTestService(t, other, testUser).CreateIDToken(testUser, oauth.IDTokenClaims{ClientID: "client"})
+		require.NoError(t, err)
+
+		_, err = jwt.Parse(raw, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil })
+		require.Error(t, err)
+	})
+}
+
+func TestService_UserInfo(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	service := newTestService(t, key, testUser)
+
+	info, err := service.UserInfo(context.Background(), oauth.AccessClaims{Subject: "7", ClientID: "client", Scopes: []string{oauth.ScopeOpenID, oauth.ScopeEmail}})
+	require.NoError(t, err)
+	require.Equal(t, "7", info.Subject)
+	require.Equal(t, "user@example.com", info.Email)
+	require.Empty(t, info.Name)
+
+	for _, subject := range []string{"client", "abc", "8"} {
+		_, err := service.UserInfo(context.Background(), oauth.AccessClaims{Subject: subject, ClientID: "client"})
+		require.ErrorIs(t, err, ErrInvalidSubject)
+	}
+}
@@ -2,26 +2,49 @@ package token
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/juliovcruz/user-register/internal/security/oauth"
 	"github.com/juliovcruz/user-register/internal/settings"
 	"github.com/juliovcruz/user-register/internal/users"
 )
 
+const (
+	typeAccess       = "access"
+	typeMFAChallenge = "mfa_challenge"
+	typeOAuthAccess  = "oauth_access"
+)
+
 type Service struct {
-	Secret         string
-	ExpirationTime time.Duration
+	Secret                     string
+	ExpirationTime             time.Duration
+	MFAChallengeExpirationTime time.Duration
 }
 
 func NewService(settings settings.Settings) *Service {
-	return &Service{Secret: settings.TokenSettings.Secret, ExpirationTime: settings.TokenSettings.ExpirationTime}
+	return &Service{
+		Secret:                     settings.TokenSettings.Secret,
+		ExpirationTime:             settings.TokenSettings.ExpirationTime,
+		MFAChallengeExpirationTime: settings.MFA.ChallengeExpirationTime,
+	}
+}
+
+func (s *Service) TTL() time.Duration {
+	return s.ExpirationTime
 }
 
-func (s *Service) Create(user users.User) (string, error) {
+func (s *Service) Create(user users.User, sessionID string) (string, error) {
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":      strconv.FormatInt(user.ID, 10),
 		"username": user.Email,
-		"exp":      time.Now().Add(s.ExpirationTime).Unix(),
+		"sid":      sessionID,
+		"typ":      typeAccess,
+		"iat":      now.Unix(),
+		"exp":      now.Add(s.ExpirationTime).Unix(),
 	})
 
 	tokenString, err := token.SignedString([]byte(s.Secret))
@@ -32,13 +55,146 @@ func (s *Service) Create(user users.User) (string, error) {
 	return tokenString, nil
 }
 
+func (s *Service) CreateMFAChallenge(user users.User) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": strconv.FormatInt(user.ID, 10),
+		"typ": typeMFAChallenge,
+		"iat": now.Unix(),
+		"exp": now.Add(s.MFAChallengeExpirationTime).Unix(),
+	})
+
+	return token.SignedString([]byte(s.Secret))
+}
+
+func (s *Service) ParseMFAChallenge(tokenStr string) (int64, error) {
+	claims, err := s.claims(tokenStr)
+	if err != nil {
+		return 0, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != typeMFAChallenge {
+		return 0, errors.New("invalid token type")
+	}
+
+	return subject(claims)
+}
+
+// CreateOAuthAccess assina um access token emitido pelo servidor OAuth. O tipo próprio
+// impede que ele seja aceito como token de sessão pelas rotas do usuário
+func (s *Service) CreateOAuthAccess(claims oauth.AccessClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":       claims.Subject,
+		"client_id": claims.ClientID,
+		"grant_id":  claims.GrantID,
+		"scope":     strings.Join(claims.Scopes, " "),
+		"typ":       typeOAuthAccess,
+		"iat":       claims.IssuedAt.Unix(),
+		"exp":       claims.ExpiresAt.Unix(),
+	})
+
+	return token.SignedString([]byte(s.Secret))
+}
+
+func (s *Service) ParseOAuthAccess(tokenStr string) (oauth.AccessClaims, error) {
+	claims, err := s.claims(tokenStr)
+	if err != nil {
+		return oauth.AccessClaims{}, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != typeOAuthAccess {
+		return oauth.AccessClaims{}, errors.New("invalid token type")
+	}
+
+	sub, _ := claims["sub"].(string)
+	clientID, _ := claims["client_id"].(string)
+	grantID, _ := claims["grant_id"].(string)
+	scope, _ := claims["scope"].(string)
+	issuedAt, _ := claims["iat"].(float64)
+	expiresAt, _ := claims["exp"].(float64)
+
+	return oauth.AccessClaims{
+		Subject:   sub,
+		ClientID:  clientID,
+		GrantID:   grantID,
+		Scopes:    strings.Fields(scope),
+		IssuedAt:  time.Unix(int64(issuedAt), 0),
+		ExpiresAt: time.Unix(int64(expiresAt), 0),
+	}, nil
+}
+
 func (s *Service) IsValid(tokenStr string) (bool, error) {
+	token, err := s.parse(tokenStr)
+	if err != nil {
+		return false, err
+	}
+
+	return token.Valid, nil
+}
+
+func (s *Service) Parse(tokenStr string) (users.TokenClaims, error) {
+	claims, err := s.claims(tokenStr)
+	if err != nil {
+		return users.TokenClaims{}, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != typeAccess {
+		return users.TokenClaims{}, errors.New("invalid token type")
+	}
+
+	userID, err := subject(claims)
+	if err != nil {
+		return users.TokenClaims{}, err
+	}
+
+	email, _ := claims["username"].(string)
+	sessionID, _ := claims["sid"].(string)
+	issuedAt, _ := claims["iat"].(float64)
+
+	return users.TokenClaims{
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
+		IssuedAt:  time.Unix(int64(issuedAt), 0),
+	}, nil
+}
+
+func (s *Service) claims(tokenStr string) (jwt.MapClaims, error) {
+	token, err := s.parse(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+
+	return claims, nil
+}
+
+func subject(claims jwt.MapClaims) (int64, error) {
+	sub, _ := claims["sub"].(string)
+	userID, err := strconv.ParseInt(sub, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid token subject")
+	}
+	return userID, nil
+}
+
+func (s *Service) parse(tokenStr string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
 		return []byte(s.Secret), nil
 	})
 	if err != nil {
-		return false, errors.New("error to parse token")
+		return nil, errors.New("error to parse token")
 	}
 
-	return token.Valid, nil
+	return token, nil
 }
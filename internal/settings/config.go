@@ -0,0 +1,387 @@
+package settings
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[REDACTED]"
+
+// validKeyID limita os IDs de segredo ao que cabe no campo k= do hash argon2id
+var validKeyID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidationError reúne todos os problemas encontrados nas configurações
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid settings:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// loadFile sobrepõe às configurações as chaves presentes no arquivo YAML ou TOML
+func loadFile(path string, settings *Settings) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// o TOML é convertido para YAML para que os dois formatos usem as mesmas tags e a mesma
+	// recusa de chaves desconhecidas
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		values := map[string]any{}
+		if _, err := toml.Decode(string(content), &values); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+
+		if content, err = yaml.Marshal(values); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(settings); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv sobrescreve cada campo que tem tag env com a variável correspondente e
+// retorna os valores que não puderam ser convertidos
+func applyEnv(settings *Settings, lookup func(string) (string, bool)) []string {
+	var problems []string
+
+	walk(reflect.ValueOf(settings).Elem(), func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+
+		raw, found := lookup(name)
+		if !found {
+			return
+		}
+
+		if err := setValue(value, raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	})
+
+	return problems
+}
+
+func walk(value reflect.Value, fn func(field reflect.StructField, value reflect.Value)) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			walk(value.Field(i), fn)
+			continue
+		}
+		fn(field, value.Field(i))
+	}
+}
+
+func setValue(value reflect.Value, raw string) error {
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		value.SetInt(parsed)
+	case reflect.Uint8, reflect.Uint32:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+		value.SetUint(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		values := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		value.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+
+	return nil
+}
+
+// Redacted retorna uma cópia com os campos marcados como secret ocultados
+func (s Settings) Redacted() Settings {
+	walk(reflect.ValueOf(&s).Elem(), func(field reflect.StructField, value reflect.Value) {
+		if field.Tag.Get("secret") == "true" && value.String() != "" {
+			value.SetString(redacted)
+		}
+	})
+	return s
+}
+
+// validate confere as configurações já combinadas e descreve cada problema com a chave do
+// arquivo e a variável de ambiente correspondentes
+func (s Settings) validate() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(s.Server.Port > 0 && s.Server.Port <= 65535, "server.port (PORT) must be between 1 and 65535")
+	check(s.Server.MaxRequestBodySize > 0, "server.max_request_body_size (SERVER_MAX_REQUEST_BODY_SIZE) must be greater than zero")
+	check(s.Server.Concurrency > 0, "server.concurrency (SERVER_CONCURRENCY) must be greater than zero")
+	check(s.Server.MaxConnsPerIP >= 0, "server.max_conns_per_ip (SERVER_MAX_CONNS_PER_IP) must not be negative")
+	if _, err := s.Server.Proxies(); err != nil {
+		problems = append(problems, fmt.Sprintf("server.trusted_proxies (TRUSTED_PROXIES): %v", err))
+	}
+	problems = append(problems, s.Server.TLS.validate()...)
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(s.Logging.Level)) == nil, "logging.level (LOG_LEVEL) must be one of debug, info, warn or error")
+	check(s.Logging.Format == "json" || s.Logging.Format == "text", "logging.format (LOG_FORMAT) must be json or text")
+
+	switch s.Tracing.Exporter {
+	case "none", "stdout":
+	case "file":
+		check(s.Tracing.File != "", "tracing.file (TRACING_FILE) is required when tracing.exporter is file")
+	case "otlp":
+		check(s.Tracing.Endpoint == "" || isURL(s.Tracing.Endpoint), "tracing.endpoint (TRACING_OTLP_ENDPOINT) must be an absolute http(s) URL")
+	default:
+		check(false, "tracing.exporter (TRACING_EXPORTER) must be one of none, stdout, file or otlp")
+	}
+	check(s.Tracing.SampleRatio >= 0 && s.Tracing.SampleRatio <= 1, "tracing.sample_ratio (TRACING_SAMPLE_RATIO) must be between 0 and 1")
+	check(s.Tracing.ServiceName != "", "tracing.service_name (TRACING_SERVICE_NAME) is required")
+
+	problems = append(problems, s.CORS.validate()...)
+	check(s.SecurityHeaders.HSTSMaxAge >= 0, "security_headers.hsts_max_age (HSTS_MAX_AGE) must not be negative")
+	check(s.SecurityHeaders.FrameOptions == "DENY" || s.SecurityHeaders.FrameOptions == "SAMEORIGIN", "security_headers.frame_options (FRAME_OPTIONS) must be DENY or SAMEORIGIN")
+
+	check(s.TokenSettings.Secret != "", "token.secret (TOKEN_SECRET) is required")
+	check(s.Database.Secrets.Current != "", "database.secrets.current (DB_CURRENT_SECRET) is required")
+	check(s.Database.Secrets.Previous != "", "database.secrets.previous (DB_PREVIOUS_SECRET) is required")
+	check(validKeyID.MatchString(s.Database.Secrets.CurrentID), "database.secrets.current_id (DB_CURRENT_SECRET_ID) must have 1 to 32 letters, digits, - or _")
+	check(validKeyID.MatchString(s.Database.Secrets.PreviousID), "database.secrets.previous_id (DB_PREVIOUS_SECRET_ID) must have 1 to 32 letters, digits, - or _")
+	check(s.Database.Secrets.CurrentID != s.Database.Secrets.PreviousID, "database.secrets.current_id (DB_CURRENT_SECRET_ID) and database.secrets.previous_id (DB_PREVIOUS_SECRET_ID) must be different")
+	check(s.MagicLinkSettings.Secret != "", "magic_link.secret (MAGIC_LINK_SECRET) is required")
+
+	check(s.Database.FilePath != "", "database.file_path (DB_FILE_PATH) is required")
+	check(s.Database.Driver != "", "database.driver (DB_DRIVER) is required")
+
+	check(isURL(s.ZipCodeSettings.ViaCEPBaseURL), "zip_code.viacep_base_url (VIACEP_BASE_URL) must be an absolute http(s) URL")
+	check(isURL(s.MagicLinkSettings.BaseURL), "magic_link.base_url (MAGIC_LINK_BASE_URL) must be an absolute http(s) URL")
+	check(isURL(s.OIDC.Issuer), "oidc.issuer (OIDC_ISSUER) must be an absolute http(s) URL")
+	if s.Environment != Local {
+		problems = append(problems, s.validateDeployed()...)
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.read_timeout (SERVER_READ_TIMEOUT)", s.Server.ReadTimeout},
+		{"server.write_timeout (SERVER_WRITE_TIMEOUT)", s.Server.WriteTimeout},
+		{"server.idle_timeout (SERVER_IDLE_TIMEOUT)", s.Server.IdleTimeout},
+		{"server.shutdown_timeout (SERVER_SHUTDOWN_TIMEOUT)", s.Server.ShutdownTimeout},
+		{"token.expiration_time (TOKEN_EXPIRATION_TIME)", s.TokenSettings.ExpirationTime},
+		{"mail_validation_expiration_time (MAIL_VALIDATION_EXPIRATION_TIME)", s.MailValidationExpirationTime},
+		{"magic_link.expiration_time (MAGIC_LINK_EXPIRATION_TIME)", s.MagicLinkSettings.ExpirationTime},
+		{"magic_link.undo_expiration_time (MAGIC_LINK_UNDO_EXPIRATION_TIME)", s.MagicLinkSettings.UndoExpirationTime},
+		{"lockout.base_delay (LOCKOUT_BASE_DELAY)", s.Lockout.BaseDelay},
+		{"lockout.failure_window (LOCKOUT_FAILURE_WINDOW)", s.Lockout.FailureWindow},
+		{"lockout.lockout_duration (LOCKOUT_DURATION)", s.Lockout.LockoutDuration},
+		{"mfa.challenge_expiration_time (MFA_CHALLENGE_EXPIRATION_TIME)", s.MFA.ChallengeExpirationTime},
+		{"oauth.authorization_code_expiration_time (OAUTH_CODE_EXPIRATION_TIME)", s.OAuth.AuthorizationCodeExpirationTime},
+		{"oauth.access_token_expiration_time (OAUTH_ACCESS_TOKEN_EXPIRATION_TIME)", s.OAuth.AccessTokenExpirationTime},
+		{"oauth.refresh_token_expiration_time (OAUTH_REFRESH_TOKEN_EXPIRATION_TIME)", s.OAuth.RefreshTokenExpirationTime},
+		{"oidc.id_token_expiration_time (OIDC_ID_TOKEN_EXPIRATION_TIME)", s.OIDC.IDTokenExpirationTime},
+		{"health.timeout (HEALTH_CHECK_TIMEOUT)", s.Health.Timeout},
+	}
+	for _, d := range durations {
+		check(d.value > 0, "%s must be greater than zero", d.name)
+	}
+	check(s.Lockout.MaxDelay >= s.Lockout.BaseDelay, "lockout.max_delay (LOCKOUT_MAX_DELAY) must not be lower than lockout.base_delay")
+
+	check(s.Lockout.AccountThreshold > 0, "lockout.account_threshold (LOCKOUT_ACCOUNT_THRESHOLD) must be greater than zero")
+	check(s.Lockout.IPThreshold > 0, "lockout.ip_threshold (LOCKOUT_IP_THRESHOLD) must be greater than zero")
+	check(s.Lockout.FreeAttempts >= 0, "lockout.free_attempts (LOCKOUT_FREE_ATTEMPTS) must not be negative")
+
+	check(s.PasswordPolicy.MinLength > 0, "password_policy.min_length (PASSWORD_MIN_LENGTH) must be greater than zero")
+	check(s.PasswordPolicy.MaxLength >= s.PasswordPolicy.MinLength, "password_policy.max_length (PASSWORD_MAX_LENGTH) must not be lower than password_policy.min_length")
+	check(s.PasswordPolicy.MinEntropyBits >= 0, "password_policy.min_entropy_bits (PASSWORD_MIN_ENTROPY_BITS) must not be negative")
+	check(s.PasswordPolicy.HistorySize >= 0, "password_policy.history_size (PASSWORD_HISTORY_SIZE) must not be negative")
+
+	check(s.MFA.Skew >= 0, "mfa.skew (MFA_SKEW) must not be negative")
+	check(s.MFA.RecoveryCodes > 0, "mfa.recovery_codes (MFA_RECOVERY_CODES) must be greater than zero")
+
+	check(s.Hashing.Argon2Iterations > 0, "hashing.argon2_iterations (ARGON2_ITERATIONS) must be greater than zero")
+	check(s.Hashing.Argon2Parallelism > 0, "hashing.argon2_parallelism (ARGON2_PARALLELISM) must be greater than zero")
+	check(s.Hashing.Argon2Memory >= 8*uint32(s.Hashing.Argon2Parallelism), "hashing.argon2_memory (ARGON2_MEMORY) must be at least 8 KiB per unit of parallelism")
+	check(s.Hashing.SaltLength >= 8, "hashing.salt_length (HASH_SALT_LENGTH) must be at least 8")
+	check(s.Hashing.KeyLength >= 16, "hashing.key_length (HASH_KEY_LENGTH) must be at least 16")
+
+	files := []struct {
+		name string
+		path string
+	}{
+		{"registration_policy.disposable_domains_file (DISPOSABLE_DOMAINS_FILE)", s.RegistrationPolicy.DisposableDomainsFile},
+		{"password_policy.breached_passwords_file (BREACHED_PASSWORDS_FILE)", s.PasswordPolicy.BreachedPasswordsFile},
+		{"oidc.signing_key_file (OIDC_SIGNING_KEY_FILE)", s.OIDC.SigningKeyFile},
+		{"server.tls.cert_file (TLS_CERT_FILE)", s.Server.TLS.CertFile},
+		{"server.tls.key_file (TLS_KEY_FILE)", s.Server.TLS.KeyFile},
+		{"server.tls.client_ca_file (TLS_CLIENT_CA_FILE)", s.Server.TLS.ClientCAFile},
+	}
+	for _, f := range files {
+		if f.path != "" {
+			_, err := os.Stat(f.path)
+			check(err == nil, "%s: %v", f.name, err)
+		}
+	}
+
+	return problems
+}
+
+// validateDeployed confere o que só é dispensável em desenvolvimento
+func (s Settings) validateDeployed() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	// sem o arquivo a chave é gerada a cada inicialização e os ID tokens deixam de validar ao reiniciar
+	check(s.OIDC.SigningKeyFile != "", "oidc.signing_key_file (OIDC_SIGNING_KEY_FILE) is required outside local")
+	// o OpenID Connect Discovery exige https no issuer, e os links por e-mail levam tokens na query
+	check(!isURL(s.OIDC.Issuer) || isHTTPS(s.OIDC.Issuer), "oidc.issuer (OIDC_ISSUER) must use https outside local")
+	check(!isURL(s.MagicLinkSettings.BaseURL) || isHTTPS(s.MagicLinkSettings.BaseURL), "magic_link.base_url (MAGIC_LINK_BASE_URL) must use https outside local")
+	// sem token /metrics fica aberto, expondo rotas, volumes e falhas de login
+	check(s.Metrics.Token != "", "metrics.token (METRICS_TOKEN) is required outside local")
+
+	return problems
+}
+
+func (t TLS) validate() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check((t.CertFile == "") == (t.KeyFile == ""), "server.tls.cert_file (TLS_CERT_FILE) and server.tls.key_file (TLS_KEY_FILE) must be set together")
+	check(t.ReloadInterval > 0, "server.tls.reload_interval (TLS_RELOAD_INTERVAL) must be greater than zero")
+
+	if _, err := t.Version(); err != nil {
+		problems = append(problems, fmt.Sprintf("server.tls.min_version (TLS_MIN_VERSION): %v", err))
+	}
+	if _, err := t.Ciphers(); err != nil {
+		problems = append(problems, fmt.Sprintf("server.tls.cipher_suites (TLS_CIPHER_SUITES): %v", err))
+	}
+
+	clientAuth, err := t.ClientAuthType()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("server.tls.client_auth (TLS_CLIENT_AUTH): %v", err))
+	}
+	if clientAuth != tls.NoClientCert {
+		check(t.Enabled(), "server.tls.client_auth (TLS_CLIENT_AUTH) requires server.tls.cert_file")
+		check(t.ClientCAFile != "", "server.tls.client_auth (TLS_CLIENT_AUTH) requires server.tls.client_ca_file (TLS_CLIENT_CA_FILE)")
+	}
+
+	subjects := map[string]struct{}{}
+	for i, identity := range t.ClientIdentities {
+		check(identity.Name != "", "server.tls.client_identities[%d].name is required", i)
+		check(identity.Subject != "", "server.tls.client_identities[%d].subject is required", i)
+
+		_, duplicated := subjects[identity.Subject]
+		check(!duplicated, "server.tls.client_identities[%d].subject %q is duplicated", i, identity.Subject)
+		subjects[identity.Subject] = struct{}{}
+	}
+
+	return problems
+}
+
+func (c CORS) validate() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			check(!c.AllowCredentials, "cors.allowed_origins (CORS_ALLOWED_ORIGINS) cannot be * when cors.allow_credentials (CORS_ALLOW_CREDENTIALS) is true")
+			continue
+		}
+		check(isOrigin(origin), "cors.allowed_origins (CORS_ALLOWED_ORIGINS): %q must be *, scheme://host[:port] or scheme://*.host[:port]", origin)
+	}
+	check(len(c.AllowedMethods) > 0, "cors.allowed_methods (CORS_ALLOWED_METHODS) is required")
+	check(c.MaxAge >= 0, "cors.max_age (CORS_MAX_AGE) must not be negative")
+
+	return problems
+}
+
+// isOrigin aceita apenas esquema e host, com o curinga restrito ao primeiro rótulo do host
+func isOrigin(value string) bool {
+	scheme, host, found := strings.Cut(value, "://")
+	if !found {
+		return false
+	}
+	host = strings.TrimPrefix(host, "*.")
+	return isURL(scheme+"://"+host) && !strings.ContainsAny(host, "/*?#@")
+}
+
+func isURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func isHTTPS(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && parsed.Scheme == "https"
+}
@@ -1,9 +1,14 @@
 package settings
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"net"
+	"net/netip"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -17,102 +22,478 @@ const (
 	Production Environment = "production"
 )
 
+// Cada campo folha tem a variável de ambiente que o sobrescreve na tag env; campos com
+// secret:"true" são ocultados no `config print`
 type Settings struct {
-	ZipCodeSettings              ZipCode
-	TokenSettings                TokenSettings
-	Database                     Database
-	MailValidationExpirationTime time.Duration
+	Environment                  Environment        `yaml:"-"`
+	Server                       Server             `yaml:"server"`
+	ZipCodeSettings              ZipCode            `yaml:"zip_code"`
+	TokenSettings                TokenSettings      `yaml:"token"`
+	Database                     Database           `yaml:"database"`
+	MailValidationExpirationTime time.Duration      `yaml:"mail_validation_expiration_time" env:"MAIL_VALIDATION_EXPIRATION_TIME"`
+	MagicLinkSettings            MagicLink          `yaml:"magic_link"`
+	EmailNormalization           EmailNormalization `yaml:"email_normalization"`
+	RegistrationPolicy           RegistrationPolicy `yaml:"registration_policy"`
+	PasswordPolicy               PasswordPolicy     `yaml:"password_policy"`
+	AdminEmails                  []string           `yaml:"admin_emails" env:"ADMIN_EMAILS"`
+	Lockout                      Lockout            `yaml:"lockout"`
+	MFA                          MFA                `yaml:"mfa"`
+	Hashing                      Hashing            `yaml:"hashing"`
+	OAuth                        OAuth              `yaml:"oauth"`
+	OIDC                         OIDC               `yaml:"oidc"`
+	Health                       Health             `yaml:"health"`
+	Metrics                      Metrics            `yaml:"metrics"`
+	Logging                      Logging            `yaml:"logging"`
+	Tracing                      Tracing            `yaml:"tracing"`
+	CORS                         CORS               `yaml:"cors"`
+	SecurityHeaders              SecurityHeaders    `yaml:"security_headers"`
+}
+
+// CORS.AllowedOrigins aceita origens exatas (https://app.example.com), subdomínios com
+// curinga (https://*.example.com, que não inclui o próprio example.com) ou "*", que não
+// pode ser combinado com AllowCredentials. Sem origens configuradas o CORS fica desligado
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// SecurityHeaders.HSTSMaxAge zerado desliga o HSTS, que só é enviado em conexões TLS.
+// FrameOptions aceita DENY ou SAMEORIGIN. SwaggerContentSecurityPolicy vale para /swagger/,
+// cuja interface precisa de scripts e estilos inline
+type SecurityHeaders struct {
+	HSTSMaxAge                   time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE"`
+	HSTSIncludeSubdomains        bool          `yaml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS"`
+	FrameOptions                 string        `yaml:"frame_options" env:"FRAME_OPTIONS"`
+	ContentSecurityPolicy        string        `yaml:"content_security_policy" env:"CONTENT_SECURITY_POLICY"`
+	SwaggerContentSecurityPolicy string        `yaml:"swagger_content_security_policy" env:"SWAGGER_CONTENT_SECURITY_POLICY"`
+}
+
+// Logging.Level aceita debug, info, warn ou error e Logging.Format json ou text
+type Logging struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// Tracing.Exporter aceita none, stdout, file (spans em JSON no arquivo Tracing.File) ou
+// otlp (OTLP/HTTP para Tracing.Endpoint). SampleRatio vale para traces iniciados aqui; quem
+// chama com traceparent decide a amostragem
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER"`
+	File        string  `yaml:"file" env:"TRACING_FILE"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+}
+
+// Metrics.Token, quando definido, passa a ser exigido no header
+// "Authorization: Bearer {token}" de /metrics
+type Metrics struct {
+	Token string `yaml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+// Health.CheckZipCode inclui o ViaCEP no status como dependência opcional, o que faz cada
+// verificação de prontidão chamar o serviço externo
+type Health struct {
+	Timeout      time.Duration `yaml:"timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	CheckZipCode bool          `yaml:"check_zip_code" env:"HEALTH_CHECK_ZIP_CODE"`
+}
+
+type Server struct {
+	Host               string        `yaml:"host" env:"SERVER_HOST"`
+	Port               int           `yaml:"port" env:"PORT"`
+	ReadTimeout        time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout       time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout        time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	MaxRequestBodySize int           `yaml:"max_request_body_size" env:"SERVER_MAX_REQUEST_BODY_SIZE"`
+	Concurrency        int           `yaml:"concurrency" env:"SERVER_CONCURRENCY"`
+	MaxConnsPerIP      int           `yaml:"max_conns_per_ip" env:"SERVER_MAX_CONNS_PER_IP"`
+	ShutdownTimeout    time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	TrustedProxies     []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	TLS                TLS           `yaml:"tls"`
+}
+
+// TLS é habilitado quando CertFile é informado. ClientAuth aceita none, optional ou required
+// e exige ClientCAFile; os certificados de cliente verificados são mapeados para
+// ClientIdentities pelo CN ou por um SAN DNS/URI
+type TLS struct {
+	CertFile         string           `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile          string           `yaml:"key_file" env:"TLS_KEY_FILE"`
+	MinVersion       string           `yaml:"min_version" env:"TLS_MIN_VERSION"`
+	CipherSuites     []string         `yaml:"cipher_suites" env:"TLS_CIPHER_SUITES"`
+	ReloadInterval   time.Duration    `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL"`
+	ClientAuth       string           `yaml:"client_auth" env:"TLS_CLIENT_AUTH"`
+	ClientCAFile     string           `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	ClientIdentities []ClientIdentity `yaml:"client_identities"`
+}
+
+type ClientIdentity struct {
+	Name    string   `yaml:"name"`
+	Subject string   `yaml:"subject"`
+	Scopes  []string `yaml:"scopes"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Version converte MinVersion para a constante de crypto/tls
+func (t TLS) Version() (uint16, error) {
+	version, found := tlsVersions[t.MinVersion]
+	if !found {
+		return 0, fmt.Errorf("unsupported tls version %q, expected 1.2 or 1.3", t.MinVersion)
+	}
+	return version, nil
+}
+
+// Ciphers converte os nomes de CipherSuites; apenas as suítes do TLS 1.2 consideradas seguras
+// por crypto/tls são aceitas. As do TLS 1.3 não são configuráveis na biblioteca e seriam
+// ignoradas em silêncio. Sem nomes configurados o padrão da biblioteca é usado
+func (t TLS) Ciphers() ([]uint16, error) {
+	if len(t.CipherSuites) == 0 {
+		return nil, nil
+	}
+
+	available := map[string]*tls.CipherSuite{}
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite
+	}
+
+	ids := make([]uint16, 0, len(t.CipherSuites))
+	for _, name := range t.CipherSuites {
+		suite, found := available[name]
+		if !found {
+			return nil, fmt.Errorf("unsupported cipher suite %q", name)
+		}
+		if !supportsTLS12(suite) {
+			return nil, fmt.Errorf("cipher suite %q is a TLS 1.3 suite, which is always enabled and cannot be configured", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+func supportsTLS12(suite *tls.CipherSuite) bool {
+	for _, version := range suite.SupportedVersions {
+		if version == tls.VersionTLS12 {
+			return true
+		}
+	}
+	return false
+}
+
+func (t TLS) ClientAuthType() (tls.ClientAuthType, error) {
+	switch t.ClientAuth {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "required":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unsupported client auth %q, expected none, optional or required", t.ClientAuth)
+	}
+}
+
+// Addr é o endereço de escuta; com Host vazio o servidor escuta em todas as interfaces
+func (s Server) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Proxies converte TrustedProxies, que aceita IPs ou faixas CIDR; o X-Forwarded-For só é
+// considerado em conexões vindas dessas redes
+func (s Server) Proxies() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(s.TrustedProxies))
+	for _, proxy := range s.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an IP or a CIDR range", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+type OIDC struct {
+	Issuer                string        `yaml:"issuer" env:"OIDC_ISSUER"`
+	SigningKeyFile        string        `yaml:"signing_key_file" env:"OIDC_SIGNING_KEY_FILE"`
+	IDTokenExpirationTime time.Duration `yaml:"id_token_expiration_time" env:"OIDC_ID_TOKEN_EXPIRATION_TIME"`
+}
+
+type OAuth struct {
+	AuthorizationCodeExpirationTime time.Duration `yaml:"authorization_code_expiration_time" env:"OAUTH_CODE_EXPIRATION_TIME"`
+	AccessTokenExpirationTime       time.Duration `yaml:"access_token_expiration_time" env:"OAUTH_ACCESS_TOKEN_EXPIRATION_TIME"`
+	RefreshTokenExpirationTime      time.Duration `yaml:"refresh_token_expiration_time" env:"OAUTH_REFRESH_TOKEN_EXPIRATION_TIME"`
+}
+
+type Hashing struct {
+	Argon2Memory      uint32 `yaml:"argon2_memory" env:"ARGON2_MEMORY"`
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" env:"ARGON2_ITERATIONS"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" env:"ARGON2_PARALLELISM"`
+	SaltLength        int    `yaml:"salt_length" env:"HASH_SALT_LENGTH"`
+	KeyLength         uint32 `yaml:"key_length" env:"HASH_KEY_LENGTH"`
+}
+
+type MFA struct {
+	Issuer                  string        `yaml:"issuer" env:"MFA_ISSUER"`
+	Skew                    int64         `yaml:"skew" env:"MFA_SKEW"`
+	RecoveryCodes           int           `yaml:"recovery_codes" env:"MFA_RECOVERY_CODES"`
+	ChallengeExpirationTime time.Duration `yaml:"challenge_expiration_time" env:"MFA_CHALLENGE_EXPIRATION_TIME"`
+}
+
+type Lockout struct {
+	AccountThreshold int           `yaml:"account_threshold" env:"LOCKOUT_ACCOUNT_THRESHOLD"`
+	IPThreshold      int           `yaml:"ip_threshold" env:"LOCKOUT_IP_THRESHOLD"`
+	FreeAttempts     int           `yaml:"free_attempts" env:"LOCKOUT_FREE_ATTEMPTS"`
+	BaseDelay        time.Duration `yaml:"base_delay" env:"LOCKOUT_BASE_DELAY"`
+	MaxDelay         time.Duration `yaml:"max_delay" env:"LOCKOUT_MAX_DELAY"`
+	FailureWindow    time.Duration `yaml:"failure_window" env:"LOCKOUT_FAILURE_WINDOW"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration" env:"LOCKOUT_DURATION"`
+}
+
+type PasswordPolicy struct {
+	MinLength             int     `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MaxLength             int     `yaml:"max_length" env:"PASSWORD_MAX_LENGTH"`
+	MinEntropyBits        float64 `yaml:"min_entropy_bits" env:"PASSWORD_MIN_ENTROPY_BITS"`
+	BreachedPasswordsFile string  `yaml:"breached_passwords_file" env:"BREACHED_PASSWORDS_FILE"`
+	HistorySize           int     `yaml:"history_size" env:"PASSWORD_HISTORY_SIZE"`
+}
+
+type RegistrationPolicy struct {
+	AllowlistOnly         bool   `yaml:"allowlist_only" env:"REGISTRATION_ALLOWLIST_ONLY"`
+	DisposableDomainsFile string `yaml:"disposable_domains_file" env:"DISPOSABLE_DOMAINS_FILE"`
+}
+
+type EmailNormalization struct {
+	LowercaseLocalPart    bool     `yaml:"lowercase_local_part" env:"EMAIL_LOWERCASE_LOCAL_PART"`
+	RemoveSubaddress      bool     `yaml:"remove_subaddress" env:"EMAIL_REMOVE_SUBADDRESS"`
+	DotInsensitiveDomains []string `yaml:"dot_insensitive_domains" env:"EMAIL_DOT_INSENSITIVE_DOMAINS"`
+}
+
+type MagicLink struct {
+	Secret             string        `yaml:"secret" env:"MAGIC_LINK_SECRET" secret:"true"`
+	BaseURL            string        `yaml:"base_url" env:"MAGIC_LINK_BASE_URL"`
+	ExpirationTime     time.Duration `yaml:"expiration_time" env:"MAGIC_LINK_EXPIRATION_TIME"`
+	UndoExpirationTime time.Duration `yaml:"undo_expiration_time" env:"MAGIC_LINK_UNDO_EXPIRATION_TIME"`
 }
 
 type TokenSettings struct {
-	Secret         string
-	ExpirationTime time.Duration
+	Secret         string        `yaml:"secret" env:"TOKEN_SECRET" secret:"true"`
+	ExpirationTime time.Duration `yaml:"expiration_time" env:"TOKEN_EXPIRATION_TIME"`
 }
 
 type ZipCode struct {
-	ViaCEPBaseURL string
+	ViaCEPBaseURL string `yaml:"viacep_base_url" env:"VIACEP_BASE_URL"`
 }
 
 type Database struct {
-	FilePath string
-	Driver   string
-	Secrets  Secrets
+	FilePath string  `yaml:"file_path" env:"DB_FILE_PATH"`
+	Driver   string  `yaml:"driver" env:"DB_DRIVER"`
+	Secrets  Secrets `yaml:"secrets"`
 }
 
+// Secrets.CurrentID e PreviousID são identificadores opacos de cada segredo, gravados nos
+// hashes de senha para saber qual pepper usar; nunca derivam do segredo. Na rotação o
+// segredo e o ID atuais passam para previous
 type Secrets struct {
-	Previous string
-	Current  string
+	Previous   string `yaml:"previous" env:"DB_PREVIOUS_SECRET" secret:"true"`
+	Current    string `yaml:"current" env:"DB_CURRENT_SECRET" secret:"true"`
+	PreviousID string `yaml:"previous_id" env:"DB_PREVIOUS_SECRET_ID"`
+	CurrentID  string `yaml:"current_id" env:"DB_CURRENT_SECRET_ID"`
 }
 
-var settingsByEnvironment = map[Environment]Settings{
-	Local: {
+// defaults traz os valores de cada ambiente antes do arquivo de configuração e das
+// variáveis de ambiente. Fora do local as URLs públicas não têm padrão e precisam ser
+// configuradas, o que a validação cobra
+func defaults(environment Environment) Settings {
+	settings := Settings{
+		Environment: environment,
+		Server: Server{
+			Port:               8080,
+			ReadTimeout:        time.Second * 10,
+			WriteTimeout:       time.Second * 10,
+			IdleTimeout:        time.Minute,
+			MaxRequestBodySize: 1024 * 1024,
+			Concurrency:        256 * 1024,
+			ShutdownTimeout:    time.Second * 15,
+			TLS: TLS{
+				MinVersion:     "1.2",
+				ReloadInterval: time.Minute,
+				ClientAuth:     "none",
+			},
+		},
 		ZipCodeSettings: ZipCode{
 			ViaCEPBaseURL: "https://viacep.com.br/ws/",
 		},
 		Database: Database{
 			FilePath: "./database.db",
 			Driver:   "sqlite3",
-			Secrets:  Secrets{},
 		},
 		TokenSettings: TokenSettings{
 			ExpirationTime: time.Minute * 10,
 		},
 		MailValidationExpirationTime: time.Hour,
-	},
-	Staging: {
-		ZipCodeSettings: ZipCode{
-			ViaCEPBaseURL: "https://viacep.com.br/ws/",
+		MagicLinkSettings: MagicLink{
+			ExpirationTime:     time.Minute * 15,
+			UndoExpirationTime: time.Hour * 72,
 		},
-		Database: Database{
-			FilePath: "./database.db",
-			Driver:   "sqlite3",
-			Secrets:  Secrets{},
+		EmailNormalization: EmailNormalization{
+			LowercaseLocalPart: true,
 		},
-		TokenSettings: TokenSettings{
-			ExpirationTime: time.Minute * 10,
+		PasswordPolicy: PasswordPolicy{
+			MinLength:      8,
+			MaxLength:      128,
+			MinEntropyBits: 40,
+			HistorySize:    5,
 		},
-		MailValidationExpirationTime: time.Hour,
-	},
-	Production: {
-		ZipCodeSettings: ZipCode{
-			ViaCEPBaseURL: "https://viacep.com.br/ws/",
+		Lockout: Lockout{
+			AccountThreshold: 10,
+			IPThreshold:      50,
+			FreeAttempts:     3,
+			BaseDelay:        time.Second,
+			MaxDelay:         time.Minute,
+			FailureWindow:    time.Minute * 15,
+			LockoutDuration:  time.Minute * 15,
 		},
-		Database: Database{
-			FilePath: "./database.db",
-			Driver:   "sqlite3",
-			Secrets:  Secrets{},
+		MFA: MFA{
+			Issuer:                  "User Register",
+			Skew:                    1,
+			RecoveryCodes:           10,
+			ChallengeExpirationTime: time.Minute * 5,
 		},
-		TokenSettings: TokenSettings{
-			ExpirationTime: time.Minute * 10,
+		Hashing: Hashing{
+			Argon2Memory:      64 * 1024,
+			Argon2Iterations:  3,
+			Argon2Parallelism: 2,
+			SaltLength:        16,
+			KeyLength:         32,
 		},
-		MailValidationExpirationTime: time.Hour,
-	},
+		OAuth: OAuth{
+			AuthorizationCodeExpirationTime: time.Minute,
+			AccessTokenExpirationTime:       time.Minute * 10,
+			RefreshTokenExpirationTime:      time.Hour * 24 * 30,
+		},
+		OIDC: OIDC{
+			IDTokenExpirationTime: time.Minute * 10,
+		},
+		Health: Health{
+			Timeout: time.Second * 2,
+		},
+		Logging: Logging{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "user-register",
+		},
+		CORS: CORS{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Accept-Language", "Authorization", "Content-Type", "X-Request-ID", "traceparent", "tracestate"},
+			ExposedHeaders: []string{"Retry-After", "X-Request-ID"},
+			MaxAge:         time.Minute * 10,
+		},
+		SecurityHeaders: SecurityHeaders{
+			HSTSMaxAge:                   time.Hour * 24 * 365,
+			HSTSIncludeSubdomains:        true,
+			FrameOptions:                 "DENY",
+			ContentSecurityPolicy:        "default-src 'none'; frame-ancestors 'none'",
+			SwaggerContentSecurityPolicy: "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'",
+		},
+	}
+
+	if environment == Local {
+		settings.CORS.AllowedOrigins = []string{"*"}
+		settings.Logging.Format = "text"
+		settings.MagicLinkSettings.BaseURL = "http://localhost:8080/magic-link"
+		settings.OIDC.Issuer = "http://localhost:8080"
+	}
+
+	return settings
 }
 
-func LoadSettings(environment Environment) (Settings, error) {
-	settings := settingsByEnvironment[environment]
+// Load escolhe o ambiente pela variável APP_ENV, local por padrão
+func Load() (Settings, error) {
+	if err := loadDotEnv(); err != nil {
+		return Settings{}, err
+	}
 
-	if err := godotenv.Load("./.env"); err != nil {
-		log.Fatalf("Error loading .env file")
+	environment := Environment(os.Getenv("APP_ENV"))
+	if environment == "" {
+		environment = Local
 	}
 
-	value := os.Getenv("TOKEN_SECRET")
-	if value == "" {
-		return Settings{}, fmt.Errorf("TOKEN_SECRET is required")
+	return load(environment)
+}
+
+// load aplica, em ordem de precedência crescente, os padrões do ambiente, o arquivo de
+// configuração e as variáveis de ambiente. Quando a validação falha as configurações
+// carregadas são retornadas junto com um *ValidationError que lista todos os problemas
+func load(environment Environment) (Settings, error) {
+	switch environment {
+	case Local, Staging, Production:
+	default:
+		return Settings{}, fmt.Errorf("unknown environment %q, expected one of: local, staging, production", environment)
 	}
-	settings.TokenSettings.Secret = value
 
-	value = os.Getenv("DB_CURRENT_SECRET")
-	if value == "" {
-		return Settings{}, fmt.Errorf("DB_CURRENT_SECRET is required")
+	settings := defaults(environment)
+
+	path, err := configFile(environment)
+	if err != nil {
+		return Settings{}, err
+	}
+	if path != "" {
+		if err := loadFile(path, &settings); err != nil {
+			return Settings{}, err
+		}
 	}
-	settings.Database.Secrets.Current = value
 
-	value = os.Getenv("DB_PREVIOUS_SECRET")
-	if value == "" {
-		return Settings{}, fmt.Errorf("DB_PREVIOUS_SECRET is required")
+	problems := applyEnv(&settings, os.LookupEnv)
+	problems = append(problems, settings.validate()...)
+	if len(problems) > 0 {
+		return settings, &ValidationError{Problems: problems}
 	}
-	settings.Database.Secrets.Previous = value
 
 	return settings, nil
 }
+
+// loadDotEnv lê o .env quando ele existe; em containers as variáveis costumam vir do ambiente
+func loadDotEnv() error {
+	err := godotenv.Load("./.env")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to load .env file: %w", err)
+	}
+	return nil
+}
+
+// configFile usa CONFIG_FILE ou, se ausente, o primeiro config/<ambiente>.{yaml,yml,toml} existente
+func configFile(environment Environment) (string, error) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("failed to read config file: %w", err)
+		}
+		return path, nil
+	}
+
+	for _, extension := range []string{"yaml", "yml", "toml"} {
+		path := fmt.Sprintf("config/%s.%s", environment, extension)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,243 @@
+package settings
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setSecrets(t *testing.T) {
+	t.Setenv("TOKEN_SECRET", "token-secret")
+	t.Setenv("MAGIC_LINK_SECRET", "magic-link-secret")
+	t.Setenv("DB_PREVIOUS_SECRET", "previous-secret")
+	t.Setenv("DB_CURRENT_SECRET", "current-secret")
+	t.Setenv("DB_PREVIOUS_SECRET_ID", "v1")
+	t.Setenv("DB_CURRENT_SECRET_ID", "v2")
+}
+
+func writeConfig(t *testing.T, name, content string) {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoad_Layering(t *testing.T) {
+	setSecrets(t)
+	writeConfig(t, "config.yaml", `
+server:
+  port: 9090
+token:
+  expiration_time: 20m
+database:
+  file_path: /data/users.db
+email_normalization:
+  dot_insensitive_domains: [gmail.com]
+`)
+	t.Setenv("PORT", "9191")
+	t.Setenv("EMAIL_DOT_INSENSITIVE_DOMAINS", "gmail.com, googlemail.com")
+
+	sett, err := load(Local)
+	require.NoError(t, err)
+
+	require.Equal(t, 9191, sett.Server.Port)
+	require.Equal(t, time.Minute*20, sett.TokenSettings.ExpirationTime)
+	require.Equal(t, "/data/users.db", sett.Database.FilePath)
+	require.Equal(t, "sqlite3", sett.Database.Driver)
+	require.Equal(t, []string{"gmail.com", "googlemail.com"}, sett.EmailNormalization.DotInsensitiveDomains)
+	require.Equal(t, "token-secret", sett.TokenSettings.Secret)
+}
+
+func TestLoad_TOML(t *testing.T) {
+	setSecrets(t)
+	writeConfig(t, "config.toml", `
+# comentário
+admin_emails = ["admin@example.com", 'ops@example.com']
+
+[server]
+port = 9_000
+
+[password_policy]
+min_length = 10
+min_entropy_bits = 45.5 # bits
+
+[lockout]
+base_delay = "2s"
+oauth.refresh_token_expiration_time = "1h"
+`)
+
+	_, err := load(Local)
+	require.ErrorContains(t, err, `field oauth not found`)
+
+	writeConfig(t, "config.toml", `
+admin_emails = [
+  "admin@example.com",
+  'ops@example.com', # vírgula final
+]
+oauth.refresh_token_expiration_time = "1h"
+
+[server]
+port = 9_000
+
+[password_policy]
+min_length = 10
+min_entropy_bits = 45.5 # bits
+
+[lockout]
+base_delay = "2s"
+`)
+
+	sett, err := load(Local)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"admin@example.com", "ops@example.com"}, sett.AdminEmails)
+	require.Equal(t, 9000, sett.Server.Port)
+	require.Equal(t, 10, sett.PasswordPolicy.MinLength)
+	require.Equal(t, 45.5, sett.PasswordPolicy.MinEntropyBits)
+	require.Equal(t, time.Second*2, sett.Lockout.BaseDelay)
+	require.Equal(t, time.Hour, sett.OAuth.RefreshTokenExpirationTime)
+}
+
+func TestLoad_InvalidTOML(t *testing.T) {
+	setSecrets(t)
+	writeConfig(t, "config.toml", `
+[server]
+port = 9000
+port = 9001
+`)
+
+	_, err := load(Local)
+	require.ErrorContains(t, err, "failed to parse config file")
+}
+
+func TestLoad_ReportsAllProblems(t *testing.T) {
+	t.Setenv("PORT", "http")
+	t.Setenv("TOKEN_EXPIRATION_TIME", "ten minutes")
+	t.Setenv("PASSWORD_MAX_LENGTH", "4")
+	t.Setenv("TRACING_EXPORTER", "file")
+	t.Setenv("TRACING_SAMPLE_RATIO", "1.5")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,proxy.internal")
+
+	_, err := load(Production)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.ElementsMatch(t, []string{
+		`PORT: invalid integer "http"`,
+		`TOKEN_EXPIRATION_TIME: invalid duration "ten minutes"`,
+		"token.secret (TOKEN_SECRET) is required",
+		"database.secrets.current (DB_CURRENT_SECRET) is required",
+		"database.secrets.previous (DB_PREVIOUS_SECRET) is required",
+		"database.secrets.current_id (DB_CURRENT_SECRET_ID) must have 1 to 32 letters, digits, - or _",
+		"database.secrets.previous_id (DB_PREVIOUS_SECRET_ID) must have 1 to 32 letters, digits, - or _",
+		"database.secrets.current_id (DB_CURRENT_SECRET_ID) and database.secrets.previous_id (DB_PREVIOUS_SECRET_ID) must be different",
+		"magic_link.secret (MAGIC_LINK_SECRET) is required",
+		"magic_link.base_url (MAGIC_LINK_BASE_URL) must be an absolute http(s) URL",
+		"oidc.issuer (OIDC_ISSUER) must be an absolute http(s) URL",
+		"oidc.signing_key_file (OIDC_SIGNING_KEY_FILE) is required outside local",
+		"metrics.token (METRICS_TOKEN) is required outside local",
+		"password_policy.max_length (PASSWORD_MAX_LENGTH) must not be lower than password_policy.min_length",
+		"tracing.file (TRACING_FILE) is required when tracing.exporter is file",
+		"tracing.sample_ratio (TRACING_SAMPLE_RATIO) must be between 0 and 1",
+		`server.trusted_proxies (TRUSTED_PROXIES): invalid trusted proxy "proxy.internal", expected an IP or a CIDR range`,
+	}, validationErr.Problems)
+}
+
+func TestLoad_ProductionRequirements(t *testing.T) {
+	setSecrets(t)
+	t.Setenv("OIDC_ISSUER", "http://id.example.com")
+	t.Setenv("MAGIC_LINK_BASE_URL", "http://app.example.com/magic-link")
+
+	_, err := load(Production)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.ElementsMatch(t, []string{
+		"oidc.signing_key_file (OIDC_SIGNING_KEY_FILE) is required outside local",
+		"metrics.token (METRICS_TOKEN) is required outside local",
+		"oidc.issuer (OIDC_ISSUER) must use https outside local",
+		"magic_link.base_url (MAGIC_LINK_BASE_URL) must use https outside local",
+	}, validationErr.Problems)
+
+	// os mesmos valores servem em desenvolvimento
+	_, err = load(Local)
+	require.NoError(t, err)
+
+	key := filepath.Join(t.TempDir(), "oidc.pem")
+	require.NoError(t, os.WriteFile(key, []byte("key"), 0o600))
+	t.Setenv("OIDC_SIGNING_KEY_FILE", key)
+	t.Setenv("METRICS_TOKEN", "metrics-token")
+	t.Setenv("OIDC_ISSUER", "https://id.example.com")
+	t.Setenv("MAGIC_LINK_BASE_URL", "https://app.example.com/magic-link")
+
+	_, err = load(Production)
+	require.NoError(t, err)
+}
+
+func TestLoad_CORS(t *testing.T) {
+	setSecrets(t)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*, https://app.example.com, https://*.example.org:8443, app.example.com, https://example.com/path, https://a.*.example.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("FRAME_OPTIONS", "ALLOW")
+
+	_, err := load(Local)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.ElementsMatch(t, []string{
+		"cors.allowed_origins (CORS_ALLOWED_ORIGINS) cannot be * when cors.allow_credentials (CORS_ALLOW_CREDENTIALS) is true",
+		`cors.allowed_origins (CORS_ALLOWED_ORIGINS): "app.example.com" must be *, scheme://host[:port] or scheme://*.host[:port]`,
+		`cors.allowed_origins (CORS_ALLOWED_ORIGINS): "https://example.com/path" must be *, scheme://host[:port] or scheme://*.host[:port]`,
+		`cors.allowed_origins (CORS_ALLOWED_ORIGINS): "https://a.*.example.com" must be *, scheme://host[:port] or scheme://*.host[:port]`,
+		"security_headers.frame_options (FRAME_OPTIONS) must be DENY or SAMEORIGIN",
+	}, validationErr.Problems)
+}
+
+func TestTLS_Ciphers(t *testing.T) {
+	tests := []struct {
+		name     string
+		suites   []string
+		expected []uint16
+		err      string
+	}{
+		{name: "Default", suites: nil},
+		{name: "TLS 1.2 suites", suites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}, expected: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}},
+		{name: "TLS 1.3 suite", suites: []string{"TLS_AES_128_GCM_SHA256"}, err: `cipher suite "TLS_AES_128_GCM_SHA256" is a TLS 1.3 suite`},
+		{name: "Insecure suite", suites: []string{"TLS_RSA_WITH_RC4_128_SHA"}, err: `unsupported cipher suite "TLS_RSA_WITH_RC4_128_SHA"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := TLS{CipherSuites: tt.suites}.Ciphers()
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, ids)
+		})
+	}
+}
+
+func TestLoad_UnknownEnvironment(t *testing.T) {
+	_, err := load("qa")
+	require.ErrorContains(t, err, `unknown environment "qa"`)
+}
+
+func TestSettings_Redacted(t *testing.T) {
+	sett := defaults(Local)
+	sett.TokenSettings.Secret = "token-secret"
+	sett.Database.Secrets.Current = "current-secret"
+
+	redactedSettings := sett.Redacted()
+
+	require.Equal(t, redacted, redactedSettings.TokenSettings.Secret)
+	require.Equal(t, redacted, redactedSettings.Database.Secrets.Current)
+	require.Empty(t, redactedSettings.Database.Secrets.Previous)
+	require.Equal(t, sett.Database.FilePath, redactedSettings.Database.FilePath)
+	require.Equal(t, "token-secret", sett.TokenSettings.Secret)
+}
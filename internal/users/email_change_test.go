@@ -0,0 +1,229 @@
+package users
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/mailvalidation"
+	"github.com/juliovcruz/user-register/internal/platform/database"
+	"github.com/juliovcruz/user-register/internal/security/hash"
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/juliovcruz/user-register/internal/users/normalization"
+	"github.com/stretchr/testify/require"
+)
+
+// mailboxMock guarda o último código e o último link enviados para cada e-mail
+type mailboxMock struct {
+	codes map[string]int
+	links map[string]string
+}
+
+func (m *mailboxMock) Send(ctx context.Context, email string, code int) error {
+	m.codes[email] = code
+	return nil
+}
+
+func (m *mailboxMock) SendLink(ctx context.Context, email string, purpose mailvalidation.Purpose, link string) error {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	m.links[email] = parsed.Query().Get("token")
+	return nil
+}
+
+func (m *mailboxMock) SendNotification(ctx context.Context, email string, notification mailvalidation.Notification) error {
+	return nil
+}
+
+type emailChangeTest struct {
+	service *Service
+	repo    repository
+	mailbox *mailboxMock
+	metrics *metricsRecorderMock
+}
+
+func newEmailChangeTest(t *testing.T) emailChangeTest {
+	db, err := database.NewDatabase(t.TempDir()+"/database.db", "sqlite3")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	repo, err := NewSQLiteRepository(db)
+	require.NoError(t, err)
+
+	mailbox := &mailboxMock{codes: map[string]int{}, links: map[string]string{}}
+	linkSettings := settings.MagicLink{Secret: "link-secret", BaseURL: "http://localhost/magic-link", ExpirationTime: time.Minute, UndoExpirationTime: time.Hour}
+	metrics := &metricsRecorderMock{}
+	mailValidation := mailvalidation.NewService(mailvalidation.NewRepository(db), mailbox, time.Hour, linkSettings, metrics)
+
+	service := NewService(
+		repo, &tokenServiceMock{}, &zipCodeServiceMock{}, &hashServiceMock{}, mailValidation,
+		normalization.NewService(settings.EmailNormalization{LowercaseLocalPart: true, RemoveSubaddress: true, DotInsensitiveDomains: []string{"gmail.com"}}),
+		&registrationPolicyMock{}, &passwordPolicyMock{}, &loginLimiterMock{},
+		&mfaServiceMock{}, metrics, slog.Default(),
+	)
+	return emailChangeTest{service: service, repo: repo, mailbox: mailbox, metrics: metrics}
+}
+
+func (e emailChangeTest) createUser(t *testing.T, email string) User {
+	canonical, err := e.service.emailNormalizer.Normalize(email)
+	require.NoError(t, err)
+	user, err := e.repo.Create(context.Background(), User{Name: "User Name", Email: email, EmailCanonical: canonical, Password: "hash"})
+	require.NoError(t, err)
+	return user
+}
+
+func (e emailChangeTest) changeEmail(t *testing.T, user User, newEmail string) {
+	ctx := context.Background()
+	user, err := e.repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NoError(t, e.service.RequestEmailChange(ctx, user, newEmail))
+	change, err := e.repo.GetPendingEmailChange(ctx, user.ID)
+	require.NoError(t, err)
+	require.NoError(t, e.service.ConfirmEmailChange(ctx, user, e.mailbox.codes[change.NewEmail]))
+}
+
+func (e emailChangeTest) email(t *testing.T, id int64) string {
+	user, err := e.repo.GetByID(context.Background(), id)
+	require.NoError(t, err)
+	return user.Email
+}
+
+func TestService_EmailChange(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Request, confirm and undo", func(t *testing.T) {
+		e := newEmailChangeTest(t)
+		user := e.createUser(t, "old@example.com")
+
+		now := time.Now()
+		session := Session{ID: "session", UserID: user.ID, CreatedAt: now, LastUsedAt: now, ExpiresAt: now.Add(time.Hour)}
+		require.NoError(t, e.repo.CreateSession(ctx, session))
+
+		require.NoError(t, e.service.RequestEmailChange(ctx, user, "new@example.com"))
+		require.Equal(t, "old@example.com", e.email(t, user.ID))
+
+		require.Error(t, e.service.ConfirmEmailChange(ctx, user, e.mailbox.codes["new@example.com"]+1))
+		require.NoError(t, e.service.ConfirmEmailChange(ctx, user, e.mailbox.codes["new@example.com"]))
+		require.Equal(t, "new@example.com", e.email(t, user.ID))
+
+		revoked, err := e.repo.GetSession(ctx, session.ID)
+		require.NoError(t, err)
+		require.NotNil(t, revoked.RevokedAt)
+
+		undo := e.mailbox.links["old@example.com"]
+		require.NotEmpty(t, undo)
+		require.NoError(t, e.service.UndoEmailChange(ctx, undo))
+		require.Equal(t, "old@example.com", e.email(t, user.ID))
+
+		require.ErrorIs(t, e.service.UndoEmailChange(ctx, undo), mailvalidation.ErrLinkAlreadyUsed)
+	})
+
+	t.Run("Same and taken addresses", func(t *testing.T) {
+		e := newEmailChangeTest(t)
+		user := e.createUser(t, "user@example.com")
+		e.createUser(t, "taken@example.com")
+
+		require.ErrorIs(t, e.service.RequestEmailChange(ctx, user, "user@example.com"), ErrSameEmail)
+		require.ErrorIs(t, e.service.RequestEmailChange(ctx, user, "taken@example.com"), ErrMailAlreadyExists)
+	})
+
+	t.Run("Keeps the address as typed and compares canonical keys", func(t *testing.T) {
+		e := newEmailChangeTest(t)
+		user := e.createUser(t, "Old.Name@Example.com")
+		other := e.createUser(t, "Other@example.com")
+
+		_, err := e.repo.Create(ctx, User{Name: "User Name", Email: "OTHER@example.com", EmailCanonical: "other@example.com", Password: "hash"})
+		require.ErrorIs(t, err, ErrMailAlreadyExists)
+
+		require.ErrorIs(t, e.service.RequestEmailChange(ctx, user, "old.name@EXAMPLE.com"), ErrSameEmail)
+		require.ErrorIs(t, e.service.RequestEmailChange(ctx, user, "other+news@example.com"), ErrMailAlreadyExists)
+
+		e.changeEmail(t, user, "New.Name+Tag@EXAMPLE.com")
+		require.Equal(t, "New.Name+Tag@example.com", e.email(t, user.ID))
+
+		found, err := e.repo.GetByEMail(ctx, "new.name@example.com")
+		require.NoError(t, err)
+		require.Equal(t, user.ID, found.ID)
+		require.ErrorIs(t, e.service.RequestEmailChange(ctx, other, "NEW.name@example.com"), ErrMailAlreadyExists)
+
+		require.NoError(t, e.service.UndoEmailChange(ctx, e.mailbox.links["Old.Name@Example.com"]))
+		require.Equal(t, "Old.Name@Example.com", e.email(t, user.ID))
+		found, err = e.repo.GetByEMail(ctx, "old.name@example.com")
+		require.NoError(t, err)
+		require.Equal(t, user.ID, found.ID)
+	})
+
+	t.Run("New request replaces the pending one", func(t *testing.T) {
+		e := newEmailChangeTest(t)
+		user := e.createUser(t, "user@example.com")
+
+		require.NoError(t, e.service.RequestEmailChange(ctx, user, "first@example.com"))
+		firstCode := e.mailbox.codes["first@example.com"]
+		require.NoError(t, e.service.RequestEmailChange(ctx, user, "second@example.com"))
+
+		if firstCode != e.mailbox.codes["second@example.com"] {
+			require.Error(t, e.service.ConfirmEmailChange(ctx, user, firstCode))
+		}
+		require.NoError(t, e.service.ConfirmEmailChange(ctx, user, e.mailbox.codes["second@example.com"]))
+		require.Equal(t, "second@example.com", e.email(t, user.ID))
+	})
+
+	t.Run("Concurrent changes to the same address", func(t *testing.T) {
+		e := newEmailChangeTest(t)
+		first := e.createUser(t, "first@example.com")
+		second := e.createUser(t, "second@example.com")
+
+		require.NoError(t, e.service.RequestEmailChange(ctx, first, "wanted@example.com"))
+		code := e.mailbox.codes["wanted@example.com"]
+		require.NoError(t, e.service.ConfirmEmailChange(ctx, first, code))
+
+		// o segundo pedido foi feito antes da confirmação do primeiro
+		require.NoError(t, e.repo.CreateEmailChange(ctx, EmailChange{UserID: second.ID, OldEmail: second.Email, NewEmail: "wanted@example.com", CreatedAt: time.Now()}))
+		require.NoError(t, e.service.mailValidationService.Create(ctx, "wanted@example.com"))
+		require.ErrorIs(t, e.service.ConfirmEmailChange(ctx, second, e.mailbox.codes["wanted@example.com"]), ErrMailAlreadyExists)
+		require.Equal(t, "second@example.com", e.email(t, second.ID))
+	})
+
+	t.Run("Undo link only reverts its own change", func(t *testing.T) {
+		e := newEmailChangeTest(t)
+		user := e.createUser(t, "a@example.com")
+
+		e.changeEmail(t, user, "b@example.com")
+		firstUndo := e.mailbox.links["a@example.com"]
+		e.changeEmail(t, user, "a@example.com")
+		e.changeEmail(t, user, "c@example.com")
+		lastUndo := e.mailbox.links["a@example.com"]
+		require.NotEqual(t, firstUndo, lastUndo)
+
+		require.ErrorIs(t, e.service.UndoEmailChange(ctx, firstUndo), ErrEmailChangeNotFound)
+		require.Equal(t, "c@example.com", e.email(t, user.ID))
+
+		require.NoError(t, e.service.UndoEmailChange(ctx, lastUndo))
+		require.Equal(t, "a@example.com", e.email(t, user.ID))
+	})
+}
+
+func TestService_LoginRehashesByCanonicalEmail(t *testing.T) {
+	ctx := context.Background()
+	e := newEmailChangeTest(t)
+	user := e.createUser(t, "Walter+news@Example.com")
+
+	hashService := e.service.hashService.(*hashServiceMock)
+	hashService.VerifyFunc = func(inputPassword, password string) hash.Result {
+		return hash.Result{Valid: inputPassword == "password", NeedsRehash: password == "hash"}
+	}
+	hashService.CreateFunc = func(password string) (string, error) {
+		return "rehashed", nil
+	}
+
+	_, err := e.service.Login(ctx, "WALTER+news@example.com", "password", ClientInfo{IP: "127.0.0.1"})
+	require.NoError(t, err)
+
+	stored, err := e.repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "rehashed", stored.Password)
+}
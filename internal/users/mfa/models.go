@@ -0,0 +1,34 @@
+package mfa
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotEnrolled    = errors.New("totp not enrolled")
+	ErrAlreadyEnabled = errors.New("totp already enabled")
+	ErrInvalidCode    = errors.New("invalid mfa code")
+	ErrRecordNotFound = errors.New("record not found")
+)
+
+type TOTP struct {
+	UserID       int64
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+type Enrollment struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	URI    string `json:"uri" example:"otpauth://totp/User%20Register:user@example.com?secret=JBSWY3DPEHPK3PXP"`
+}
+
+type ConfirmTOTP struct {
+	Code string `json:"code" validate:"required,len=6,numeric" example:"123456"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"abcd-efgh"`
+}
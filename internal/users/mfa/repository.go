@@ -0,0 +1,167 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &sqliteRepository{db: db}
+}
+
+func (r *sqliteRepository) CreateOrUpdateTOTP(ctx context.Context, totp TOTP) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO mfa_totp (user_id, secret, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			secret = excluded.secret,
+			confirmed_at = NULL,
+			last_used_step = 0,
+			created_at = excluded.created_at;
+	`, totp.UserID, totp.Secret, totp.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create totp: %w", err)
+	}
+	return nil
+}
+
+func (r *sqliteRepository) GetTOTP(ctx context.Context, userID int64) (TOTP, error) {
+	totp := TOTP{UserID: userID}
+	var confirmedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT secret, confirmed_at, last_used_step, created_at FROM mfa_totp WHERE user_id = ?
+	`, userID).Scan(&totp.Secret, &confirmedAt, &totp.LastUsedStep, &totp.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return totp, ErrRecordNotFound
+	} else if err != nil {
+		return totp, fmt.Errorf("failed to get totp: %w", err)
+	}
+
+	if confirmedAt.Valid {
+		totp.ConfirmedAt = &confirmedAt.Time
+	}
+
+	return totp, nil
+}
+
+func (r *sqliteRepository) UpdateSecret(ctx context.Context, userID int64, secret string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE mfa_totp SET secret = ? WHERE user_id = ?`, secret, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update totp secret: %w", err)
+	}
+	return nil
+}
+
+func (r *sqliteRepository) UseStep(ctx context.Context, userID, step int64) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE mfa_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?
+	`, step, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to update totp step: %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrInvalidCode
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) Confirm(ctx context.Context, userID, step int64, confirmedAt time.Time, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE mfa_totp SET confirmed_at = ?, last_used_step = ? WHERE user_id = ?
+	`, confirmedAt, step, userID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm totp: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, codeHash := range recoveryCodeHashes {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)
+		`, userID, codeHash)
+		if err != nil {
+			return fmt.Errorf("failed to create recovery code: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marca como usado um código de recuperação ainda livre cujo hash esteja
+// entre codeHashes, os hashes possíveis do mesmo código
+func (r *sqliteRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHashes []string, usedAt time.Time) error {
+	if len(codeHashes) == 0 {
+		return ErrInvalidCode
+	}
+
+	args := []any{usedAt, userID}
+	for _, codeHash := range codeHashes {
+		args = append(args, codeHash)
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE mfa_recovery_codes SET used_at = ?
+		WHERE id = (
+			SELECT id FROM mfa_recovery_codes
+			WHERE user_id = ? AND code_hash IN (?`+strings.Repeat(", ?", len(codeHashes)-1)+`) AND used_at IS NULL
+			LIMIT 1
+		)
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrInvalidCode
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) Delete(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_totp WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete totp: %w", err)
+	}
+
+	return tx.Commit()
+}
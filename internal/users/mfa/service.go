@@ -0,0 +1,180 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/security/totp"
+	"github.com/juliovcruz/user-register/internal/settings"
+)
+
+type Repository interface {
+	CreateOrUpdateTOTP(ctx context.Context, totp TOTP) error
+	GetTOTP(ctx context.Context, userID int64) (TOTP, error)
+	UpdateSecret(ctx context.Context, userID int64, secret string) error
+	UseStep(ctx context.Context, userID, step int64) error
+	Confirm(ctx context.Context, userID, step int64, confirmedAt time.Time, recoveryCodeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHashes []string, usedAt time.Time) error
+	Delete(ctx context.Context, userID int64) error
+}
+
+type encryptionService interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, bool, error)
+	Digest(value string) string
+	Digests(value string) []string
+}
+
+type Service struct {
+	repo       Repository
+	encryption encryptionService
+	settings   settings.MFA
+}
+
+func NewService(repo Repository, encryption encryptionService, settings settings.MFA) *Service {
+	return &Service{repo: repo, encryption: encryption, settings: settings}
+}
+
+func (s *Service) Enroll(ctx context.Context, userID int64, email string) (Enrollment, error) {
+	current, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		return Enrollment{}, err
+	}
+	if current.ConfirmedAt != nil {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	encrypted, err := s.encryption.Encrypt(secret)
+	if err != nil {
+		return Enrollment{}, fmt.Errorf("failed to encrypt totp secret: %w", err)
+	}
+
+	err = s.repo.CreateOrUpdateTOTP(ctx, TOTP{UserID: userID, Secret: encrypted, CreatedAt: time.Now()})
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	return Enrollment{Secret: secret, URI: totp.URI(s.settings.Issuer, email, secret)}, nil
+}
+
+func (s *Service) Confirm(ctx context.Context, userID int64, code string) (RecoveryCodes, error) {
+	current, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return RecoveryCodes{}, err
+	}
+	if current.ConfirmedAt != nil {
+		return RecoveryCodes{}, ErrAlreadyEnabled
+	}
+
+	secret, _, err := s.encryption.Decrypt(current.Secret)
+	if err != nil {
+		return RecoveryCodes{}, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), s.settings.Skew)
+	if !ok {
+		return RecoveryCodes{}, ErrInvalidCode
+	}
+
+	codes := make([]string, s.settings.RecoveryCodes)
+	hashes := make([]string, s.settings.RecoveryCodes)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return RecoveryCodes{}, err
+		}
+		hashes[i] = s.encryption.Digest(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err := s.repo.Confirm(ctx, userID, step, time.Now(), hashes); err != nil {
+		return RecoveryCodes{}, err
+	}
+
+	return RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+func (s *Service) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	current, err := s.repo.GetTOTP(ctx, userID)
+	if errors.Is(err, ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return current.ConfirmedAt != nil, nil
+}
+
+func (s *Service) Verify(ctx context.Context, userID int64, code string) error {
+	current, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if current.ConfirmedAt == nil {
+		return ErrNotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != totp.Digits {
+		return s.repo.UseRecoveryCode(ctx, userID, s.encryption.Digests(normalizeRecoveryCode(code)), time.Now())
+	}
+
+	secret, stale, err := s.encryption.Decrypt(current.Secret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), s.settings.Skew)
+	if !ok {
+		return ErrInvalidCode
+	}
+
+	if err := s.repo.UseStep(ctx, userID, step); err != nil {
+		return err
+	}
+
+	if stale {
+		encrypted, err := s.encryption.Encrypt(secret)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt totp secret: %w", err)
+		}
+		return s.repo.UpdateSecret(ctx, userID, encrypted)
+	}
+
+	return nil
+}
+
+func (s *Service) Reset(ctx context.Context, userID int64) error {
+	return s.repo.Delete(ctx, userID)
+}
+
+func (s *Service) getTOTP(ctx context.Context, userID int64) (TOTP, error) {
+	current, err := s.repo.GetTOTP(ctx, userID)
+	if errors.Is(err, ErrRecordNotFound) {
+		return TOTP{}, ErrNotEnrolled
+	}
+	return current, err
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return code[:4] + "-" + code[4:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
@@ -0,0 +1,135 @@
+package mfa
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/platform/database"
+	"github.com/juliovcruz/user-register/internal/security/encryption"
+	"github.com/juliovcruz/user-register/internal/security/totp"
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+)
+
+type mfaTest struct {
+	service *Service
+	repo    Repository
+	userID  int64
+}
+
+func newMFATest(t *testing.T) mfaTest {
+	db, err := database.NewDatabase(t.TempDir()+"/database.db", "sqlite3")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	result, err := db.Exec(`INSERT INTO users (name, email, email_canonical, password, address) VALUES ('User', 'user@example.com', 'user@example.com', 'hash', '{}')`)
+	require.NoError(t, err)
+	userID, err := result.LastInsertId()
+	require.NoError(t, err)
+
+	repo := NewRepository(db)
+	crypto := &encryption.Service{CurrentSecret: "current-secret", PreviousSecret: "previous-secret"}
+	service := NewService(repo, crypto, settings.MFA{Issuer: "User Register", Skew: 1, RecoveryCodes: 3})
+	return mfaTest{service: service, repo: repo, userID: userID}
+}
+
+// enable cadastra e confirma a MFA, retornando o segredo e os códigos de recuperação
+func (m mfaTest) enable(t *testing.T) (string, []string) {
+	ctx := context.Background()
+	enrollment, err := m.service.Enroll(ctx, m.userID, "user@example.com")
+	require.NoError(t, err)
+
+	codes, err := m.service.Confirm(ctx, m.userID, code(t, enrollment.Secret, 0))
+	require.NoError(t, err)
+	require.Len(t, codes.RecoveryCodes, 3)
+
+	return enrollment.Secret, codes.RecoveryCodes
+}
+
+func code(t *testing.T, secret string, offset int64) string {
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	require.NoError(t, err)
+	return code
+}
+
+func TestService_VerifyTOTP(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Accepts codes within the skew once", func(t *testing.T) {
+		m := newMFATest(t)
+		secret, _ := m.enable(t)
+
+		require.ErrorIs(t, m.service.Verify(ctx, m.userID, code(t, secret, -3)), ErrInvalidCode)
+		require.ErrorIs(t, m.service.Verify(ctx, m.userID, code(t, secret, 3)), ErrInvalidCode)
+		require.NoError(t, m.service.Verify(ctx, m.userID, code(t, secret, 1)))
+
+		// um passo já aceito, ou anterior a ele, não vale de novo
+		require.Error(t, m.service.Verify(ctx, m.userID, code(t, secret, 1)))
+		require.Error(t, m.service.Verify(ctx, m.userID, code(t, secret, -1)))
+	})
+
+	t.Run("Not enrolled", func(t *testing.T) {
+		m := newMFATest(t)
+		require.ErrorIs(t, m.service.Verify(ctx, m.userID, "123456"), ErrNotEnrolled)
+
+		_, err := m.service.Enroll(ctx, m.userID, "user@example.com")
+		require.NoError(t, err)
+		require.ErrorIs(t, m.service.Verify(ctx, m.userID, "123456"), ErrNotEnrolled)
+	})
+
+	t.Run("Confirm rejects a wrong code", func(t *testing.T) {
+		m := newMFATest(t)
+		enrollment, err := m.service.Enroll(ctx, m.userID, "user@example.com")
+		require.NoError(t, err)
+
+		_, err = m.service.Confirm(ctx, m.userID, code(t, enrollment.Secret, 5))
+		require.ErrorIs(t, err, ErrInvalidCode)
+	})
+}
+
+func TestService_RecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Each code works once", func(t *testing.T) {
+		m := newMFATest(t)
+		_, codes := m.enable(t)
+
+		require.NoError(t, m.service.Verify(ctx, m.userID, codes[0]))
+		require.ErrorIs(t, m.service.Verify(ctx, m.userID, codes[0]), ErrInvalidCode)
+		require.NoError(t, m.service.Verify(ctx, m.userID, " "+codes[1]+" "))
+		require.ErrorIs(t, m.service.Verify(ctx, m.userID, "zzzz-zzzz"), ErrInvalidCode)
+	})
+
+	t.Run("Codes are stored as keyed hashes", func(t *testing.T) {
+		m := newMFATest(t)
+		_, codes := m.enable(t)
+
+		plain := sha256.Sum256([]byte(codes[0]))
+		require.ErrorIs(t, m.repo.UseRecoveryCode(ctx, m.userID, []string{hex.EncodeToString(plain[:])}, time.Now()), ErrInvalidCode)
+		require.NoError(t, m.service.Verify(ctx, m.userID, codes[0]))
+
+		// um código guardado como SHA-256 sem chave nunca é aceito pelo serviço
+		plain = sha256.Sum256([]byte(codes[1]))
+		require.NoError(t, m.repo.Confirm(ctx, m.userID, 0, time.Now(), []string{hex.EncodeToString(plain[:])}))
+		require.ErrorIs(t, m.service.Verify(ctx, m.userID, codes[1]), ErrInvalidCode)
+	})
+
+	t.Run("Codes survive a key rotation", func(t *testing.T) {
+		m := newMFATest(t)
+		_, codes := m.enable(t)
+
+		m.service.encryption = &encryption.Service{CurrentSecret: "next-secret", PreviousSecret: "current-secret"}
+		require.NoError(t, m.service.Verify(ctx, m.userID, codes[0]))
+	})
+
+	t.Run("Reset invalidates the codes", func(t *testing.T) {
+		m := newMFATest(t)
+		_, codes := m.enable(t)
+
+		require.NoError(t, m.service.Reset(ctx, m.userID))
+		require.ErrorIs(t, m.service.Verify(ctx, m.userID, codes[0]), ErrNotEnrolled)
+	})
+}
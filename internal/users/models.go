@@ -1,6 +1,9 @@
 package users
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrNotFound   = errors.New("user not found")
@@ -8,10 +11,24 @@ var (
 )
 
 var (
-	ErrMailAlreadyExists = errors.New("mail already exists")
-	ErrPasswordMismatch  = errors.New("password and confirm password do not match")
-	ErrUserNotFound      = errors.New("user not found")
-	ErrInvalidLogin      = errors.New("invalid email or password")
+	ErrMailAlreadyExists   = errors.New("mail already exists")
+	ErrPasswordMismatch    = errors.New("password and confirm password do not match")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidLogin        = errors.New("invalid email or password")
+	ErrSameEmail           = errors.New("new email must be different from the current one")
+	ErrEmailChangeNotFound = errors.New("email change not found")
+	ErrSessionRevoked      = errors.New("session revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired mfa challenge")
+	ErrInvalidMFACode      = errors.New("invalid mfa code")
+	ErrInvalidPassword     = errors.New("current password is invalid")
+)
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
 )
 
 type Address struct {
@@ -26,31 +43,126 @@ type Address struct {
 type CreateUser struct {
 	Name            string `json:"name" validate:"required,min=3,max=100" example:"User Name"`
 	Email           string `json:"email" validate:"required,email" example:"user@example.com"`
-	Password        string `json:"password" validate:"required,min=6,max=100" example:"password"`
+	Password        string `json:"password" validate:"required" example:"correct-horse-battery"`
 	ZipCode         string `json:"zip_code" validate:"required,len=8" example:"74360400"`
-	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password" example:"password"`
+	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password" example:"correct-horse-battery"`
 }
 
 type User struct {
-	ID       int64   `json:"id"`
-	Name     string  `json:"name"`
-	Email    string  `json:"email"`
-	Password string  `json:"password"`
-	Address  Address `json:"address"`
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// EmailCanonical é a chave normalizada usada para unicidade e buscas; Email guarda o endereço como digitado
+	EmailCanonical string  `json:"-"`
+	EmailVerified  bool    `json:"email_verified"`
+	Role           Role    `json:"role"`
+	Password       string  `json:"-"`
+	Address        Address `json:"address"`
+
+	SessionsRevokedAt time.Time `json:"-"`
+	SessionID         string    `json:"-"`
+	AuthenticatedAt   time.Time `json:"-"`
+}
+
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"user_id"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type TokenClaims struct {
+	UserID    int64
+	Email     string
+	SessionID string
+	IssuedAt  time.Time
+}
+
+type EmailChange struct {
+	ID          int64
+	UserID      int64
+	OldEmail    string
+	NewEmail    string
+	CreatedAt   time.Time
+	ConfirmedAt *time.Time
 }
 
 type Login struct {
 	Email    string `json:"email" validate:"required,email" example:"user@example.com"`
-	Password string `json:"password" validate:"required,min=6,max=100" example:"password"`
+	Password string `json:"password" validate:"required" example:"password"`
 }
 
 type UpdatePassword struct {
 	Email           string `json:"email" validate:"required,email" example:"user@example.com"`
-	Password        string `json:"password" validate:"required,min=6,max=100" example:"password"`
-	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password" example:"password"`
+	Password        string `json:"password" validate:"required" example:"correct-horse-battery"`
+	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password" example:"correct-horse-battery"`
 	Code            int    `json:"code" validate:"required" example:"123456"`
 }
 
+type LoginResult struct {
+	Token       string
+	MFARequired bool
+	MFAToken    string
+}
+
+type LoginMFA struct {
+	MFAToken string `json:"mfa_token" validate:"required" example:"eyJhbGciOiJIUzI1NiIs..."`
+	Code     string `json:"code" validate:"required" example:"123456"`
+}
+
+type ChangePassword struct {
+	CurrentPassword string `json:"current_password" validate:"required" example:"password"`
+	Password        string `json:"password" validate:"required" example:"correct-horse-battery"`
+	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password" example:"correct-horse-battery"`
+}
+
 type ForgotPassword struct {
 	Email string `json:"email" validate:"required,email" example:"user@example.com"`
 }
+
+type ResetPasswordWithLink struct {
+	Token           string `json:"token" validate:"required" example:"eyJwdXJwb3NlIjoi..."`
+	Password        string `json:"password" validate:"required" example:"correct-horse-battery"`
+	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password" example:"correct-horse-battery"`
+}
+
+type RequestLink struct {
+	Email string `json:"email" validate:"required,email" example:"user@example.com"`
+}
+
+type ConsumeLink struct {
+	Token string `json:"token" validate:"required" example:"eyJwdXJwb3NlIjoi..."`
+}
+
+type RequestEmailChange struct {
+	Email string `json:"email" validate:"required,email" example:"new@example.com"`
+}
+
+type ConfirmEmailChange struct {
+	Code int `json:"code" validate:"required" example:"123456"`
+}
+
+type PepperStatus struct {
+	Current  int `json:"current"`
+	Previous int `json:"previous"`
+	Legacy   int `json:"legacy"`
+	Unknown  int `json:"unknown"`
+}
+
+type ForcePepperReset struct {
+	IncludeLegacy bool `json:"include_legacy" example:"false"`
+}
+
+type ForcedPasswordResets struct {
+	Users int `json:"users"`
+}
@@ -0,0 +1,76 @@
+package normalization
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalidEmail = errors.New("invalid email")
+
+type Service struct {
+	settings settings.EmailNormalization
+}
+
+func NewService(settings settings.EmailNormalization) *Service {
+	return &Service{settings: settings}
+}
+
+// Clean apara espaços e converte o domínio para minúsculas em ASCII, preservando a parte
+// local como o usuário informou. É a forma guardada e usada no envio de e-mails
+func (s *Service) Clean(email string) (string, error) {
+	localPart, domain, err := split(email)
+	if err != nil {
+		return "", err
+	}
+	return localPart + "@" + domain, nil
+}
+
+// Normalize retorna a chave canônica do e-mail, usada para unicidade e buscas; aplica as
+// regras configuradas de caixa, subendereço e pontos, que nunca alteram o e-mail guardado
+func (s *Service) Normalize(email string) (string, error) {
+	localPart, domain, err := split(email)
+	if err != nil {
+		return "", err
+	}
+	return s.normalizeLocalPart(localPart, domain) + "@" + domain, nil
+}
+
+func split(email string) (string, string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", "", ErrInvalidEmail
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.ToLower(email[at+1:]))
+	if err != nil {
+		return "", "", ErrInvalidEmail
+	}
+
+	return email[:at], domain, nil
+}
+
+func (s *Service) normalizeLocalPart(localPart, domain string) string {
+	if s.settings.LowercaseLocalPart {
+		localPart = strings.ToLower(localPart)
+	}
+
+	if s.settings.RemoveSubaddress {
+		if plus := strings.Index(localPart, "+"); plus > 0 {
+			localPart = localPart[:plus]
+		}
+	}
+
+	for _, dotlessDomain := range s.settings.DotInsensitiveDomains {
+		if strings.EqualFold(domain, dotlessDomain) {
+			localPart = strings.ReplaceAll(localPart, ".", "")
+			break
+		}
+	}
+
+	return localPart
+}
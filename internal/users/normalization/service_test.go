@@ -0,0 +1,92 @@
+package normalization
+
+import (
+	"testing"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Normalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		settings      settings.EmailNormalization
+		input         string
+		expected      string
+		expectedError error
+	}{
+		{
+			name:     "Trim and lowercase domain",
+			input:    "  User@Example.COM ",
+			expected: "User@example.com",
+		},
+		{
+			name:     "Lowercase local part",
+			settings: settings.EmailNormalization{LowercaseLocalPart: true},
+			input:    "User@Example.com",
+			expected: "user@example.com",
+		},
+		{
+			name:     "Remove subaddress",
+			settings: settings.EmailNormalization{RemoveSubaddress: true},
+			input:    "user+news@example.com",
+			expected: "user@example.com",
+		},
+		{
+			name:     "Remove dots on configured domains",
+			settings: settings.EmailNormalization{DotInsensitiveDomains: []string{"gmail.com"}},
+			input:    "first.last@Gmail.com",
+			expected: "firstlast@gmail.com",
+		},
+		{
+			name:     "Keep dots on other domains",
+			settings: settings.EmailNormalization{DotInsensitiveDomains: []string{"gmail.com"}},
+			input:    "first.last@example.com",
+			expected: "first.last@example.com",
+		},
+		{
+			name:     "IDN domain to punycode",
+			input:    "user@Exämple.com",
+			expected: "user@xn--exmple-cua.com",
+		},
+		{
+			name:          "Missing domain",
+			input:         "user@",
+			expectedError: ErrInvalidEmail,
+		},
+		{
+			name:          "Missing at sign",
+			input:         "user.example.com",
+			expectedError: ErrInvalidEmail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := NewService(tt.settings).Normalize(tt.input)
+
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, email)
+		})
+	}
+}
+
+func TestService_Clean(t *testing.T) {
+	service := NewService(settings.EmailNormalization{
+		LowercaseLocalPart:    true,
+		RemoveSubaddress:      true,
+		DotInsensitiveDomains: []string{"gmail.com"},
+	})
+
+	email, err := service.Clean("  First.Last+News@Gmail.COM ")
+	require.NoError(t, err)
+	require.Equal(t, "First.Last+News@gmail.com", email)
+
+	_, err = service.Clean("user@")
+	require.ErrorIs(t, err, ErrInvalidEmail)
+}
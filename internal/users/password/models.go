@@ -0,0 +1,38 @@
+package password
+
+import "strings"
+
+type Rule string
+
+const (
+	RuleMinLength    Rule = "min_length"
+	RuleMaxLength    Rule = "max_length"
+	RuleMinEntropy   Rule = "min_entropy"
+	RulePersonalInfo Rule = "personal_info"
+	RuleBreached     Rule = "breached"
+	RuleHistory      Rule = "history"
+)
+
+type Violation struct {
+	Rule    Rule   `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// PolicyError lista todas as regras da política de senha que não foram atendidas
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+var ErrReused = &PolicyError{Violations: []Violation{{
+	Rule:    RuleHistory,
+	Message: "password must be different from the ones used recently",
+}}}
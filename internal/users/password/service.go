@@ -0,0 +1,209 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+)
+
+//go:embed breached_passwords.txt
+var embeddedBreachedPasswords string
+
+const hashPrefixLength = 5
+
+type Service struct {
+	settings settings.PasswordPolicy
+	// breached guarda os SHA-1 das senhas vazadas agrupados pelos 5 primeiros
+	// caracteres, no mesmo formato de consulta por intervalo do k-anonymity
+	breached map[string]map[string]struct{}
+}
+
+func NewService(settings settings.PasswordPolicy) (*Service, error) {
+	breached := map[string]map[string]struct{}{}
+	if err := readHashes(strings.NewReader(embeddedBreachedPasswords), breached); err != nil {
+		return nil, err
+	}
+
+	if settings.BreachedPasswordsFile != "" {
+		file, err := os.Open(settings.BreachedPasswordsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open breached passwords file: %w", err)
+		}
+		defer file.Close()
+
+		if err := readHashes(file, breached); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Service{settings: settings, breached: breached}, nil
+}
+
+// Check valida a senha contra todas as regras e retorna um *PolicyError com cada
+// regra violada. name e email são opcionais e servem para recusar senhas com dados do usuário
+func (s *Service) Check(password, name, email string) error {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < s.settings.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Param:   strconv.Itoa(s.settings.MinLength),
+			Message: fmt.Sprintf("password must have at least %d characters", s.settings.MinLength),
+		})
+	}
+
+	if s.settings.MaxLength > 0 && length > s.settings.MaxLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxLength,
+			Param:   strconv.Itoa(s.settings.MaxLength),
+			Message: fmt.Sprintf("password must have at most %d characters", s.settings.MaxLength),
+		})
+	}
+
+	if Entropy(password) < s.settings.MinEntropyBits {
+		violations = append(violations, Violation{
+			Rule:    RuleMinEntropy,
+			Param:   strconv.FormatFloat(s.settings.MinEntropyBits, 'f', -1, 64),
+			Message: "password is too easy to guess, use a longer password with more kinds of characters",
+		})
+	}
+
+	if containsPersonalInfo(password, name, email) {
+		violations = append(violations, Violation{
+			Rule:    RulePersonalInfo,
+			Message: "password must not contain your name or email",
+		})
+	}
+
+	if s.isBreached(password) {
+		violations = append(violations, Violation{
+			Rule:    RuleBreached,
+			Message: "password appeared in a data breach, choose a different one",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// HistorySize é a quantidade de senhas recentes, incluindo a atual, que não podem ser reutilizadas
+func (s *Service) HistorySize() int {
+	return s.settings.HistorySize
+}
+
+// Entropy estima os bits de entropia pelo tamanho do alfabeto usado, ignorando
+// caracteres repetidos e sequências como "aaaa" ou "1234"
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	effectiveLength := 0
+	previous := rune(-1)
+
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+
+		if r != previous && r != previous+1 && r != previous-1 {
+			effectiveLength++
+		}
+		previous = r
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(effectiveLength) * math.Log2(float64(pool))
+}
+
+func containsPersonalInfo(password, name, email string) bool {
+	password = strings.ToLower(password)
+
+	parts := strings.Fields(strings.ToLower(name))
+	if at := strings.LastIndex(email, "@"); at > 0 {
+		parts = append(parts, strings.ToLower(email[:at]), strings.ToLower(email))
+	}
+
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Service) isBreached(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, found := s.breached[hash[:hashPrefixLength]]
+	if !found {
+		return false
+	}
+
+	_, found = suffixes[hash[hashPrefixLength:]]
+	return found
+}
+
+func readHashes(reader io.Reader, breached map[string]map[string]struct{}) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+
+		prefix := hash[:hashPrefixLength]
+		if breached[prefix] == nil {
+			breached[prefix] = map[string]struct{}{}
+		}
+		breached[prefix][hash[hashPrefixLength:]] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read breached passwords: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+)
+
+func rules(err error) []Rule {
+	policyErr, ok := err.(*PolicyError)
+	if !ok {
+		return nil
+	}
+
+	var rules []Rule
+	for _, violation := range policyErr.Violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestService_Check(t *testing.T) {
+	service, err := NewService(settings.PasswordPolicy{MinLength: 8, MaxLength: 64, MinEntropyBits: 40})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		password      string
+		userName      string
+		email         string
+		expectedRules []Rule
+	}{
+		{
+			name:     "Strong password",
+			password: "correct-horse-battery",
+			userName: "User Name",
+			email:    "user@example.com",
+		},
+		{
+			name:          "Too short",
+			password:      "Xk9#",
+			expectedRules: []Rule{RuleMinLength, RuleMinEntropy},
+		},
+		{
+			name:          "Too long",
+			password:      "correct-horse-battery-staple-correct-horse-battery-staple-correct",
+			expectedRules: []Rule{RuleMaxLength},
+		},
+		{
+			name:          "Repeated and sequential characters",
+			password:      "aaaaaaaa12345678",
+			expectedRules: []Rule{RuleMinEntropy},
+		},
+		{
+			name:          "Contains name",
+			password:      "juliana-horse-battery",
+			userName:      "Juliana Souza",
+			email:         "user@example.com",
+			expectedRules: []Rule{RulePersonalInfo},
+		},
+		{
+			name:          "Contains email local part",
+			password:      "horse-battery-jsouza",
+			userName:      "Juliana Souza",
+			email:         "jsouza@example.com",
+			expectedRules: []Rule{RulePersonalInfo},
+		},
+		{
+			name:          "Breached password",
+			password:      "password123",
+			expectedRules: []Rule{RuleBreached},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.Check(tt.password, tt.userName, tt.email)
+			if tt.expectedRules == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Equal(t, tt.expectedRules, rules(err))
+		})
+	}
+}
+
+func TestService_BreachedPasswordsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// SHA-1 de "correct-horse-battery"
+	require.NoError(t, os.WriteFile(path, []byte("# corpus local\nf97979ff44a9a1a4105f4bae6fe809715e0a0a84:3\nB7A1D0C7F5F2A2E5B2C1D9E8F7A6B5C4D3E2F1A0\n"), 0o600))
+
+	service, err := NewService(settings.PasswordPolicy{MinLength: 8, MinEntropyBits: 40, BreachedPasswordsFile: path})
+	require.NoError(t, err)
+
+	require.True(t, service.isBreached("correct-horse-battery"))
+	require.True(t, service.isBreached("password123"))
+	require.False(t, service.isBreached("another-horse-battery"))
+
+	_, err = NewService(settings.PasswordPolicy{BreachedPasswordsFile: filepath.Join(t.TempDir(), "missing.txt")})
+	require.Error(t, err)
+}
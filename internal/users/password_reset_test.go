@@ -0,0 +1,133 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	"github.com/juliovcruz/user-register/internal/mailvalidation"
+	"github.com/juliovcruz/user-register/internal/security/hash"
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/juliovcruz/user-register/internal/users/password"
+	"github.com/stretchr/testify/require"
+)
+
+// newPasswordResetTest usa o hash e a política de senha reais sobre o banco do teste de troca de e-mail
+func newPasswordResetTest(t *testing.T) emailChangeTest {
+	e := newEmailChangeTest(t)
+
+	policy, err := password.NewService(settings.PasswordPolicy{MinLength: 8, MinEntropyBits: 40, HistorySize: 3})
+	require.NoError(t, err)
+	e.service.passwordPolicy = policy
+	e.service.hashService = &hash.Service{
+		CurrentSecret: "current",
+		CurrentKeyID:  "v1",
+		Metrics:       e.metrics,
+		Settings:      settings.Hashing{Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1, SaltLength: 16, KeyLength: 32},
+	}
+	return e
+}
+
+func (e emailChangeTest) passwordMatches(t *testing.T, id int64, password string) bool {
+	user, err := e.repo.GetByID(context.Background(), id)
+	require.NoError(t, err)
+	return e.service.hashService.Verify(context.Background(), password, user.Password).Valid
+}
+
+const (
+	newPassword   = "Tq8#mVz!pL2w"
+	otherPassword = "Zr7$kWq!mN3x"
+	thirdPassword = "Hb4%xYt!cR9p"
+)
+
+func TestService_UpdatePassword(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Invalid codes look the same for known and unknown emails", func(t *testing.T) {
+		e := newPasswordResetTest(t)
+		e.createUser(t, "walter@example.com")
+
+		for _, email := range []string{"walter@example.com", "unknown@example.com"} {
+			err := e.service.UpdatePassword(ctx, UpdatePassword{Email: email, Code: 123456, Password: newPassword, ConfirmPassword: newPassword})
+			require.ErrorIs(t, err, mailvalidation.ErrInvalidCode)
+		}
+
+		require.NoError(t, e.service.ForgotPassword(ctx, "walter@example.com"))
+		code := e.mailbox.codes["walter@example.com"]
+		err := e.service.UpdatePassword(ctx, UpdatePassword{Email: "walter@example.com", Code: code + 1, Password: newPassword, ConfirmPassword: newPassword})
+		require.ErrorIs(t, err, mailvalidation.ErrInvalidCode)
+	})
+
+	t.Run("Policy failure keeps the code", func(t *testing.T) {
+		e := newPasswordResetTest(t)
+		user := e.createUser(t, "walter@example.com")
+		require.NoError(t, e.service.ForgotPassword(ctx, "walter@example.com"))
+		code := e.mailbox.codes["walter@example.com"]
+
+		weak := "Walter#2024xq"
+		err := e.service.UpdatePassword(ctx, UpdatePassword{Email: "walter@example.com", Code: code, Password: weak, ConfirmPassword: weak})
+		var policyErr *password.PolicyError
+		require.ErrorAs(t, err, &policyErr)
+
+		require.NoError(t, e.service.UpdatePassword(ctx, UpdatePassword{Email: "walter@example.com", Code: code, Password: newPassword, ConfirmPassword: newPassword}))
+		require.True(t, e.passwordMatches(t, user.ID, newPassword))
+		require.Equal(t, 1, e.metrics.Recorded["password_reset:completed"])
+
+		err = e.service.UpdatePassword(ctx, UpdatePassword{Email: "walter@example.com", Code: code, Password: newPassword, ConfirmPassword: newPassword})
+		require.ErrorIs(t, err, mailvalidation.ErrInvalidCode)
+	})
+}
+
+func TestService_ResetPasswordWithLink(t *testing.T) {
+	ctx := context.Background()
+	e := newPasswordResetTest(t)
+	user := e.createUser(t, "walter@example.com")
+	require.NoError(t, e.service.ForgotPassword(ctx, "walter@example.com"))
+	token := e.mailbox.links["walter@example.com"]
+
+	weak := "Walter#2024xq"
+	err := e.service.ResetPasswordWithLink(ctx, ResetPasswordWithLink{Token: token, Password: weak, ConfirmPassword: weak})
+	var policyErr *password.PolicyError
+	require.ErrorAs(t, err, &policyErr)
+
+	// a senha recusada não gasta o link
+	require.NoError(t, e.service.ResetPasswordWithLink(ctx, ResetPasswordWithLink{Token: token, Password: newPassword, ConfirmPassword: newPassword}))
+	require.True(t, e.passwordMatches(t, user.ID, newPassword))
+	require.Equal(t, 1, e.metrics.Recorded["password_reset:requested"])
+	require.Equal(t, 1, e.metrics.Recorded["password_reset:completed"])
+
+	err = e.service.ResetPasswordWithLink(ctx, ResetPasswordWithLink{Token: token, Password: otherPassword, ConfirmPassword: otherPassword})
+	require.ErrorIs(t, err, mailvalidation.ErrLinkAlreadyUsed)
+}
+
+func TestService_ResetPasswordHistory(t *testing.T) {
+	ctx := context.Background()
+	e := newPasswordResetTest(t)
+	user := e.createUser(t, "walter@example.com")
+
+	resetWithCode := func(password string) error {
+		require.NoError(t, e.service.ForgotPassword(ctx, "walter@example.com"))
+		return e.service.UpdatePassword(ctx, UpdatePassword{Email: "walter@example.com", Code: e.mailbox.codes["walter@example.com"], Password: password, ConfirmPassword: password})
+	}
+	resetWithLink := func(password string) error {
+		require.NoError(t, e.service.ForgotPassword(ctx, "walter@example.com"))
+		return e.service.ResetPasswordWithLink(ctx, ResetPasswordWithLink{Token: e.mailbox.links["walter@example.com"], Password: password, ConfirmPassword: password})
+	}
+
+	require.NoError(t, resetWithCode(newPassword))
+	require.ErrorIs(t, resetWithLink(newPassword), password.ErrReused)
+
+	// a senha recusada não gasta o código, que ainda troca a senha por outra
+	code := e.mailbox.codes["walter@example.com"]
+	require.ErrorIs(t, e.service.UpdatePassword(ctx, UpdatePassword{Email: "walter@example.com", Code: code, Password: newPassword, ConfirmPassword: newPassword}), password.ErrReused)
+	require.NoError(t, e.service.UpdatePassword(ctx, UpdatePassword{Email: "walter@example.com", Code: code, Password: otherPassword, ConfirmPassword: otherPassword}))
+
+	// a senha anterior foi para o histórico pelas duas formas de redefinição
+	require.ErrorIs(t, resetWithLink(newPassword), password.ErrReused)
+	require.NoError(t, resetWithLink(thirdPassword))
+	require.ErrorIs(t, resetWithCode(otherPassword), password.ErrReused)
+
+	history, err := e.repo.GetPasswordHistory(ctx, user.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.True(t, e.passwordMatches(t, user.ID, thirdPassword))
+}
@@ -0,0 +1,45 @@
+package registration
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRule   = errors.New("invalid rule, use allow or deny")
+	ErrRuleNotFound  = errors.New("domain rule not found")
+	ErrInvalidDomain = errors.New("invalid domain")
+)
+
+type PolicyError struct {
+	Code    string
+	Message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+var (
+	ErrDisposableDomain = &PolicyError{Code: "disposable_email_domain", Message: "disposable email domains are not allowed"}
+	ErrBlockedDomain    = &PolicyError{Code: "blocked_email_domain", Message: "email domain is blocked"}
+	ErrDomainNotAllowed = &PolicyError{Code: "email_domain_not_allowed", Message: "email domain is not allowed"}
+)
+
+type Rule string
+
+const (
+	RuleAllow Rule = "allow"
+	RuleDeny  Rule = "deny"
+)
+
+type DomainRule struct {
+	Domain    string    `json:"domain"`
+	Rule      Rule      `json:"rule"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateDomainRule struct {
+	Domain string `json:"domain" validate:"required,fqdn" example:"example.com"`
+	Rule   Rule   `json:"rule" validate:"required,oneof=allow deny" example:"deny"`
+}
@@ -0,0 +1,91 @@
+package registration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &sqliteRepository{db: db}
+}
+
+func (r *sqliteRepository) CreateOrUpdate(ctx context.Context, rule DomainRule) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO email_domain_rules (domain, rule, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(domain) DO UPDATE SET
+			rule = excluded.rule,
+			created_at = excluded.created_at;
+	`, rule.Domain, rule.Rule, rule.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create or update domain rule: %w", err)
+	}
+	return nil
+}
+
+func (r *sqliteRepository) GetByDomains(ctx context.Context, domains []string) ([]DomainRule, error) {
+	if len(domains) == 0 {
+		return []DomainRule{}, nil
+	}
+
+	query := `SELECT domain, rule, created_at FROM email_domain_rules WHERE domain IN (?` + strings.Repeat(",?", len(domains)-1) + `)`
+	args := make([]any, len(domains))
+	for i, domain := range domains {
+		args[i] = domain
+	}
+
+	return r.query(ctx, query, args...)
+}
+
+func (r *sqliteRepository) GetAll(ctx context.Context) ([]DomainRule, error) {
+	return r.query(ctx, `SELECT domain, rule, created_at FROM email_domain_rules ORDER BY domain`)
+}
+
+func (r *sqliteRepository) Delete(ctx context.Context, domain string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM email_domain_rules WHERE domain = ?`, domain)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain rule: %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRuleNotFound
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) query(ctx context.Context, query string, args ...any) ([]DomainRule, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []DomainRule{}
+	for rows.Next() {
+		var rule DomainRule
+		if err := rows.Scan(&rule.Domain, &rule.Rule, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan domain rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return rules, nil
+}
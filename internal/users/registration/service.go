@@ -0,0 +1,142 @@
+package registration
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"golang.org/x/net/idna"
+)
+
+//go:embed disposable_domains.txt
+var embeddedDisposableDomains string
+
+type Repository interface {
+	CreateOrUpdate(ctx context.Context, rule DomainRule) error
+	GetByDomains(ctx context.Context, domains []string) ([]DomainRule, error)
+	GetAll(ctx context.Context) ([]DomainRule, error)
+	Delete(ctx context.Context, domain string) error
+}
+
+type Service struct {
+	repo              Repository
+	allowlistOnly     bool
+	disposableDomains map[string]struct{}
+}
+
+func NewService(repo Repository, settings settings.RegistrationPolicy) (*Service, error) {
+	disposableDomains := map[string]struct{}{}
+	if err := readDomains(strings.NewReader(embeddedDisposableDomains), disposableDomains); err != nil {
+		return nil, err
+	}
+
+	if settings.DisposableDomainsFile != "" {
+		file, err := os.Open(settings.DisposableDomainsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open disposable domains file: %w", err)
+		}
+		defer file.Close()
+
+		if err := readDomains(file, disposableDomains); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Service{repo: repo, allowlistOnly: settings.AllowlistOnly, disposableDomains: disposableDomains}, nil
+}
+
+func (s *Service) CheckEmail(ctx context.Context, email string) error {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ErrDomainNotAllowed
+	}
+
+	domains := parentDomains(strings.ToLower(email[at+1:]))
+
+	rules, err := s.repo.GetByDomains(ctx, domains)
+	if err != nil {
+		return err
+	}
+
+	allowed := false
+	for _, rule := range rules {
+		if rule.Rule == RuleDeny {
+			return ErrBlockedDomain
+		}
+		allowed = true
+	}
+
+	if allowed {
+		return nil
+	}
+
+	if s.allowlistOnly {
+		return ErrDomainNotAllowed
+	}
+
+	for _, domain := range domains {
+		if _, found := s.disposableDomains[domain]; found {
+			return ErrDisposableDomain
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) List(ctx context.Context) ([]DomainRule, error) {
+	return s.repo.GetAll(ctx)
+}
+
+func (s *Service) Create(ctx context.Context, request CreateDomainRule) (DomainRule, error) {
+	if request.Rule != RuleAllow && request.Rule != RuleDeny {
+		return DomainRule{}, ErrInvalidRule
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.ToLower(strings.TrimSpace(request.Domain)))
+	if err != nil {
+		return DomainRule{}, fmt.Errorf("%w: %v", ErrInvalidDomain, err)
+	}
+
+	rule := DomainRule{Domain: domain, Rule: request.Rule, CreatedAt: time.Now()}
+	if err := s.repo.CreateOrUpdate(ctx, rule); err != nil {
+		return DomainRule{}, err
+	}
+
+	return rule, nil
+}
+
+func (s *Service) Delete(ctx context.Context, domain string) error {
+	return s.repo.Delete(ctx, strings.ToLower(domain))
+}
+
+func parentDomains(domain string) []string {
+	labels := strings.Split(domain, ".")
+	domains := make([]string, 0, len(labels))
+	for i := 0; i < len(labels)-1; i++ {
+		domains = append(domains, strings.Join(labels[i:], "."))
+	}
+	return domains
+}
+
+func readDomains(reader io.Reader, domains map[string]struct{}) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read disposable domains: %w", err)
+	}
+
+	return nil
+}
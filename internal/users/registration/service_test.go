@@ -0,0 +1,99 @@
+package registration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/juliovcruz/user-register/internal/settings"
+	"github.com/stretchr/testify/require"
+)
+
+type repositoryMock struct {
+	rules map[string]Rule
+}
+
+func (r *repositoryMock) CreateOrUpdate(ctx context.Context, rule DomainRule) error {
+	return nil
+}
+
+func (r *repositoryMock) GetByDomains(ctx context.Context, domains []string) ([]DomainRule, error) {
+	var rules []DomainRule
+	for _, domain := range domains {
+		if rule, found := r.rules[domain]; found {
+			rules = append(rules, DomainRule{Domain: domain, Rule: rule})
+		}
+	}
+	return rules, nil
+}
+
+func (r *repositoryMock) GetAll(ctx context.Context) ([]DomainRule, error) {
+	return nil, nil
+}
+
+func (r *repositoryMock) Delete(ctx context.Context, domain string) error {
+	return nil
+}
+
+func TestService_CheckEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		email         string
+		rules         map[string]Rule
+		settings      settings.RegistrationPolicy
+		expectedError error
+	}{
+		{
+			name:  "Regular domain",
+			email: "user@example.com",
+		},
+		{
+			name:          "Disposable domain",
+			email:         "user@mailinator.com",
+			expectedError: ErrDisposableDomain,
+		},
+		{
+			name:          "Disposable subdomain",
+			email:         "user@inbox.yopmail.com",
+			expectedError: ErrDisposableDomain,
+		},
+		{
+			name:  "Disposable domain in allow list",
+			email: "user@mailinator.com",
+			rules: map[string]Rule{"mailinator.com": RuleAllow},
+		},
+		{
+			name:          "Denied parent domain",
+			email:         "user@mail.example.com",
+			rules:         map[string]Rule{"example.com": RuleDeny},
+			expectedError: ErrBlockedDomain,
+		},
+		{
+			name:          "Allowlist only with unknown domain",
+			email:         "user@example.com",
+			settings:      settings.RegistrationPolicy{AllowlistOnly: true},
+			expectedError: ErrDomainNotAllowed,
+		},
+		{
+			name:     "Allowlist only with allowed domain",
+			email:    "user@company.com",
+			rules:    map[string]Rule{"company.com": RuleAllow},
+			settings: settings.RegistrationPolicy{AllowlistOnly: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, err := NewService(&repositoryMock{rules: tt.rules}, tt.settings)
+			require.NoError(t, err)
+
+			err = service.CheckEmail(context.Background(), tt.email)
+
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
@@ -6,11 +6,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const userColumns = `id, name, email, email_canonical, email_verified, role, password, address, sessions_revoked_at`
+
 type sqliteRepository struct {
 	db *sql.DB
 }
@@ -19,20 +22,44 @@ func NewSQLiteRepository(db *sql.DB) (*sqliteRepository, error) {
 	return &sqliteRepository{db: db}, nil
 }
 
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	var addressJSON []byte
+	var sessionsRevokedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.EmailCanonical, &user.EmailVerified, &user.Role, &user.Password, &addressJSON, &sessionsRevokedAt)
+	if err != nil {
+		return user, err
+	}
+
+	if err := json.Unmarshal(addressJSON, &user.Address); err != nil {
+		return user, fmt.Errorf("failed to unmarshal address: %v", err)
+	}
+
+	user.SessionsRevokedAt = sessionsRevokedAt.Time
+
+	return user, nil
+}
+
+func isUniqueConstraintError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
 func (r *sqliteRepository) Create(ctx context.Context, user User) (User, error) {
 	addressJSON, err := json.Marshal(user.Address)
 	if err != nil {
 		return User{}, fmt.Errorf("failed to marshal address to JSON: %v", err)
 	}
 
-	query := `INSERT INTO users (name, email, password, address) VALUES (?, ?, ?, ?)`
-	result, err := r.db.ExecContext(ctx, query, user.Name, user.Email, user.Password, addressJSON)
+	query := `INSERT INTO users (name, email, email_canonical, password, address) VALUES (?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, user.Name, user.Email, user.EmailCanonical, user.Password, addressJSON)
 	if err != nil {
-		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr) {
-			if sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-				return User{}, ErrMailAlreadyExists
-			}
+		if isUniqueConstraintError(err) {
+			return User{}, ErrMailAlreadyExists
 		}
 		return user, fmt.Errorf("failed to create user: %v", err)
 	}
@@ -43,11 +70,12 @@ func (r *sqliteRepository) Create(ctx context.Context, user User) (User, error)
 	}
 
 	user.ID = id
+	user.Role = RoleUser
 	return user, nil
 }
 
 func (r *sqliteRepository) Update(ctx context.Context, email, password string) error {
-	query := `UPDATE users SET password = ? WHERE email = ?`
+	query := `UPDATE users SET password = ? WHERE email_canonical = ?`
 	res, err := r.db.ExecContext(ctx, query, password, email)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %v", err)
@@ -65,28 +93,168 @@ func (r *sqliteRepository) Update(ctx context.Context, email, password string) e
 	return nil
 }
 
-func (r *sqliteRepository) GetByEMail(ctx context.Context, email string) (User, error) {
-	query := `SELECT id, name, email, password, address FROM users WHERE email = ?`
-	row := r.db.QueryRowContext(ctx, query, email)
+func (r *sqliteRepository) SetEmailVerified(ctx context.Context, email string) error {
+	query := `UPDATE users SET email_verified = TRUE WHERE email_canonical = ?`
+	res, err := r.db.ExecContext(ctx, query, email)
+	if err != nil {
+		return fmt.Errorf("failed to verify user email: %v", err)
+	}
 
-	var user User
-	var addressJSON []byte
-	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &addressJSON)
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) SetRole(ctx context.Context, email string, role Role) error {
+	query := `UPDATE users SET role = ? WHERE email_canonical = ?`
+	res, err := r.db.ExecContext(ctx, query, role, email)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %v", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// ForcePasswordReset descarta o hash atual, impedindo o login por senha até que o
+// usuário defina uma nova, e revoga as sessões existentes
+func (r *sqliteRepository) ForcePasswordReset(ctx context.Context, userID int64, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET password = '', sessions_revoked_at = ? WHERE id = ?`
+	res, err := tx.ExecContext(ctx, query, at.Truncate(time.Second), userID)
+	if err != nil {
+		return fmt.Errorf("failed to force password reset: %v", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := revokeSessions(ctx, tx, userID, at); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ChangePassword guarda o hash atual no histórico, mantendo apenas os historySize mais
+// recentes, troca a senha e revoga as sessões existentes na mesma transação
+func (r *sqliteRepository) ChangePassword(ctx context.Context, userID int64, password string, historySize int, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO password_history (user_id, password, created_at)
+		SELECT id, password, ? FROM users WHERE id = ? AND password != ''
+	`, at, userID)
+	if err != nil {
+		return fmt.Errorf("failed to record password history: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM password_history WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?
+		)
+	`, userID, userID, historySize)
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %v", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET password = ?, sessions_revoked_at = ? WHERE id = ?`, password, at.Truncate(time.Second), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := revokeSessions(ctx, tx, userID, at); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) GetPasswordHistory(ctx context.Context, userID int64, limit int) ([]string, error) {
+	query := `SELECT password FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %v", err)
+	}
+	defer rows.Close()
+
+	var history []string
+	for rows.Next() {
+		var password string
+		if err := rows.Scan(&password); err != nil {
+			return nil, fmt.Errorf("failed to scan password history: %v", err)
+		}
+		history = append(history, password)
+	}
+
+	return history, rows.Err()
+}
+
+func (r *sqliteRepository) GetByEMail(ctx context.Context, email string) (User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email_canonical = ?`
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, email))
 	if errors.Is(err, sql.ErrNoRows) {
 		return user, ErrNotFound
 	} else if err != nil {
 		return user, fmt.Errorf("failed to retrieve user by email: %v", err)
 	}
 
-	if err := json.Unmarshal(addressJSON, &user.Address); err != nil {
-		return user, fmt.Errorf("failed to unmarshal address: %v", err)
+	return user, nil
+}
+
+func (r *sqliteRepository) GetByID(ctx context.Context, id int64) (User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	} else if err != nil {
+		return user, fmt.Errorf("failed to retrieve user by id: %v", err)
 	}
 
 	return user, nil
 }
 
 func (r *sqliteRepository) GetAll(ctx context.Context, limit, offset int) ([]User, error) {
-	query := `SELECT id, name, email, password, address FROM users LIMIT ? OFFSET ?`
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY id LIMIT ? OFFSET ?`
 	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %v", err)
@@ -95,17 +263,11 @@ func (r *sqliteRepository) GetAll(ctx context.Context, limit, offset int) ([]Use
 
 	var usersList []User
 	for rows.Next() {
-		var user User
-		var addressJSON []byte
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &addressJSON)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %v", err)
 		}
 
-		if err := json.Unmarshal(addressJSON, &user.Address); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal address: %v", err)
-		}
-
 		usersList = append(usersList, user)
 	}
 
@@ -120,6 +282,217 @@ func (r *sqliteRepository) GetAll(ctx context.Context, limit, offset int) ([]Use
 	return usersList, nil
 }
 
+func (r *sqliteRepository) CreateEmailChange(ctx context.Context, change EmailChange) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM email_changes WHERE user_id = ? AND confirmed_at IS NULL`, change.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to delete pending email change: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO email_changes (user_id, old_email, new_email, created_at) VALUES (?, ?, ?, ?)
+	`, change.UserID, change.OldEmail, change.NewEmail, change.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create email change: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) GetPendingEmailChange(ctx context.Context, userID int64) (EmailChange, error) {
+	query := `
+		SELECT id, user_id, old_email, new_email, created_at FROM email_changes
+		WHERE user_id = ? AND confirmed_at IS NULL
+	`
+	var change EmailChange
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&change.ID, &change.UserID, &change.OldEmail, &change.NewEmail, &change.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return change, ErrEmailChangeNotFound
+	} else if err != nil {
+		return change, fmt.Errorf("failed to retrieve email change: %v", err)
+	}
+
+	return change, nil
+}
+
+func (r *sqliteRepository) GetConfirmedEmailChange(ctx context.Context, id int64) (EmailChange, error) {
+	query := `
+		SELECT id, user_id, old_email, new_email, created_at, confirmed_at FROM email_changes
+		WHERE id = ? AND confirmed_at IS NOT NULL AND undone_at IS NULL
+	`
+	var change EmailChange
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&change.ID, &change.UserID, &change.OldEmail, &change.NewEmail, &change.CreatedAt, &change.ConfirmedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return change, ErrEmailChangeNotFound
+	} else if err != nil {
+		return change, fmt.Errorf("failed to retrieve email change: %v", err)
+	}
+
+	return change, nil
+}
+
+// ConfirmEmailChange troca o e-mail e revoga as sessões do usuário na mesma transação;
+// canonical é a chave normalizada do novo e-mail
+func (r *sqliteRepository) ConfirmEmailChange(ctx context.Context, change EmailChange, canonical string, confirmedAt time.Time) error {
+	return r.swapEmail(ctx, change.UserID, change.OldEmail, change.NewEmail, canonical, confirmedAt, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE email_changes SET confirmed_at = ? WHERE id = ?`, confirmedAt, change.ID)
+		return err
+	})
+}
+
+func (r *sqliteRepository) UndoEmailChange(ctx context.Context, change EmailChange, canonical string, undoneAt time.Time) error {
+	return r.swapEmail(ctx, change.UserID, change.NewEmail, change.OldEmail, canonical, undoneAt, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE email_changes SET undone_at = ? WHERE id = ?`, undoneAt, change.ID)
+		return err
+	})
+}
+
+func (r *sqliteRepository) swapEmail(ctx context.Context, userID int64, from, to, canonical string, at time.Time, record func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users SET email = ?, email_canonical = ?, email_verified = TRUE, sessions_revoked_at = ?
+		WHERE id = ? AND email = ? COLLATE NOCASE
+	`, to, canonical, at.Truncate(time.Second), userID, from)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return ErrMailAlreadyExists
+		}
+		return fmt.Errorf("failed to update user email: %v", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrEmailChangeNotFound
+	}
+
+	if err := record(tx); err != nil {
+		return fmt.Errorf("failed to record email change: %v", err)
+	}
+
+	if err := revokeSessions(ctx, tx, userID, at); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const sessionColumns = `id, user_id, ip, user_agent, created_at, last_used_at, expires_at, revoked_at`
+
+func scanSession(row rowScanner) (Session, error) {
+	var session Session
+	err := row.Scan(&session.ID, &session.UserID, &session.IP, &session.UserAgent,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt)
+	return session, err
+}
+
+func (r *sqliteRepository) CreateSession(ctx context.Context, session Session) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, ip, user_agent, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, session.ID, session.UserID, session.IP, session.UserAgent, session.CreatedAt, session.LastUsedAt, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %v", err)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) GetSession(ctx context.Context, id string) (Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?`
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return session, ErrSessionNotFound
+	} else if err != nil {
+		return session, fmt.Errorf("failed to retrieve session: %v", err)
+	}
+
+	return session, nil
+}
+
+func (r *sqliteRepository) TouchSession(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE sessions SET last_used_at = ? WHERE id = ?`, usedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %v", err)
+	}
+
+	return nil
+}
+
+// ListSessions retorna as sessões do usuário que não foram revogadas nem expiraram
+func (r *sqliteRepository) ListSessions(ctx context.Context, userID int64, now time.Time) ([]Session, error) {
+	query := `
+		SELECT ` + sessionColumns + ` FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_used_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %v", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (r *sqliteRepository) RevokeSession(ctx context.Context, userID int64, id string, at time.Time) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`
+	res, err := r.db.ExecContext(ctx, query, at, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) RevokeSessions(ctx context.Context, userID int64, at time.Time) error {
+	return revokeSessions(ctx, r.db, userID, at)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func revokeSessions(ctx context.Context, db execer, userID int64, at time.Time) error {
+	_, err := db.ExecContext(ctx, `UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, at, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+
+	return nil
+}
+
 func (r *sqliteRepository) Close() error {
 	return r.db.Close()
 }
@@ -2,119 +2,326 @@ package users
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/juliovcruz/user-register/internal/mailvalidation"
+	"github.com/juliovcruz/user-register/internal/platform/tracing"
+	"github.com/juliovcruz/user-register/internal/security/hash"
+	"github.com/juliovcruz/user-register/internal/users/mfa"
+	"github.com/juliovcruz/user-register/internal/users/password"
 )
 
 type repository interface {
 	Create(ctx context.Context, user User) (User, error)
 	Update(ctx context.Context, email, password string) error
+	SetEmailVerified(ctx context.Context, email string) error
+	SetRole(ctx context.Context, email string, role Role) error
+	ForcePasswordReset(ctx context.Context, userID int64, at time.Time) error
+	ChangePassword(ctx context.Context, userID int64, password string, historySize int, at time.Time) error
+	GetPasswordHistory(ctx context.Context, userID int64, limit int) ([]string, error)
+	CreateSession(ctx context.Context, session Session) error
+	GetSession(ctx context.Context, id string) (Session, error)
+	TouchSession(ctx context.Context, id string, usedAt time.Time) error
+	ListSessions(ctx context.Context, userID int64, now time.Time) ([]Session, error)
+	RevokeSession(ctx context.Context, userID int64, id string, at time.Time) error
+	RevokeSessions(ctx context.Context, userID int64, at time.Time) error
 	GetByEMail(ctx context.Context, email string) (User, error)
+	GetByID(ctx context.Context, id int64) (User, error)
 	GetAll(ctx context.Context, limit, offset int) ([]User, error)
+	CreateEmailChange(ctx context.Context, change EmailChange) error
+	GetPendingEmailChange(ctx context.Context, userID int64) (EmailChange, error)
+	GetConfirmedEmailChange(ctx context.Context, id int64) (EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, change EmailChange, canonical string, confirmedAt time.Time) error
+	UndoEmailChange(ctx context.Context, change EmailChange, canonical string, undoneAt time.Time) error
 }
 
 type tokenService interface {
-	Create(user User) (string, error)
+	Create(user User, sessionID string) (string, error)
+	TTL() time.Duration
 	IsValid(tokenStr string) (bool, error)
+	Parse(tokenStr string) (TokenClaims, error)
+	CreateMFAChallenge(user User) (string, error)
+	ParseMFAChallenge(tokenStr string) (int64, error)
 }
 
 type mailValidationService interface {
 	Create(ctx context.Context, email string) error
+	Check(ctx context.Context, email string, code int) error
 	Validate(ctx context.Context, email string, code int) error
+	CreateLink(ctx context.Context, email string, purpose mailvalidation.Purpose) error
+	InspectLink(token string) (mailvalidation.LinkToken, error)
+	ValidateLink(ctx context.Context, token string, purpose mailvalidation.Purpose) (string, error)
+	CreateReferencedLink(ctx context.Context, email string, purpose mailvalidation.Purpose, reference string) error
+	ValidateReferencedLink(ctx context.Context, token string, purpose mailvalidation.Purpose) (string, string, error)
+	Notify(ctx context.Context, email string, notification mailvalidation.Notification) error
 }
 
 type hashService interface {
-	Create(password string) (string, error)
-	IsValid(inputPassword, password string) bool
+	Create(ctx context.Context, password string) (string, error)
+	Verify(ctx context.Context, inputPassword, password string) hash.Result
+	SecretOf(password string) hash.Secret
+}
+
+type emailNormalizer interface {
+	Clean(email string) (string, error)
+	Normalize(email string) (string, error)
+}
+
+type passwordPolicy interface {
+	Check(password, name, email string) error
+	HistorySize() int
+}
+
+type registrationPolicy interface {
+	CheckEmail(ctx context.Context, email string) error
+}
+
+type loginLimiter interface {
+	Check(ctx context.Context, email, ip string) error
+	RegisterFailure(ctx context.Context, email, ip string) error
+	RegisterSuccess(ctx context.Context, email string) error
+	Unlock(ctx context.Context, email string) error
+}
+
+type mfaService interface {
+	IsEnabled(ctx context.Context, userID int64) (bool, error)
+	Verify(ctx context.Context, userID int64, code string) error
 }
 
 type zipCodeService interface {
-	GetAddressByZipCode(zipCode string) (Address, error)
+	GetAddressByZipCode(ctx context.Context, zipCode string) (Address, error)
+}
+
+type metricsRecorder interface {
+	Registration()
+	Login(result string)
+	PasswordReset(stage string)
 }
 
+// resultados de login e etapas da redefinição de senha informados ao metricsRecorder
+const (
+	loginSuccess     = "success"
+	loginFailure     = "failure"
+	loginMFARequired = "mfa_required"
+
+	passwordResetRequested = "requested"
+	passwordResetCompleted = "completed"
+)
+
 type Service struct {
 	repo                  repository
 	tokenService          tokenService
 	hashService           hashService
 	zipCodeService        zipCodeService
 	mailValidationService mailValidationService
+	emailNormalizer       emailNormalizer
+	registrationPolicy    registrationPolicy
+	passwordPolicy        passwordPolicy
+	loginLimiter          loginLimiter
+	mfaService            mfaService
+	metrics               metricsRecorder
+	logger                *slog.Logger
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
 func NewService(
 	repo repository, tokenService tokenService,
 	zipCodeService zipCodeService, hashService hashService,
-	mailValidationService mailValidationService,
+	mailValidationService mailValidationService, emailNormalizer emailNormalizer,
+	registrationPolicy registrationPolicy, passwordPolicy passwordPolicy, loginLimiter loginLimiter,
+	mfaService mfaService, metrics metricsRecorder, logger *slog.Logger,
 ) *Service {
 	return &Service{
 		repo: repo, tokenService: tokenService,
 		zipCodeService: zipCodeService, hashService: hashService,
-		mailValidationService: mailValidationService,
+		mailValidationService: mailValidationService, emailNormalizer: emailNormalizer,
+		registrationPolicy: registrationPolicy, passwordPolicy: passwordPolicy, loginLimiter: loginLimiter,
+		mfaService: mfaService, metrics: metrics, logger: logger,
 	}
 }
 
-func (s *Service) Create(ctx context.Context, request CreateUser) (User, error) {
+func (s *Service) Create(ctx context.Context, request CreateUser) (_ User, err error) {
+	ctx, span := tracing.Start(ctx, "users.Service.Create")
+	defer func() { tracing.End(span, err) }()
+
 	if request.Password != request.ConfirmPassword {
 		return User{}, ErrPasswordMismatch
 	}
 
-	address, err := s.zipCodeService.GetAddressByZipCode(request.ZipCode)
+	original, err := s.emailNormalizer.Clean(request.Email)
+	if err != nil {
+		return User{}, err
+	}
+
+	email, err := s.emailNormalizer.Normalize(request.Email)
+	if err != nil {
+		return User{}, err
+	}
+
+	if err := s.registrationPolicy.CheckEmail(ctx, email); err != nil {
+		return User{}, err
+	}
+
+	if err := s.passwordPolicy.Check(request.Password, request.Name, email); err != nil {
+		return User{}, err
+	}
+
+	address, err := s.zipCodeService.GetAddressByZipCode(ctx, request.ZipCode)
 	if err != nil {
 		return User{}, fmt.Errorf("failed to fetch address: %w", err)
 	}
 
-	hashPassword, err := s.hashService.Create(request.Password)
+	hashPassword, err := s.hashService.Create(ctx, request.Password)
 	if err != nil {
 		return User{}, fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	user, err := s.repo.Create(ctx, User{
-		Email:    request.Email,
-		Name:     request.Name,
-		Address:  address,
-		Password: hashPassword,
+		Email:          original,
+		EmailCanonical: email,
+		Name:           request.Name,
+		Address:        address,
+		Password:       hashPassword,
 	})
 	if err != nil {
 		return User{}, fmt.Errorf("failed to create user: %w", err)
 	}
+	s.metrics.Registration()
 
 	user.Password = ""
 
 	return user, nil
 }
 
-func (s *Service) UpdatePassword(ctx context.Context, request UpdatePassword) error {
+func (s *Service) UpdatePassword(ctx context.Context, request UpdatePassword) (err error) {
+	ctx, span := tracing.Start(ctx, "users.Service.UpdatePassword")
+	defer func() { tracing.End(span, err) }()
+
 	if request.Password != request.ConfirmPassword {
 		return ErrPasswordMismatch
 	}
 
-	err := s.mailValidationService.Validate(ctx, request.Email, request.Code)
+	email, err := s.emailNormalizer.Normalize(request.Email)
 	if err != nil {
 		return err
 	}
 
-	password, err := s.hashService.Create(request.Password)
+	// o código é conferido antes de qualquer busca pelo usuário
+	if err := s.mailValidationService.Check(ctx, email, request.Code); err != nil {
+		return resetCodeError(err)
+	}
+
+	user, err := s.checkPassword(ctx, request.Password, email)
 	if err != nil {
 		return err
 	}
 
-	err = s.repo.Update(ctx, request.Email, password)
-	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+	if err := s.mailValidationService.Validate(ctx, email, request.Code); err != nil {
+		return resetCodeError(err)
 	}
 
+	if err := s.resetPassword(ctx, user, request.Password); err != nil {
+		return resetCodeError(err)
+	}
+	s.metrics.PasswordReset(passwordResetCompleted)
+
 	return nil
 }
 
-func (s *Service) Login(ctx context.Context, email, password string) (string, error) {
-	user, err := s.repo.GetByEMail(ctx, email)
+// resetCodeError responde igual para código ausente, errado, expirado ou de conta
+// inexistente, para que a redefinição não revele quais e-mails têm conta
+func resetCodeError(err error) error {
+	if errors.Is(err, mailvalidation.ErrRecordNotFound) || errors.Is(err, mailvalidation.ErrCodeExpired) || errors.Is(err, ErrUserNotFound) {
+		return mailvalidation.ErrInvalidCode
+	}
+	return err
+}
+
+// ChangePassword troca a senha do usuário autenticado, revoga as demais sessões e
+// retorna um novo token para a sessão atual
+func (s *Service) ChangePassword(ctx context.Context, current User, request ChangePassword, client ClientInfo) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "users.Service.ChangePassword")
+	defer func() { tracing.End(span, err) }()
+
+	if request.Password != request.ConfirmPassword {
+		return "", ErrPasswordMismatch
+	}
+
+	user, err := s.repo.GetByID(ctx, current.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	email, err := s.emailNormalizer.Normalize(user.Email)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.loginLimiter.Check(ctx, email, client.IP); err != nil {
+		return "", err
+	}
+
+	if !s.hashService.Verify(ctx, request.CurrentPassword, user.Password).Valid {
+		if err := s.loginLimiter.RegisterFailure(ctx, email, client.IP); err != nil {
+			return "", err
+		}
+		return "", ErrInvalidPassword
+	}
+
+	if err := s.passwordPolicy.Check(request.Password, user.Name, user.Email); err != nil {
+		return "", err
+	}
+
+	if err := s.checkPasswordHistory(ctx, user, request.Password); err != nil {
+		return "", err
+	}
+
+	if err := s.resetPassword(ctx, user, request.Password); err != nil {
+		return "", err
+	}
+
+	// a senha já foi trocada, uma falha no envio da notificação não deve ser reportada como erro da troca
+	if err := s.mailValidationService.Notify(ctx, user.Email, mailvalidation.NotificationPasswordChanged); err != nil {
+		s.logger.WarnContext(ctx, "failed to notify password change", "user_id", user.ID, "error", err)
+	}
+
+	return s.startSession(ctx, user, client)
+}
+
+// sessionTouchInterval evita uma escrita no banco a cada requisição autenticada
+const sessionTouchInterval = time.Minute
+
+// startSession registra uma nova sessão para o usuário e emite o token vinculado a ela
+func (s *Service) startSession(ctx context.Context, user User, client ClientInfo) (string, error) {
+	id, err := newSessionID()
 	if err != nil {
-		return "", ErrUserNotFound
+		return "", err
 	}
 
-	if !s.hashService.IsValid(password, user.Password) {
-		return "", ErrInvalidLogin
+	now := time.Now()
+	session := Session{
+		ID:         id,
+		UserID:     user.ID,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(s.tokenService.TTL()),
+	}
+	if err := s.repo.CreateSession(ctx, session); err != nil {
+		return "", err
 	}
 
-	token, err := s.tokenService.Create(user)
+	token, err := s.tokenService.Create(user, session.ID)
 	if err != nil {
 		return "", fmt.Errorf("failed to create token: %w", err)
 	}
@@ -122,6 +329,243 @@ func (s *Service) Login(ctx context.Context, email, password string) (string, er
 	return token, nil
 }
 
+func newSessionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// ListSessions lista as sessões ativas do usuário, marcando a sessão currentSessionID como atual
+func (s *Service) ListSessions(ctx context.Context, userID int64, currentSessionID string) ([]Session, error) {
+	if _, err := s.repo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.repo.ListSessions(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+func (s *Service) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	return s.repo.RevokeSession(ctx, userID, sessionID, time.Now())
+}
+
+func (s *Service) RevokeSessions(ctx context.Context, userID int64) error {
+	if _, err := s.repo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.repo.RevokeSessions(ctx, userID, time.Now())
+}
+
+// checkPassword aplica a política de senha usando o nome do usuário e, quando ele existe,
+// o histórico de senhas; retorna o usuário encontrado
+func (s *Service) checkPassword(ctx context.Context, password, email string) (User, error) {
+	user, err := s.repo.GetByEMail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return User{}, s.passwordPolicy.Check(password, "", email)
+	} else if err != nil {
+		return User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := s.passwordPolicy.Check(password, user.Name, email); err != nil {
+		return User{}, err
+	}
+
+	return user, s.checkPasswordHistory(ctx, user, password)
+}
+
+// checkPasswordHistory recusa a senha atual do usuário e as anteriores guardadas no histórico
+func (s *Service) checkPasswordHistory(ctx context.Context, user User, newPassword string) error {
+	historySize := s.passwordPolicy.HistorySize()
+	if historySize <= 0 {
+		return nil
+	}
+
+	history, err := s.repo.GetPasswordHistory(ctx, user.ID, historySize-1)
+	if err != nil {
+		return err
+	}
+
+	for _, hashed := range append([]string{user.Password}, history...) {
+		if hashed != "" && s.hashService.Verify(ctx, newPassword, hashed).Valid {
+			return password.ErrReused
+		}
+	}
+
+	return nil
+}
+
+// resetPassword grava a nova senha, guarda a anterior no histórico e revoga as sessões
+func (s *Service) resetPassword(ctx context.Context, user User, newPassword string) error {
+	if user.ID == 0 {
+		return ErrUserNotFound
+	}
+
+	hashedPassword, err := s.hashService.Create(ctx, newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	historySize := max(s.passwordPolicy.HistorySize()-1, 0)
+	return s.repo.ChangePassword(ctx, user.ID, hashedPassword, historySize, time.Now())
+}
+
+func (s *Service) Login(ctx context.Context, email, password string, client ClientInfo) (_ LoginResult, err error) {
+	ctx, span := tracing.Start(ctx, "users.Service.Login")
+	defer func() { tracing.End(span, err) }()
+
+	email, err = s.emailNormalizer.Normalize(email)
+	if err != nil {
+		s.compareDummyHash(ctx, password)
+		return LoginResult{}, ErrInvalidLogin
+	}
+
+	if err := s.loginLimiter.Check(ctx, email, client.IP); err != nil {
+		return LoginResult{}, err
+	}
+
+	user, err := s.repo.GetByEMail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return LoginResult{}, fmt.Errorf("failed to get user: %w", err)
+		}
+
+		s.compareDummyHash(ctx, password)
+		s.metrics.Login(loginFailure)
+		if err := s.loginLimiter.RegisterFailure(ctx, email, client.IP); err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{}, ErrInvalidLogin
+	}
+
+	result := s.hashService.Verify(ctx, password, user.Password)
+	if !result.Valid {
+		s.metrics.Login(loginFailure)
+		if err := s.loginLimiter.RegisterFailure(ctx, email, client.IP); err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{}, ErrInvalidLogin
+	}
+
+	if result.NeedsRehash {
+		// a atualização do hash é oportunista, uma falha aqui não deve impedir o login
+		if err := s.rehash(ctx, user, password); err != nil {
+			s.logger.WarnContext(ctx, "failed to rehash password", "user_id", user.ID, "error", err)
+		}
+	}
+
+	return s.completeLogin(ctx, user, email, client)
+}
+
+func (s *Service) rehash(ctx context.Context, user User, password string) error {
+	hashedPassword, err := s.hashService.Create(ctx, password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := s.repo.Update(ctx, user.EmailCanonical, hashedPassword); err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Service) completeLogin(ctx context.Context, user User, email string, client ClientInfo) (LoginResult, error) {
+	mfaEnabled, err := s.mfaService.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if mfaEnabled {
+		challenge, err := s.tokenService.CreateMFAChallenge(user)
+		if err != nil {
+			return LoginResult{}, fmt.Errorf("failed to create mfa challenge: %w", err)
+		}
+		s.metrics.Login(loginMFARequired)
+		return LoginResult{MFARequired: true, MFAToken: challenge}, nil
+	}
+
+	if err := s.loginLimiter.RegisterSuccess(ctx, email); err != nil {
+		return LoginResult{}, err
+	}
+
+	token, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	s.metrics.Login(loginSuccess)
+
+	return LoginResult{Token: token}, nil
+}
+
+func (s *Service) LoginMFA(ctx context.Context, request LoginMFA, client ClientInfo) (_ LoginResult, err error) {
+	ctx, span := tracing.Start(ctx, "users.Service.LoginMFA")
+	defer func() { tracing.End(span, err) }()
+
+	userID, err := s.tokenService.ParseMFAChallenge(request.MFAToken)
+	if err != nil {
+		return LoginResult{}, ErrInvalidMFAChallenge
+	}
+
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return LoginResult{}, ErrInvalidMFAChallenge
+	}
+
+	email, err := s.emailNormalizer.Normalize(user.Email)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if err := s.loginLimiter.Check(ctx, email, client.IP); err != nil {
+		return LoginResult{}, err
+	}
+
+	if err := s.mfaService.Verify(ctx, user.ID, request.Code); err != nil {
+		if !errors.Is(err, mfa.ErrInvalidCode) {
+			return LoginResult{}, err
+		}
+
+		s.metrics.Login(loginFailure)
+		if err := s.loginLimiter.RegisterFailure(ctx, email, client.IP); err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{}, ErrInvalidMFACode
+	}
+
+	if err := s.loginLimiter.RegisterSuccess(ctx, email); err != nil {
+		return LoginResult{}, err
+	}
+
+	token, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	s.metrics.Login(loginSuccess)
+
+	return LoginResult{Token: token}, nil
+}
+
+// compareDummyHash gasta o mesmo tempo de uma verificação de senha real para que
+// e-mails inexistentes não sejam distinguíveis pelo tempo de resposta do login
+func (s *Service) compareDummyHash(ctx context.Context, password string) {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = s.hashService.Create(ctx, "dummy-password-for-timing")
+	})
+
+	s.hashService.Verify(ctx, password, s.dummyHash)
+}
+
 func (s *Service) List(ctx context.Context, limit, offset int) ([]User, error) {
 	users, err := s.repo.GetAll(ctx, limit, offset)
 	if err != nil {
@@ -131,15 +575,440 @@ func (s *Service) List(ctx context.Context, limit, offset int) ([]User, error) {
 	return users, nil
 }
 
+func (s *Service) Get(ctx context.Context, id int64) (User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
 func (s *Service) ForgotPassword(ctx context.Context, email string) error {
-	_, err := s.repo.GetByEMail(ctx, email)
+	email, err := s.emailNormalizer.Normalize(email)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.GetByEMail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.mailValidationService.Create(ctx, email)
+	if errors.Is(err, mailvalidation.ErrCodeAlreadySent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.mailValidationService.CreateLink(ctx, email, mailvalidation.PurposePasswordReset); err != nil {
+		return err
+	}
+	s.metrics.PasswordReset(passwordResetRequested)
+
+	return nil
+}
+
+func (s *Service) ResetPasswordWithLink(ctx context.Context, request ResetPasswordWithLink) (err error) {
+	ctx, span := tracing.Start(ctx, "users.Service.ResetPasswordWithLink")
+	defer func() { tracing.End(span, err) }()
+
+	if request.Password != request.ConfirmPassword {
+		return ErrPasswordMismatch
+	}
+
+	// o link só é consumido depois que a senha passa por todas as regras
+	link, err := s.mailValidationService.InspectLink(request.Token)
+	if err != nil {
+		return err
+	}
+	if link.Purpose != mailvalidation.PurposePasswordReset {
+		return mailvalidation.ErrInvalidLink
+	}
+
+	user, err := s.checkPassword(ctx, request.Password, link.Email)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.mailValidationService.ValidateLink(ctx, request.Token, mailvalidation.PurposePasswordReset); err != nil {
+		return err
+	}
+
+	if err := s.resetPassword(ctx, user, request.Password); err != nil {
+		return err
+	}
+	s.metrics.PasswordReset(passwordResetCompleted)
+
+	return nil
+}
+
+func (s *Service) RequestEmailVerification(ctx context.Context, email string) error {
+	email, err := s.emailNormalizer.Normalize(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetByEMail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	if err := s.mailValidationService.Create(ctx, email); err != nil {
+	if user.EmailVerified {
+		return nil
+	}
+
+	return s.mailValidationService.CreateLink(ctx, email, mailvalidation.PurposeEmailVerification)
+}
+
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	email, err := s.mailValidationService.ValidateLink(ctx, token, mailvalidation.PurposeEmailVerification)
+	if err != nil {
 		return err
 	}
 
+	if err := s.repo.SetEmailVerified(ctx, email); err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
 	return nil
 }
+
+func (s *Service) RequestLoginLink(ctx context.Context, email string) error {
+	email, err := s.emailNormalizer.Normalize(email)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.GetByEMail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.mailValidationService.CreateLink(ctx, email, mailvalidation.PurposeLogin)
+}
+
+func (s *Service) LoginWithLink(ctx context.Context, token string, client ClientInfo) (_ LoginResult, err error) {
+	ctx, span := tracing.Start(ctx, "users.Service.LoginWithLink")
+	defer func() { tracing.End(span, err) }()
+
+	email, err := s.mailValidationService.ValidateLink(ctx, token, mailvalidation.PurposeLogin)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	user, err := s.repo.GetByEMail(ctx, email)
+	if err != nil {
+		return LoginResult{}, ErrUserNotFound
+	}
+
+	return s.completeLogin(ctx, user, email, client)
+}
+
+func (s *Service) Authenticate(ctx context.Context, tokenStr string) (User, error) {
+	claims, err := s.tokenService.Parse(tokenStr)
+	if err != nil {
+		return User{}, err
+	}
+
+	user, err := s.repo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return User{}, ErrUserNotFound
+	}
+
+	if claims.Email != user.Email || claims.IssuedAt.Before(user.SessionsRevokedAt) {
+		return User{}, ErrSessionRevoked
+	}
+
+	session, err := s.repo.GetSession(ctx, claims.SessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return User{}, ErrSessionRevoked
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	now := time.Now()
+	if session.UserID != user.ID || session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return User{}, ErrSessionRevoked
+	}
+
+	if now.Sub(session.LastUsedAt) > sessionTouchInterval {
+		if err := s.repo.TouchSession(ctx, session.ID, now); err != nil {
+			return User{}, err
+		}
+	}
+
+	user.Password = ""
+	user.SessionID = session.ID
+	user.AuthenticatedAt = session.CreatedAt
+
+	return user, nil
+}
+
+func (s *Service) RequestEmailChange(ctx context.Context, user User, newEmail string) error {
+	canonical, err := s.emailNormalizer.Normalize(newEmail)
+	if err != nil {
+		return err
+	}
+
+	newEmail, err = s.emailNormalizer.Clean(newEmail)
+	if err != nil {
+		return err
+	}
+
+	current, err := s.emailNormalizer.Normalize(user.Email)
+	if err != nil {
+		return err
+	}
+
+	if canonical == current {
+		return ErrSameEmail
+	}
+
+	if err := s.registrationPolicy.CheckEmail(ctx, canonical); err != nil {
+		return err
+	}
+
+	_, err = s.repo.GetByEMail(ctx, canonical)
+	if err == nil {
+		return ErrMailAlreadyExists
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	err = s.repo.CreateEmailChange(ctx, EmailChange{
+		UserID:    user.ID,
+		OldEmail:  user.Email,
+		NewEmail:  newEmail,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailValidationService.Create(ctx, newEmail)
+}
+
+func (s *Service) ConfirmEmailChange(ctx context.Context, user User, code int) error {
+	change, err := s.repo.GetPendingEmailChange(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mailValidationService.Validate(ctx, change.NewEmail, code); err != nil {
+		return err
+	}
+
+	canonical, err := s.emailNormalizer.Normalize(change.NewEmail)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.ConfirmEmailChange(ctx, change, canonical, time.Now()); err != nil {
+		return fmt.Errorf("failed to change email: %w", err)
+	}
+
+	reference := strconv.FormatInt(change.ID, 10)
+	if err := s.mailValidationService.CreateReferencedLink(ctx, change.OldEmail, mailvalidation.PurposeEmailChangeUndo, reference); err != nil {
+		return fmt.Errorf("failed to notify previous email: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Service) UndoEmailChange(ctx context.Context, token string) error {
+	// o link desfaz apenas a troca em que foi emitido, nunca uma troca posterior
+	oldEmail, reference, err := s.mailValidationService.ValidateReferencedLink(ctx, token, mailvalidation.PurposeEmailChangeUndo)
+	if err != nil {
+		return err
+	}
+
+	changeID, err := strconv.ParseInt(reference, 10, 64)
+	if err != nil {
+		return mailvalidation.ErrInvalidLink
+	}
+
+	change, err := s.repo.GetConfirmedEmailChange(ctx, changeID)
+	if err != nil {
+		return err
+	}
+	if change.OldEmail != oldEmail {
+		return mailvalidation.ErrInvalidLink
+	}
+
+	canonical, err := s.emailNormalizer.Normalize(change.OldEmail)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UndoEmailChange(ctx, change, canonical, time.Now()); err != nil {
+		return fmt.Errorf("failed to undo email change: %w", err)
+	}
+
+	return nil
+}
+
+// PromoteAdmins promove as contas de ADMIN_EMAILS que já confirmaram o e-mail
+func (s *Service) PromoteAdmins(ctx context.Context, emails []string) error {
+	for _, email := range emails {
+		email, err := s.emailNormalizer.Normalize(email)
+		if err != nil {
+			return err
+		}
+
+		user, err := s.repo.GetByEMail(ctx, email)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to promote admin: %w", err)
+		}
+
+		// qualquer um pode cadastrar o e-mail de um admin; só quem provou ser dono da caixa é promovido
+		if !user.EmailVerified {
+			s.logger.WarnContext(ctx, "admin email not verified, skipping promotion", "user_id", user.ID)
+			continue
+		}
+
+		if err := s.repo.SetRole(ctx, email, RoleAdmin); err != nil {
+			return fmt.Errorf("failed to promote admin: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) RequestUnlock(ctx context.Context, email string) error {
+	email, err := s.emailNormalizer.Normalize(email)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.GetByEMail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.mailValidationService.CreateLink(ctx, email, mailvalidation.PurposeAccountUnlock)
+}
+
+func (s *Service) UnlockWithLink(ctx context.Context, token string) error {
+	email, err := s.mailValidationService.ValidateLink(ctx, token, mailvalidation.PurposeAccountUnlock)
+	if err != nil {
+		return err
+	}
+
+	return s.loginLimiter.Unlock(ctx, email)
+}
+
+func (s *Service) AdminUnlock(ctx context.Context, userID int64) error {
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	email, err := s.emailNormalizer.Normalize(user.Email)
+	if err != nil {
+		return err
+	}
+
+	return s.loginLimiter.Unlock(ctx, email)
+}
+
+const pepperScanPageSize = 500
+
+// PepperStatus conta quantos usuários ainda dependem de cada pepper. Quando não
+// restar nenhum em SecretPrevious ou SecretLegacy o segredo anterior pode ser descartado
+func (s *Service) PepperStatus(ctx context.Context) (PepperStatus, error) {
+	var status PepperStatus
+	err := s.eachUser(ctx, func(user User) error {
+		switch s.hashService.SecretOf(user.Password) {
+		case hash.SecretCurrent:
+			status.Current++
+		case hash.SecretPrevious:
+			status.Previous++
+		case hash.SecretLegacy:
+			status.Legacy++
+		default:
+			status.Unknown++
+		}
+		return nil
+	})
+
+	return status, err
+}
+
+// ForcePepperReset obriga os usuários que ainda dependem do pepper anterior a
+// redefinir a senha pelo link enviado por e-mail. Em caso de erro, a contagem retornada
+// indica quantas senhas já foram descartadas
+func (s *Service) ForcePepperReset(ctx context.Context, includeLegacy bool) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "users.Service.ForcePepperReset")
+	defer func() { tracing.End(span, err) }()
+
+	var stragglers []User
+	err = s.eachUser(ctx, func(user User) error {
+		secret := s.hashService.SecretOf(user.Password)
+		if secret == hash.SecretPrevious || (includeLegacy && secret == hash.SecretLegacy) {
+			stragglers = append(stragglers, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// uma falha no envio do link não interrompe os demais; o usuário ainda pode pedir outro
+	var count int
+	var linkErrs []error
+	for _, user := range stragglers {
+		if err := s.repo.ForcePasswordReset(ctx, user.ID, time.Now()); err != nil {
+			return count, errors.Join(append(linkErrs, err)...)
+		}
+		count++
+
+		email, err := s.emailNormalizer.Normalize(user.Email)
+		if err == nil {
+			err = s.mailValidationService.CreateLink(ctx, email, mailvalidation.PurposePasswordReset)
+		}
+		if err != nil && !errors.Is(err, mailvalidation.ErrCodeAlreadySent) {
+			linkErrs = append(linkErrs, fmt.Errorf("failed to send password reset link to user %d: %w", user.ID, err))
+		}
+	}
+
+	return count, errors.Join(linkErrs...)
+}
+
+func (s *Service) eachUser(ctx context.Context, fn func(user User) error) error {
+	for offset := 0; ; offset += pepperScanPageSize {
+		page, err := s.repo.GetAll(ctx, pepperScanPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list users: %w", err)
+		}
+
+		for _, user := range page {
+			if err := fn(user); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < pepperScanPageSize {
+			return nil
+		}
+	}
+}
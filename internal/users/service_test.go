@@ -3,13 +3,28 @@ package users
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"testing"
+	"time"
 
+	"github.com/juliovcruz/user-register/internal/mailvalidation"
+	"github.com/juliovcruz/user-register/internal/security/hash"
+	"github.com/juliovcruz/user-register/internal/users/password"
 	"github.com/stretchr/testify/require"
 )
 
 type repositoryMock struct {
-	CreateFunc func(ctx context.Context, user User) (User, error)
+	CreateFunc     func(ctx context.Context, user User) (User, error)
+	GetByEMailFunc func(ctx context.Context, email string) (User, error)
+	UpdateFunc     func(ctx context.Context, email, password string) error
+	Users          []User
+	ForcedResets   []int64
+	ForceResetErr  map[int64]error
+	Promoted       []string
+
+	PasswordHistory []string
+	ChangedPassword string
+	Sessions        []Session
 }
 
 func (r *repositoryMock) Create(ctx context.Context, user User) (User, error) {
@@ -17,36 +32,300 @@ func (r *repositoryMock) Create(ctx context.Context, user User) (User, error) {
 }
 
 func (r *repositoryMock) Update(ctx context.Context, email, password string) error {
+	if r.UpdateFunc != nil {
+		return r.UpdateFunc(ctx, email, password)
+	}
+	return nil
+}
+
+func (r *repositoryMock) SetEmailVerified(ctx context.Context, email string) error {
+	return nil
+}
+
+func (r *repositoryMock) SetRole(ctx context.Context, email string, role Role) error {
+	r.Promoted = append(r.Promoted, email)
+	return nil
+}
+
+func (r *repositoryMock) ForcePasswordReset(ctx context.Context, userID int64, at time.Time) error {
+	if err := r.ForceResetErr[userID]; err != nil {
+		return err
+	}
+	r.ForcedResets = append(r.ForcedResets, userID)
+	return nil
+}
+
+func (r *repositoryMock) ChangePassword(ctx context.Context, userID int64, password string, historySize int, at time.Time) error {
+	r.ChangedPassword = password
+	return nil
+}
+
+func (r *repositoryMock) GetPasswordHistory(ctx context.Context, userID int64, limit int) ([]string, error) {
+	return r.PasswordHistory[:min(limit, len(r.PasswordHistory))], nil
+}
+
+func (r *repositoryMock) CreateSession(ctx context.Context, session Session) error {
+	r.Sessions = append(r.Sessions, session)
+	return nil
+}
+
+func (r *repositoryMock) GetSession(ctx context.Context, id string) (Session, error) {
+	for _, session := range r.Sessions {
+		if session.ID == id {
+			return session, nil
+		}
+	}
+	return Session{}, ErrSessionNotFound
+}
+
+func (r *repositoryMock) TouchSession(ctx context.Context, id string, usedAt time.Time) error {
+	return nil
+}
+
+func (r *repositoryMock) ListSessions(ctx context.Context, userID int64, now time.Time) ([]Session, error) {
+	return r.Sessions, nil
+}
+
+func (r *repositoryMock) RevokeSession(ctx context.Context, userID int64, id string, at time.Time) error {
+	return nil
+}
+
+func (r *repositoryMock) RevokeSessions(ctx context.Context, userID int64, at time.Time) error {
 	return nil
 }
 
 func (r *repositoryMock) GetByEMail(ctx context.Context, email string) (User, error) {
+	if r.GetByEMailFunc != nil {
+		return r.GetByEMailFunc(ctx, email)
+	}
+	return User{}, nil
+}
+
+func (r *repositoryMock) GetByID(ctx context.Context, id int64) (User, error) {
+	for _, user := range r.Users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
 	return User{}, nil
 }
 
 func (r *repositoryMock) GetAll(ctx context.Context, limit, offset int) ([]User, error) {
-	return nil, nil
+	if offset >= len(r.Users) {
+		return nil, nil
+	}
+	return r.Users[offset:min(offset+limit, len(r.Users))], nil
+}
+
+func (r *repositoryMock) CreateEmailChange(ctx context.Context, change EmailChange) error {
+	return nil
+}
+
+func (r *repositoryMock) GetPendingEmailChange(ctx context.Context, userID int64) (EmailChange, error) {
+	return EmailChange{}, nil
+}
+
+func (r *repositoryMock) GetConfirmedEmailChange(ctx context.Context, id int64) (EmailChange, error) {
+	return EmailChange{}, nil
+}
+
+func (r *repositoryMock) ConfirmEmailChange(ctx context.Context, change EmailChange, canonical string, confirmedAt time.Time) error {
+	return nil
+}
+
+func (r *repositoryMock) UndoEmailChange(ctx context.Context, change EmailChange, canonical string, undoneAt time.Time) error {
+	return nil
 }
 
 type zipCodeServiceMock struct {
 	GetAddressByZipCodeFunc func(zipCode string) (Address, error)
 }
 
-func (z *zipCodeServiceMock) GetAddressByZipCode(zipCode string) (Address, error) {
+func (z *zipCodeServiceMock) GetAddressByZipCode(ctx context.Context, zipCode string) (Address, error) {
 	return z.GetAddressByZipCodeFunc(zipCode)
 }
 
 type hashServiceMock struct {
-	CreateFunc  func(password string) (string, error)
-	IsValidFunc func(inputPassword, password string) bool
+	CreateFunc func(password string) (string, error)
+	VerifyFunc func(inputPassword, password string) hash.Result
 }
 
-func (h *hashServiceMock) Create(password string) (string, error) {
+func (h *hashServiceMock) Create(ctx context.Context, password string) (string, error) {
 	return h.CreateFunc(password)
 }
 
-func (h *hashServiceMock) IsValid(inputPassword, password string) bool {
-	return h.IsValidFunc(inputPassword, password)
+func (h *hashServiceMock) Verify(ctx context.Context, inputPassword, password string) hash.Result {
+	return h.VerifyFunc(inputPassword, password)
+}
+
+func (h *hashServiceMock) SecretOf(password string) hash.Secret {
+	return hash.Secret(password)
+}
+
+type passwordPolicyMock struct {
+	Err error
+}
+
+func (p *passwordPolicyMock) Check(password, name, email string) error {
+	return p.Err
+}
+
+func (p *passwordPolicyMock) HistorySize() int {
+	return 3
+}
+
+type emailNormalizerMock struct{}
+
+func (e *emailNormalizerMock) Clean(email string) (string, error) {
+	return email, nil
+}
+
+func (e *emailNormalizerMock) Normalize(email string) (string, error) {
+	return email, nil
+}
+
+type tokenServiceMock struct{}
+
+func (t *tokenServiceMock) Create(user User, sessionID string) (string, error) {
+	return "token", nil
+}
+
+func (t *tokenServiceMock) TTL() time.Duration {
+	return time.Minute
+}
+
+func (t *tokenServiceMock) IsValid(tokenStr string) (bool, error) {
+	return true, nil
+}
+
+func (t *tokenServiceMock) Parse(tokenStr string) (TokenClaims, error) {
+	return TokenClaims{}, nil
+}
+
+func (t *tokenServiceMock) CreateMFAChallenge(user User) (string, error) {
+	return "challenge", nil
+}
+
+func (t *tokenServiceMock) ParseMFAChallenge(tokenStr string) (int64, error) {
+	return 0, nil
+}
+
+// metricsRecorderMock conta as métricas registradas por nome e rótulo
+type metricsRecorderMock struct {
+	Recorded map[string]int
+}
+
+func (m *metricsRecorderMock) record(name string) {
+	if m.Recorded == nil {
+		m.Recorded = map[string]int{}
+	}
+	m.Recorded[name]++
+}
+
+func (m *metricsRecorderMock) Registration() {
+	m.record("registration")
+}
+
+func (m *metricsRecorderMock) Login(result string) {
+	m.record("login:" + result)
+}
+
+func (m *metricsRecorderMock) PasswordReset(stage string) {
+	m.record("password_reset:" + stage)
+}
+
+func (m *metricsRecorderMock) MailSent(kind string, err error) {
+	m.record("mail:" + kind)
+}
+
+func (m *metricsRecorderMock) ObserveHash(algorithm, operation string, start time.Time) {
+	m.record("hash:" + algorithm + ":" + operation)
+}
+
+type mfaServiceMock struct {
+	Enabled bool
+}
+
+func (m *mfaServiceMock) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	return m.Enabled, nil
+}
+
+func (m *mfaServiceMock) Verify(ctx context.Context, userID int64, code string) error {
+	return nil
+}
+
+type mailValidationServiceMock struct {
+	CreateCalls     []string
+	CreateLinkCalls []string
+	CreateLinkErr   map[string]error
+	Notifications   []mailvalidation.Notification
+}
+
+func (m *mailValidationServiceMock) Create(ctx context.Context, email string) error {
+	m.CreateCalls = append(m.CreateCalls, email)
+	return nil
+}
+
+func (m *mailValidationServiceMock) Check(ctx context.Context, email string, code int) error {
+	return nil
+}
+
+func (m *mailValidationServiceMock) Validate(ctx context.Context, email string, code int) error {
+	return nil
+}
+
+func (m *mailValidationServiceMock) CreateLink(ctx context.Context, email string, purpose mailvalidation.Purpose) error {
+	m.CreateLinkCalls = append(m.CreateLinkCalls, email)
+	return m.CreateLinkErr[email]
+}
+
+func (m *mailValidationServiceMock) Notify(ctx context.Context, email string, notification mailvalidation.Notification) error {
+	m.Notifications = append(m.Notifications, notification)
+	return nil
+}
+
+func (m *mailValidationServiceMock) InspectLink(token string) (mailvalidation.LinkToken, error) {
+	return mailvalidation.LinkToken{Purpose: mailvalidation.PurposePasswordReset}, nil
+}
+
+func (m *mailValidationServiceMock) ValidateLink(ctx context.Context, token string, purpose mailvalidation.Purpose) (string, error) {
+	return "", nil
+}
+
+func (m *mailValidationServiceMock) CreateReferencedLink(ctx context.Context, email string, purpose mailvalidation.Purpose, reference string) error {
+	m.CreateLinkCalls = append(m.CreateLinkCalls, email)
+	return nil
+}
+
+func (m *mailValidationServiceMock) ValidateReferencedLink(ctx context.Context, token string, purpose mailvalidation.Purpose) (string, string, error) {
+	return "", "", nil
+}
+
+type loginLimiterMock struct {
+	Failures int
+}
+
+func (l *loginLimiterMock) Check(ctx context.Context, email, ip string) error {
+	return nil
+}
+
+func (l *loginLimiterMock) RegisterFailure(ctx context.Context, email, ip string) error {
+	l.Failures++
+	return nil
+}
+
+func (l *loginLimiterMock) RegisterSuccess(ctx context.Context, email string) error {
+	return nil
+}
+
+func (l *loginLimiterMock) Unlock(ctx context.Context, email string) error {
+	return nil
+}
+
+type registrationPolicyMock struct{}
+
+func (p *registrationPolicyMock) CheckEmail(ctx context.Context, email string) error {
+	return nil
 }
 
 func TestService_Create(t *testing.T) {
@@ -54,6 +333,7 @@ func TestService_Create(t *testing.T) {
 		name          string
 		input         CreateUser
 		setupMocks    func(*repositoryMock, *zipCodeServiceMock, *hashServiceMock)
+		passwordErr   error
 		expectedError error
 		expectedUser  User
 	}{
@@ -68,6 +348,18 @@ func TestService_Create(t *testing.T) {
 			setupMocks:    func(r *repositoryMock, z *zipCodeServiceMock, h *hashServiceMock) {},
 			expectedError: ErrPasswordMismatch,
 		},
+		{
+			name: "Password rejected by policy",
+			input: CreateUser{
+				Email:           "test@example.com",
+				Password:        "123456",
+				ConfirmPassword: "123456",
+				ZipCode:         "12345",
+			},
+			setupMocks:    func(r *repositoryMock, z *zipCodeServiceMock, h *hashServiceMock) {},
+			passwordErr:   errors.New("weak password"),
+			expectedError: errors.New("weak password"),
+		},
 		{
 			name: "Fail to fetch address",
 			input: CreateUser{
@@ -122,7 +414,8 @@ func TestService_Create(t *testing.T) {
 			},
 			expectedError: nil,
 			expectedUser: User{
-				Email: "test@example.com",
+				Email:          "test@example.com",
+				EmailCanonical: "test@example.com",
 				Address: Address{
 					Street:  "Main St",
 					ZipCode: "12345",
@@ -139,7 +432,7 @@ func TestService_Create(t *testing.T) {
 
 			tt.setupMocks(repoMock, zipCodeMock, hashMock)
 
-			service := NewService(repoMock, nil, zipCodeMock, hashMock, nil)
+			service := NewService(repoMock, nil, zipCodeMock, hashMock, nil, &emailNormalizerMock{}, &registrationPolicyMock{}, &passwordPolicyMock{Err: tt.passwordErr}, nil, nil, &metricsRecorderMock{}, slog.Default())
 
 			user, err := service.Create(context.Background(), tt.input)
 
@@ -154,3 +447,283 @@ func TestService_Create(t *testing.T) {
 		})
 	}
 }
+
+func TestService_Login(t *testing.T) {
+	tests := []struct {
+		name           string
+		email          string
+		password       string
+		mfaEnabled     bool
+		storedHash     string
+		expectedError  error
+		expectedResult LoginResult
+		expectedHashes []string
+		expectedUpdate string
+	}{
+		{
+			name:           "Unknown email compares against dummy hash",
+			email:          "unknown@example.com",
+			password:       "123456",
+			expectedError:  ErrInvalidLogin,
+			expectedHashes: []string{"dummy"},
+		},
+		{
+			name:           "Wrong password",
+			email:          "test@example.com",
+			password:       "wrong",
+			expectedError:  ErrInvalidLogin,
+			expectedHashes: []string{"hashedPassword"},
+		},
+		{
+			name:           "Success",
+			email:          "test@example.com",
+			password:       "123456",
+			expectedResult: LoginResult{Token: "token"},
+			expectedHashes: []string{"hashedPassword"},
+		},
+		{
+			name:           "Success with mfa enabled returns challenge",
+			email:          "test@example.com",
+			password:       "123456",
+			mfaEnabled:     true,
+			expectedResult: LoginResult{MFARequired: true, MFAToken: "challenge"},
+			expectedHashes: []string{"hashedPassword"},
+		},
+		{
+			name:           "Success with outdated hash persists a new one",
+			email:          "test@example.com",
+			password:       "123456",
+			storedHash:     "outdatedHash",
+			expectedResult: LoginResult{Token: "token"},
+			expectedHashes: []string{"outdatedHash"},
+			expectedUpdate: "dummy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storedHash := tt.storedHash
+			if storedHash == "" {
+				storedHash = "hashedPassword"
+			}
+
+			var comparedHashes []string
+			var updatedHash string
+			repoMock := &repositoryMock{
+				GetByEMailFunc: func(ctx context.Context, email string) (User, error) {
+					if email != "test@example.com" {
+						return User{}, ErrNotFound
+					}
+					return User{Email: email, Password: storedHash}, nil
+				},
+				UpdateFunc: func(ctx context.Context, email, password string) error {
+					updatedHash = password
+					return nil
+				},
+			}
+			hashMock := &hashServiceMock{
+				CreateFunc: func(password string) (string, error) {
+					return "dummy", nil
+				},
+				VerifyFunc: func(inputPassword, password string) hash.Result {
+					comparedHashes = append(comparedHashes, password)
+					return hash.Result{
+						Valid:       password != "dummy" && inputPassword == "123456",
+						NeedsRehash: password == "outdatedHash",
+					}
+				},
+			}
+			limiterMock := &loginLimiterMock{}
+
+			service := NewService(repoMock, &tokenServiceMock{}, nil, hashMock, nil, &emailNormalizerMock{}, nil, &passwordPolicyMock{}, limiterMock, &mfaServiceMock{Enabled: tt.mfaEnabled}, &metricsRecorderMock{}, slog.Default())
+
+			result, err := service.Login(context.Background(), tt.email, tt.password, ClientInfo{IP: "127.0.0.1"})
+
+			require.Equal(t, tt.expectedHashes, comparedHashes)
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Equal(t, 1, limiterMock.Failures)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedResult, result)
+			require.Equal(t, tt.expectedUpdate, updatedHash)
+		})
+	}
+}
+
+func TestService_ForgotPassword(t *testing.T) {
+	repoMock := &repositoryMock{
+		GetByEMailFunc: func(ctx context.Context, email string) (User, error) {
+			if email != "test@example.com" {
+				return User{}, ErrNotFound
+			}
+			return User{Email: email}, nil
+		},
+	}
+	mailMock := &mailValidationServiceMock{}
+
+	service := NewService(repoMock, nil, nil, nil, mailMock, &emailNormalizerMock{}, nil, &passwordPolicyMock{}, nil, nil, &metricsRecorderMock{}, slog.Default())
+
+	require.NoError(t, service.ForgotPassword(context.Background(), "unknown@example.com"))
+	require.NoError(t, service.ForgotPassword(context.Background(), "test@example.com"))
+	require.Equal(t, []string{"test@example.com"}, mailMock.CreateCalls)
+	require.Equal(t, []string{"test@example.com"}, mailMock.CreateLinkCalls)
+}
+
+func TestService_PromoteAdmins(t *testing.T) {
+	repoMock := &repositoryMock{
+		GetByEMailFunc: func(ctx context.Context, email string) (User, error) {
+			switch email {
+			case "verified@example.com":
+				return User{ID: 1, Email: email, EmailVerified: true}, nil
+			case "unverified@example.com":
+				return User{ID: 2, Email: email}, nil
+			}
+			return User{}, ErrNotFound
+		},
+	}
+	service := NewService(repoMock, nil, nil, nil, nil, &emailNormalizerMock{}, nil, nil, nil, nil, &metricsRecorderMock{}, slog.Default())
+
+	err := service.PromoteAdmins(context.Background(), []string{"verified@example.com", "unverified@example.com", "unknown@example.com"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"verified@example.com"}, repoMock.Promoted)
+}
+
+func TestService_ForcePepperReset(t *testing.T) {
+	newRepo := func() *repositoryMock {
+		return &repositoryMock{Users: []User{
+			{ID: 1, Email: "current@example.com", Password: string(hash.SecretCurrent)},
+			{ID: 2, Email: "previous@example.com", Password: string(hash.SecretPrevious)},
+			{ID: 3, Email: "legacy@example.com", Password: string(hash.SecretLegacy)},
+		}}
+	}
+
+	tests := []struct {
+		name          string
+		includeLegacy bool
+		expectedIDs   []int64
+		expectedLinks []string
+	}{
+		{
+			name:          "Only previous pepper",
+			expectedIDs:   []int64{2},
+			expectedLinks: []string{"previous@example.com"},
+		},
+		{
+			name:          "Including legacy hashes",
+			includeLegacy: true,
+			expectedIDs:   []int64{2, 3},
+			expectedLinks: []string{"previous@example.com", "legacy@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoMock := newRepo()
+			mailMock := &mailValidationServiceMock{}
+			service := NewService(repoMock, nil, nil, &hashServiceMock{}, mailMock, &emailNormalizerMock{}, nil, &passwordPolicyMock{}, nil, nil, &metricsRecorderMock{}, slog.Default())
+
+			status, err := service.PepperStatus(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, PepperStatus{Current: 1, Previous: 1, Legacy: 1}, status)
+
+			count, err := service.ForcePepperReset(context.Background(), tt.includeLegacy)
+			require.NoError(t, err)
+			require.Equal(t, len(tt.expectedIDs), count)
+			require.Equal(t, tt.expectedIDs, repoMock.ForcedResets)
+			require.Equal(t, tt.expectedLinks, mailMock.CreateLinkCalls)
+		})
+	}
+
+	t.Run("Failed link does not stop the others", func(t *testing.T) {
+		repoMock := newRepo()
+		mailMock := &mailValidationServiceMock{CreateLinkErr: map[string]error{"previous@example.com": errors.New("smtp down")}}
+		service := NewService(repoMock, nil, nil, &hashServiceMock{}, mailMock, &emailNormalizerMock{}, nil, &passwordPolicyMock{}, nil, nil, &metricsRecorderMock{}, slog.Default())
+
+		count, err := service.ForcePepperReset(context.Background(), true)
+		require.ErrorContains(t, err, "smtp down")
+		require.Equal(t, 2, count)
+		require.Equal(t, []int64{2, 3}, repoMock.ForcedResets)
+		require.Equal(t, []string{"previous@example.com", "legacy@example.com"}, mailMock.CreateLinkCalls)
+	})
+
+	t.Run("Repository failure returns the resets already done", func(t *testing.T) {
+		repoMock := newRepo()
+		repoMock.ForceResetErr = map[int64]error{3: errors.New("database is locked")}
+		service := NewService(repoMock, nil, nil, &hashServiceMock{}, &mailValidationServiceMock{}, &emailNormalizerMock{}, nil, &passwordPolicyMock{}, nil, nil, &metricsRecorderMock{}, slog.Default())
+
+		count, err := service.ForcePepperReset(context.Background(), true)
+		require.ErrorContains(t, err, "database is locked")
+		require.Equal(t, 1, count)
+	})
+}
+
+func TestService_ChangePassword(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       ChangePassword
+		expectedError error
+		expectedHash  string
+	}{
+		{
+			name:          "Password mismatch",
+			request:       ChangePassword{CurrentPassword: "current", Password: "new", ConfirmPassword: "other"},
+			expectedError: ErrPasswordMismatch,
+		},
+		{
+			name:          "Invalid current password",
+			request:       ChangePassword{CurrentPassword: "wrong", Password: "new", ConfirmPassword: "new"},
+			expectedError: ErrInvalidPassword,
+		},
+		{
+			name:          "Reusing current password",
+			request:       ChangePassword{CurrentPassword: "current", Password: "current", ConfirmPassword: "current"},
+			expectedError: password.ErrReused,
+		},
+		{
+			name:          "Reusing password from history",
+			request:       ChangePassword{CurrentPassword: "current", Password: "older", ConfirmPassword: "older"},
+			expectedError: password.ErrReused,
+		},
+		{
+			name:         "Password outside the history window",
+			request:      ChangePassword{CurrentPassword: "current", Password: "oldest", ConfirmPassword: "oldest"},
+			expectedHash: "hash:oldest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoMock := &repositoryMock{
+				Users:           []User{{ID: 1, Email: "test@example.com", Password: "hash:current"}},
+				PasswordHistory: []string{"hash:old", "hash:older", "hash:oldest"},
+			}
+			hashMock := &hashServiceMock{
+				CreateFunc: func(password string) (string, error) {
+					return "hash:" + password, nil
+				},
+				VerifyFunc: func(inputPassword, password string) hash.Result {
+					return hash.Result{Valid: "hash:"+inputPassword == password}
+				},
+			}
+			mailMock := &mailValidationServiceMock{}
+			limiterMock := &loginLimiterMock{}
+
+			service := NewService(repoMock, &tokenServiceMock{}, nil, hashMock, mailMock, &emailNormalizerMock{}, nil, &passwordPolicyMock{}, limiterMock, nil, &metricsRecorderMock{}, slog.Default())
+
+			token, err := service.ChangePassword(context.Background(), User{ID: 1}, tt.request, ClientInfo{IP: "127.0.0.1"})
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Empty(t, repoMock.ChangedPassword)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, "token", token)
+			require.Equal(t, tt.expectedHash, repoMock.ChangedPassword)
+			require.Equal(t, []mailvalidation.Notification{mailvalidation.NotificationPasswordChanged}, mailMock.Notifications)
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package zipcode
 
-import "github.com/juliovcruz/user-register/internal/users"
+import (
+	"context"
+
+	"github.com/juliovcruz/user-register/internal/platform/tracing"
+	"github.com/juliovcruz/user-register/internal/users"
+)
 
 type Client interface {
-	GetAddressByZipCode(zipCode string) (users.Address, error)
+	GetAddressByZipCode(ctx context.Context, zipCode string) (users.Address, error)
 }
 
 type Service struct {
@@ -16,6 +21,9 @@ func NewService(client Client) *Service {
 	}
 }
 
-func (s *Service) GetAddressByZipCode(zipCode string) (users.Address, error) {
-	return s.client.GetAddressByZipCode(zipCode)
+func (s *Service) GetAddressByZipCode(ctx context.Context, zipCode string) (users.Address, error) {
+	ctx, span := tracing.Start(ctx, "zipcode.Service.GetAddressByZipCode")
+	defer span.End()
+
+	return s.client.GetAddressByZipCode(ctx, zipCode)
 }
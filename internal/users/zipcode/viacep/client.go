@@ -1,34 +1,68 @@
 package viacep
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/juliovcruz/user-register/internal/platform/logging"
+	"github.com/juliovcruz/user-register/internal/platform/tracing"
 	"github.com/juliovcruz/user-register/internal/settings"
 	"github.com/juliovcruz/user-register/internal/users"
 	"github.com/juliovcruz/user-register/internal/users/zipcode"
 	"github.com/valyala/fasthttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
+type metricsRecorder interface {
+	ObserveExternal(service string, start time.Time, err error)
+}
+
 type Client struct {
 	baseURL    string
 	httpClient *fasthttp.Client
+	metrics    metricsRecorder
 }
 
-func NewClient(settings settings.ZipCode) *Client {
+func NewClient(settings settings.ZipCode, metrics metricsRecorder) *Client {
 	return &Client{
 		baseURL:    settings.ViaCEPBaseURL,
 		httpClient: &fasthttp.Client{},
+		metrics:    metrics,
 	}
 }
 
-func (c *Client) GetAddressByZipCode(zipCode string) (users.Address, error) {
+// zipCodeRoute é o template da URL consultada, registrado nos spans no lugar do CEP
+const zipCodeRoute = "/{cep}/json"
+
+func (c *Client) GetAddressByZipCode(ctx context.Context, zipCode string) (users.Address, error) {
 	resp := fasthttp.AcquireResponse()
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseResponse(resp)
 	defer fasthttp.ReleaseRequest(req)
 
 	req.SetRequestURI(fmt.Sprintf("%s/%s/json", c.baseURL, zipCode))
+	ctx, span := tracing.StartClient(ctx, "viacep.GetAddressByZipCode", zipCodeRoute, req)
+	setRequestID(ctx, req)
+
+	start := time.Now()
+	address, err := c.getAddressByZipCode(req, resp)
+
+	// CEP inválido ou inexistente é uma resposta válida do ViaCEP, não uma falha da chamada
+	failure := err
+	if errors.Is(err, zipcode.ErrZipCodeNotFound) || errors.Is(err, zipcode.ErrInvalidZipCode) {
+		failure = nil
+	}
+	c.metrics.ObserveExternal("viacep", start, failure)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode()))
+	tracing.End(span, failure)
+
+	return address, err
+}
+
+func (c *Client) getAddressByZipCode(req *fasthttp.Request, resp *fasthttp.Response) (users.Address, error) {
 	if err := c.httpClient.Do(req, resp); err != nil {
 		return users.Address{}, fmt.Errorf("request error: %w", err)
 	}
@@ -54,6 +88,48 @@ func (c *Client) GetAddressByZipCode(zipCode string) (users.Address, error) {
 	}
 }
 
+// healthCheckZipCode é o CEP da Praça da Sé, usado apenas para verificar se o ViaCEP responde
+const healthCheckZipCode = "01001000"
+
+// Check verifica se o ViaCEP está acessível dentro do prazo de ctx
+func (c *Client) Check(ctx context.Context) error {
+	resp := fasthttp.AcquireResponse()
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseResponse(resp)
+	defer fasthttp.ReleaseRequest(req)
+
+	req.SetRequestURI(fmt.Sprintf("%s/%s/json", c.baseURL, healthCheckZipCode))
+	ctx, span := tracing.StartClient(ctx, "viacep.Check", zipCodeRoute, req)
+	setRequestID(ctx, req)
+
+	err := c.check(ctx, req, resp)
+	tracing.End(span, err)
+	return err
+}
+
+func (c *Client) check(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Second * 5)
+	}
+	if err := c.httpClient.DoDeadline(req, resp, deadline); err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return fmt.Errorf("invalid status_code: %d", resp.StatusCode())
+	}
+
+	return nil
+}
+
+// setRequestID propaga o X-Request-ID da requisição de origem para o ViaCEP
+func setRequestID(ctx context.Context, req *fasthttp.Request) {
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+}
+
 func parseResponse(apiResp apiResponse) users.Address {
 	return users.Address{
 		Street:       apiResp.Logradouro,